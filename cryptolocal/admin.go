@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// adminDB is the database the admin endpoints change, and nil when serving
+// from a fixture. The endpoints are disabled unless adminToken is set too.
+var adminDB *ratestore.Database
+
+// adminToken is the bearer token the admin endpoints require.
+var adminToken string
+
+// maxImportSize bounds the body of an archive import.
+var maxImportSize int64 = 256 << 20
+
+// handleAdminCurrencies serves the currency admin endpoints:
+//
+//	POST   /admin/currencies                 adds the currency in the body
+//	PATCH  /admin/currencies/{type}/{symbol} enables or disables it with {"active": false}
+//	DELETE /admin/currencies/{type}/{symbol} removes a currency that has no rates
+//
+// Changes are picked up by the next ingestion run.
+func handleAdminCurrencies(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	splitPath := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(splitPath) == 2:
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			adminError(w, http.StatusMethodNotAllowed, "Use POST to add a currency.")
+			return
+		}
+		handleAddCurrency(w, r)
+	case len(splitPath) == 4:
+		currencyType, symbol := splitPath[2], splitPath[3]
+		if currencyType != ratestore.CurrencyTypeCrypto && currencyType != ratestore.CurrencyTypeFiat {
+			adminError(w, http.StatusNotFound, "Unknown currency type "+currencyType+", expected crypto or fiat.")
+			return
+		}
+		switch r.Method {
+		case http.MethodPatch:
+			handleSetCurrencyActive(w, r, currencyType, symbol)
+		case http.MethodDelete:
+			handleRemoveCurrency(w, currencyType, symbol)
+		default:
+			w.Header().Set("Allow", http.MethodPatch+", "+http.MethodDelete)
+			adminError(w, http.StatusMethodNotAllowed, "Use PATCH to enable or disable a currency and DELETE to remove it.")
+		}
+	default:
+		adminError(w, http.StatusNotFound, "Valid URL formats:\n1. POST /admin/currencies\n2. PATCH /admin/currencies/{type}/{symbol}\n3. DELETE /admin/currencies/{type}/{symbol}")
+	}
+}
+
+// authorizeAdmin checks that the admin endpoints are enabled and that r
+// carries the admin token, and answers the request if not.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if adminDB == nil || adminToken == "" {
+		adminError(w, http.StatusNotFound, "The admin endpoints are disabled until an admin token is configured.")
+		return false
+	}
+	if !ratestore.AuthorizeAdmin(r.Header.Get("Authorization"), adminToken) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		adminError(w, http.StatusUnauthorized, "A valid admin bearer token is required.")
+		return false
+	}
+	return true
+}
+
+func handleAddCurrency(w http.ResponseWriter, r *http.Request) {
+	var c ratestore.Currency
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		adminError(w, http.StatusBadRequest, "Invalid currency: "+err.Error()+".")
+		return
+	}
+	if err := ratestore.ValidateCurrencies([]ratestore.Currency{c}); err != nil {
+		adminError(w, http.StatusBadRequest, err.Error()+".")
+		return
+	}
+
+	added, err := adminDB.AddCurrency(c)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	log.Printf("Admin added %s currency %s", added.Type, added.Symbol)
+
+	writeAdminJSON(w, http.StatusCreated, added)
+}
+
+func handleSetCurrencyActive(w http.ResponseWriter, r *http.Request, currencyType, symbol string) {
+	var change struct {
+		Active *bool `json:"active"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&change); err != nil || change.Active == nil {
+		adminError(w, http.StatusBadRequest, `The body must be {"active": true} or {"active": false}.`)
+		return
+	}
+
+	c, err := adminDB.SetCurrencyActive(currencyType, symbol, *change.Active)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	log.Printf("Admin set %s currency %s active=%t", currencyType, symbol, c.Active)
+
+	writeAdminJSON(w, http.StatusOK, c)
+}
+
+func handleRemoveCurrency(w http.ResponseWriter, currencyType, symbol string) {
+	if err := adminDB.RemoveCurrency(currencyType, symbol); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	log.Printf("Admin removed %s currency %s", currencyType, symbol)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminExchangeRates serves the exchange rate archive endpoints:
+//
+//	GET  /admin/exchange-rates?from=&to=&format=csv|parquet exports the raw rates of a time range
+//	POST /admin/exchange-rates?format=csv|parquet           imports the archive in the body
+//
+// Both default to CSV, and an export to every rate until now.
+func handleAdminExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = formatCSV
+	}
+	if _, err := archiveFormat(format, ""); err != nil {
+		adminError(w, http.StatusBadRequest, "Invalid format "+format+", expected csv or parquet.")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		from, to := time.Unix(0, 0), time.Now()
+		var err error
+		if value := query.Get("from"); value != "" {
+			if from, err = parseDayOrTime(value); err != nil {
+				adminError(w, http.StatusBadRequest, "Invalid from: "+err.Error()+".")
+				return
+			}
+		}
+		if value := query.Get("to"); value != "" {
+			if to, err = parseDayOrTime(value); err != nil {
+				adminError(w, http.StatusBadRequest, "Invalid to: "+err.Error()+".")
+				return
+			}
+		}
+		handleExportExchangeRates(w, format, from, to)
+	case http.MethodPost:
+		handleImportExchangeRates(w, r, format)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		adminError(w, http.StatusMethodNotAllowed, "Use GET to export exchange rates and POST to import them.")
+	}
+}
+
+// handleExportExchangeRates streams the archive as it is read from the
+// database, so an error after the first rate can only be logged.
+func handleExportExchangeRates(w http.ResponseWriter, format string, from, to time.Time) {
+	contentType := "text/csv"
+	if format == formatParquet {
+		contentType = "application/vnd.apache.parquet"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="exchange-rates.%s"`, format))
+
+	n, err := exportArchive(adminDB, w, format, from, to)
+	if err != nil {
+		log.Printf("Error exporting exchange rates after %d rates: %v", n, err)
+		return
+	}
+	log.Printf("Admin exported %d exchange rates", n)
+}
+
+// handleImportExchangeRates imports the archive in the body. The snapshots
+// stored before an error are kept, which the error response tells, since
+// importing the archive again skips them.
+func handleImportExchangeRates(w http.ResponseWriter, r *http.Request, format string) {
+	body := &importBody{Reader: http.MaxBytesReader(w, r.Body, maxImportSize)}
+	result, err := importArchive(adminDB, body, format)
+	if err != nil {
+		stored := fmt.Sprintf(" The %d snapshots stored before are kept; importing the archive again skips their rates.", result.Snapshots)
+		switch {
+		case body.tooLarge:
+			adminError(w, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Import stopped after %d rates: the archive is larger than %d bytes.", result.Rates, maxImportSize)+stored)
+		case errors.Is(err, ratestore.ErrInvalidArchive), errors.Is(err, ratestore.ErrUnknownCurrency):
+			adminError(w, http.StatusBadRequest, fmt.Sprintf("Import stopped after %d rates: %v.", result.Rates, err)+stored)
+		default:
+			log.Println("Error importing exchange rates:", err)
+			adminError(w, http.StatusInternalServerError, fmt.Sprintf("Import stopped after %d rates.", result.Rates)+stored)
+		}
+		return
+	}
+	log.Printf("Admin imported %d exchange rates in %d snapshots, %d already stored", result.Rates-result.Replayed, result.Snapshots, result.Replayed)
+
+	writeAdminJSON(w, http.StatusOK, result)
+}
+
+// importBody is the body of an import, which records whether it was larger
+// than maxImportSize: Go 1.18 does not export the error of MaxBytesReader,
+// and the archive readers do not keep the read errors they wrap.
+type importBody struct {
+	io.Reader
+	read     int64
+	tooLarge bool
+}
+
+func (b *importBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= maxImportSize {
+		b.tooLarge = true
+	}
+	return n, err
+}
+
+// writeAdminError answers with the status matching an error of the currency
+// administration.
+func writeAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ratestore.ErrNotFound):
+		adminError(w, http.StatusNotFound, "Currency not found.")
+	case errors.Is(err, ratestore.ErrCurrencyExists):
+		adminError(w, http.StatusConflict, "The currency already exists; enable it with PATCH if it is disabled.")
+	case errors.Is(err, ratestore.ErrCurrencyInUse):
+		adminError(w, http.StatusConflict, "The currency has exchange rates and cannot be removed; disable it instead.")
+	default:
+		log.Println("Error changing currencies:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func adminError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	w.Write([]byte(message))
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	responseBody, _ := json.Marshal(v)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(responseBody)
+}
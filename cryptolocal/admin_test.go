@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+const testAdminToken = "test-admin-token-0123"
+
+// useAdminDatabase enables the admin endpoints on a migrated SQLite database
+// for the duration of the test, and serves the rates from it too.
+func useAdminDatabase(t *testing.T) *ratestore.Database {
+	db := newSeedDatabase(t)
+
+	previousDB, previousToken, previousStore := adminDB, adminToken, store
+	adminDB, adminToken, store = db, testAdminToken, db
+	t.Cleanup(func() { adminDB, adminToken, store = previousDB, previousToken, previousStore })
+
+	return db
+}
+
+func serveAdmin(method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handleAdminCurrencies(w, r)
+	return w
+}
+
+func TestHandleAdminCurrenciesAuthorization(t *testing.T) {
+	useAdminDatabase(t)
+
+	w := serveAdmin(http.MethodPost, "/admin/currencies", "", `{}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, serveAdmin(http.MethodPost, "/admin/currencies", "wrong-token", `{}`).Code)
+
+	adminToken = ""
+	assert.Equal(t, http.StatusNotFound, serveAdmin(http.MethodPost, "/admin/currencies", testAdminToken, `{}`).Code)
+}
+
+func TestHandleAdminCurrencies(t *testing.T) {
+	useAdminDatabase(t)
+
+	w := serveAdmin(http.MethodPost, "/admin/currencies", testAdminToken,
+		`{"symbol": "PEPE", "name": "Pepe", "type": "crypto", "decimals": 18, "chain": "ethereum", "contract_address": "0x6982508145454Ce325dDbE47a25d4ec3d2311933", "active": false}`)
+	assert.Equal(t, http.StatusCreated, w.Code, "an added currency is active whatever the body says")
+	assert.JSONEq(t, `{"symbol": "PEPE", "name": "Pepe", "type": "crypto", "decimals": 18, "chain": "ethereum",
+		"contract_address": "0x6982508145454Ce325dDbE47a25d4ec3d2311933", "active": true}`, w.Body.String())
+
+	w = serveAdmin(http.MethodPost, "/admin/currencies", testAdminToken, `{"symbol": "PEPE", "name": "Pepe", "type": "crypto"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = serveAdmin(http.MethodPost, "/admin/currencies", testAdminToken, `{"symbol": "pepe", "type": "token"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "symbol must be upper case")
+	w = serveAdmin(http.MethodPost, "/admin/currencies", testAdminToken, `{"symbol": "PEPE", "ticker": "PEPE"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveAdmin(http.MethodPost, "/admin/currencies", testAdminToken, `{"symbol": "USD", "name": "US Dollar", "type": "fiat", "decimals": 2}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = serveAdmin(http.MethodPatch, "/admin/currencies/crypto/PEPE", testAdminToken, `{"active": false}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"active":false`)
+
+	w = serve("/rates/PEPE/USD")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Currency PEPE is disabled")
+
+	assert.Equal(t, http.StatusBadRequest, serveAdmin(http.MethodPatch, "/admin/currencies/crypto/PEPE", testAdminToken, `{}`).Code)
+	assert.Equal(t, http.StatusNotFound, serveAdmin(http.MethodPatch, "/admin/currencies/crypto/DOGE", testAdminToken, `{"active": true}`).Code)
+	assert.Equal(t, http.StatusNotFound, serveAdmin(http.MethodPatch, "/admin/currencies/token/PEPE", testAdminToken, `{"active": true}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serveAdmin(http.MethodGet, "/admin/currencies/crypto/PEPE", testAdminToken, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, serveAdmin(http.MethodDelete, "/admin/currencies/crypto/PEPE", testAdminToken, "").Code)
+	assert.Equal(t, http.StatusNotFound, serveAdmin(http.MethodDelete, "/admin/currencies/crypto/PEPE", testAdminToken, "").Code)
+}
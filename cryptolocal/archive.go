@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sushant-iitp/hellogo/ratestore"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Formats of an exchange rate archive.
+const (
+	formatCSV     = "csv"
+	formatParquet = "parquet"
+)
+
+const (
+	exportUsage = "usage: export [-from DATE] [-to DATE] [-format csv|parquet] <file>"
+	importUsage = "usage: import [-format csv|parquet] <file>"
+)
+
+// csvHeader is the first record of a CSV archive.
+var csvHeader = []string{"crypto", "fiat", "rate", "timestamp", "source"}
+
+// parquetRate is a row of a Parquet archive. The rate is a DECIMAL(18, 8),
+// like the rate columns of the database, and the timestamp is in UTC.
+type parquetRate struct {
+	Crypto    string `parquet:"name=crypto, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Fiat      string `parquet:"name=fiat, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Rate      int64  `parquet:"name=rate, type=INT64, convertedtype=DECIMAL, scale=8, precision=18"`
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Source    string `parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+}
+
+// parquetScale is the scale of the rate column of a Parquet archive, and
+// maxParquetRate the first unscaled rate it cannot hold.
+var (
+	parquetScale   int32 = 8
+	maxParquetRate       = decimal.New(1, 18)
+)
+
+// parquetReadBatch is the number of rows read from a Parquet archive at once.
+const parquetReadBatch = 1000
+
+// archiveFormat returns format if it is set, or the format matching the
+// extension of path otherwise.
+func archiveFormat(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if format != formatCSV && format != formatParquet {
+		return "", fmt.Errorf("invalid archive format %q, expected %s or %s", format, formatCSV, formatParquet)
+	}
+	return format, nil
+}
+
+// exportArchive writes the raw exchange rates from from up to to to w as an
+// archive in format, and returns the number of rates written.
+func exportArchive(db *ratestore.Database, w io.Writer, format string, from, to time.Time) (int, error) {
+	if format == formatParquet {
+		return exportParquet(db, w, from, to)
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return 0, err
+	}
+	n, err := db.ExportExchangeRates(from, to, func(rate ratestore.ArchivedRate) error {
+		return out.Write([]string{rate.Crypto, rate.Fiat, rate.Rate.String(), rate.Timestamp.Format(time.RFC3339Nano), rate.Source})
+	})
+	if err != nil {
+		return n, err
+	}
+	out.Flush()
+	return n, out.Error()
+}
+
+func exportParquet(db *ratestore.Database, w io.Writer, from, to time.Time) (int, error) {
+	out, err := writer.NewParquetWriterFromWriter(w, new(parquetRate), 1)
+	if err != nil {
+		return 0, err
+	}
+	n, err := db.ExportExchangeRates(from, to, func(rate ratestore.ArchivedRate) error {
+		unscaled := rate.Rate.Round(parquetScale).Shift(parquetScale)
+		if unscaled.Abs().GreaterThanOrEqual(maxParquetRate) {
+			return fmt.Errorf("rate %s of %s/%s does not fit a DECIMAL(18, 8)", rate.Rate, rate.Crypto, rate.Fiat)
+		}
+		return out.Write(parquetRate{
+			Crypto:    rate.Crypto,
+			Fiat:      rate.Fiat,
+			Rate:      unscaled.IntPart(),
+			Timestamp: rate.Timestamp.UnixMicro(),
+			Source:    rate.Source,
+		})
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, out.WriteStop()
+}
+
+// importArchive stores the exchange rates of the archive in format read from
+// r. A Parquet archive is read into memory first, since its index is at its
+// end.
+func importArchive(db *ratestore.Database, r io.Reader, format string) (ratestore.ImportResult, error) {
+	if format == formatParquet {
+		return importParquet(db, r)
+	}
+
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = len(csvHeader)
+	header, err := in.Read()
+	if errors.Is(err, io.EOF) {
+		return ratestore.ImportResult{}, nil
+	}
+	if err != nil {
+		return ratestore.ImportResult{}, fmt.Errorf("%w: %v", ratestore.ErrInvalidArchive, err)
+	}
+	if strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+		return ratestore.ImportResult{}, fmt.Errorf("%w: CSV header %q, expected %q", ratestore.ErrInvalidArchive,
+			strings.Join(header, ","), strings.Join(csvHeader, ","))
+	}
+
+	return db.ImportExchangeRates(func() (ratestore.ArchivedRate, error) {
+		record, err := in.Read()
+		if errors.Is(err, io.EOF) {
+			return ratestore.ArchivedRate{}, err
+		}
+		if err != nil {
+			return ratestore.ArchivedRate{}, fmt.Errorf("%w: %v", ratestore.ErrInvalidArchive, err)
+		}
+		line, _ := in.FieldPos(0)
+
+		rate := ratestore.ArchivedRate{Crypto: record[0], Fiat: record[1], Source: record[4]}
+		if rate.Rate, err = decimal.NewFromString(record[2]); err != nil {
+			return rate, fmt.Errorf("%w: line %d: invalid rate %q", ratestore.ErrInvalidArchive, line, record[2])
+		}
+		if rate.Timestamp, err = time.Parse(time.RFC3339Nano, record[3]); err != nil {
+			return rate, fmt.Errorf("%w: line %d: invalid timestamp %q", ratestore.ErrInvalidArchive, line, record[3])
+		}
+		return rate, nil
+	})
+}
+
+func importParquet(db *ratestore.Database, r io.Reader) (ratestore.ImportResult, error) {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return ratestore.ImportResult{}, fmt.Errorf("%w: %v", ratestore.ErrInvalidArchive, err)
+	}
+	file, err := buffer.NewBufferFile(contents)
+	if err != nil {
+		return ratestore.ImportResult{}, err
+	}
+	in, err := reader.NewParquetReader(file, new(parquetRate), 1)
+	if err != nil {
+		return ratestore.ImportResult{}, fmt.Errorf("%w: %v", ratestore.ErrInvalidArchive, err)
+	}
+	defer in.ReadStop()
+
+	remaining := int(in.GetNumRows())
+	var rows []parquetRate
+	return db.ImportExchangeRates(func() (ratestore.ArchivedRate, error) {
+		if len(rows) == 0 {
+			if remaining == 0 {
+				return ratestore.ArchivedRate{}, io.EOF
+			}
+			n := parquetReadBatch
+			if n > remaining {
+				n = remaining
+			}
+			rows = make([]parquetRate, n)
+			if err := in.Read(&rows); err != nil {
+				return ratestore.ArchivedRate{}, fmt.Errorf("%w: %v", ratestore.ErrInvalidArchive, err)
+			}
+			remaining -= n
+		}
+
+		row := rows[0]
+		rows = rows[1:]
+		return ratestore.ArchivedRate{
+			Crypto:    row.Crypto,
+			Fiat:      row.Fiat,
+			Rate:      decimal.New(row.Rate, -parquetScale),
+			Timestamp: time.UnixMicro(row.Timestamp).UTC(),
+			Source:    row.Source,
+		}, nil
+	})
+}
+
+// runExport runs the export subcommand, which writes the raw exchange rates of
+// a time range, every one by default, to a CSV or Parquet file, or to the
+// standard output if the file is "-".
+func runExport(db *ratestore.Database, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fromFlag := fs.String("from", "", "first day (2006-01-02) or time (RFC 3339) to export")
+	toFlag := fs.String("to", "", "day or time to export up to, now by default")
+	formatFlag := fs.String("format", "", "csv or parquet, from the file extension by default")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errors.New(exportUsage)
+	}
+	path := fs.Arg(0)
+
+	format, err := archiveFormat(*formatFlag, path)
+	if err != nil {
+		return err
+	}
+	from, to := time.Unix(0, 0), time.Now()
+	if *fromFlag != "" {
+		if from, err = parseDayOrTime(*fromFlag); err != nil {
+			return err
+		}
+	}
+	if *toFlag != "" {
+		if to, err = parseDayOrTime(*toFlag); err != nil {
+			return err
+		}
+	}
+
+	if path == "-" {
+		_, err := exportArchive(db, out, format, from, to)
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n, err := exportArchive(db, file, format, from, to)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported %d rates to %s\n", n, path)
+	return nil
+}
+
+// runImport runs the import subcommand, which stores the exchange rates of a
+// CSV or Parquet archive, read from the standard input if the file is "-".
+func runImport(db *ratestore.Database, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	formatFlag := fs.String("format", "", "csv or parquet, from the file extension by default")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+	path := fs.Arg(0)
+
+	format, err := archiveFormat(*formatFlag, path)
+	if err != nil {
+		return err
+	}
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	result, err := importArchive(db, in, format)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "imported %d rates in %d snapshots, skipped %d already stored\n", result.Rates-result.Replayed, result.Snapshots, result.Replayed)
+	return nil
+}
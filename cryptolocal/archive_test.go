@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// newArchiveDatabase returns a migrated database with BTC, ETH and USD.
+func newArchiveDatabase(t *testing.T) *ratestore.Database {
+	db := newSeedDatabase(t)
+	seedArchiveCurrencies(t, db)
+	return db
+}
+
+func seedArchiveCurrencies(t *testing.T, db *ratestore.Database) {
+	_, err := db.SeedCurrencies([]ratestore.Currency{
+		{Symbol: "BTC", Name: "Bitcoin", Type: ratestore.CurrencyTypeCrypto},
+		{Symbol: "ETH", Name: "Ether", Type: ratestore.CurrencyTypeCrypto},
+		{Symbol: "USD", Name: "US Dollar", Type: ratestore.CurrencyTypeFiat},
+	}, false)
+	require.NoError(t, err)
+}
+
+// storeArchiveRates stores two snapshots of BTC/USD and ETH/USD an hour apart,
+// the second from kraken, and returns the time of the first.
+func storeArchiveRates(t *testing.T, db *ratestore.Database) time.Time {
+	cryptoIDs, err := db.GetCryptoMappings()
+	require.NoError(t, err)
+	fiatIDs, err := db.GetFiatMappings()
+	require.NoError(t, err)
+
+	first := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i, source := range []string{ratestore.DefaultSource, "kraken"} {
+		timestamp := first.Add(time.Duration(i) * time.Hour)
+		_, err := db.InsertExchangeRates([]ratestore.ExchangeRate{
+			{CryptoID: cryptoIDs["BTC"], FiatID: fiatIDs["USD"], Rate: decimal.RequireFromString("30000.12345678"), Timestamp: timestamp, Source: source},
+			{CryptoID: cryptoIDs["ETH"], FiatID: fiatIDs["USD"], Rate: decimal.RequireFromString("1900.5"), Timestamp: timestamp, Source: source},
+		})
+		require.NoError(t, err)
+	}
+	return first
+}
+
+func TestRunExportImport(t *testing.T) {
+	for _, format := range []string{formatCSV, formatParquet} {
+		t.Run(format, func(t *testing.T) {
+			source := newArchiveDatabase(t)
+			first := storeArchiveRates(t, source)
+			path := filepath.Join(t.TempDir(), "rates."+format)
+
+			var out bytes.Buffer
+			require.NoError(t, runExport(source, []string{"-from", "2023-07-01", path}, &out))
+			assert.Equal(t, "exported 4 rates to "+path+"\n", out.String())
+
+			target := newArchiveDatabase(t)
+			out.Reset()
+			require.NoError(t, runImport(target, []string{path}, &out))
+			assert.Equal(t, "imported 4 rates in 2 snapshots, skipped 0 already stored\n", out.String())
+
+			out.Reset()
+			require.NoError(t, runImport(target, []string{path}, &out))
+			assert.Equal(t, "imported 0 rates in 0 snapshots, skipped 4 already stored\n", out.String())
+
+			var exported []ratestore.ArchivedRate
+			_, err := target.ExportExchangeRates(first, first.Add(24*time.Hour), func(rate ratestore.ArchivedRate) error {
+				exported = append(exported, rate)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Len(t, exported, 4)
+			assert.Equal(t, "BTC", exported[0].Crypto)
+			assert.Equal(t, "30000.12345678", exported[0].Rate.String())
+			assert.True(t, first.Equal(exported[0].Timestamp))
+			assert.Equal(t, ratestore.DefaultSource, exported[0].Source)
+			assert.Equal(t, "kraken", exported[3].Source)
+		})
+	}
+}
+
+func TestRunExportImportErrors(t *testing.T) {
+	db := newArchiveDatabase(t)
+	var out bytes.Buffer
+
+	assert.EqualError(t, runExport(db, nil, &out), exportUsage)
+	assert.Error(t, runExport(db, []string{"rates.json"}, &out))
+	assert.Error(t, runExport(db, []string{"-from", "yesterday", "rates.csv"}, &out))
+	assert.EqualError(t, runImport(db, nil, &out), importUsage)
+
+	path := filepath.Join(t.TempDir(), "rates.csv")
+	require.NoError(t, runExport(db, []string{path}, &out))
+	assert.Error(t, runImport(db, []string{"-format", "parquet", path}, &out))
+
+	_, err := importArchive(db, strings.NewReader("crypto,fiat,rate,timestamp,source\nDOGE,USD,0.07,2023-07-01T12:00:00Z,cryptocompare\n"), formatCSV)
+	assert.ErrorIs(t, err, ratestore.ErrUnknownCurrency)
+	_, err = importArchive(db, strings.NewReader("crypto,fiat,rate,timestamp,source\nBTC,USD,lots,2023-07-01T12:00:00Z,cryptocompare\n"), formatCSV)
+	assert.ErrorIs(t, err, ratestore.ErrInvalidArchive)
+	assert.Contains(t, err.Error(), `line 2: invalid rate "lots"`)
+	_, err = importArchive(db, strings.NewReader("symbol,rate\nBTC,30000\n"), formatCSV)
+	assert.ErrorIs(t, err, ratestore.ErrInvalidArchive)
+}
+
+func serveAdminExchangeRates(method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+	w := httptest.NewRecorder()
+	handleAdminExchangeRates(w, r)
+	return w
+}
+
+func TestHandleAdminExchangeRates(t *testing.T) {
+	db := useAdminDatabase(t)
+	seedArchiveCurrencies(t, db)
+	storeArchiveRates(t, db)
+
+	w := serveAdminExchangeRates(http.MethodGet, "/admin/exchange-rates?from=2023-07-01T12:30:00Z", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="exchange-rates.csv"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "crypto,fiat,rate,timestamp,source\n"+
+		"BTC,USD,30000.12345678,2023-07-01T13:00:00Z,kraken\n"+
+		"ETH,USD,1900.5,2023-07-01T13:00:00Z,kraken\n", w.Body.String())
+
+	w = serveAdminExchangeRates(http.MethodGet, "/admin/exchange-rates?format=parquet", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.apache.parquet", w.Header().Get("Content-Type"))
+	archive := w.Body.String()
+
+	w = serveAdminExchangeRates(http.MethodPost, "/admin/exchange-rates?format=parquet", archive)
+	require.Equal(t, http.StatusOK, w.Code)
+	var result ratestore.ImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, ratestore.ImportResult{Rates: 4, Replayed: 4}, result)
+
+	w = serveAdminExchangeRates(http.MethodPost, "/admin/exchange-rates",
+		"crypto,fiat,rate,timestamp,source\nDOGE,USD,0.07,2023-07-01T12:00:00Z,cryptocompare\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Import stopped after 1 rates")
+	assert.Contains(t, w.Body.String(), "The 0 snapshots stored before are kept")
+	assert.Equal(t, http.StatusBadRequest, serveAdminExchangeRates(http.MethodPost, "/admin/exchange-rates?format=parquet", "PAR1").Code)
+	assert.Equal(t, http.StatusBadRequest, serveAdminExchangeRates(http.MethodGet, "/admin/exchange-rates?format=json", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serveAdminExchangeRates(http.MethodGet, "/admin/exchange-rates?to=tomorrow", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serveAdminExchangeRates(http.MethodDelete, "/admin/exchange-rates", "").Code)
+
+	previousSize := maxImportSize
+	maxImportSize = 64
+	t.Cleanup(func() { maxImportSize = previousSize })
+	w = serveAdminExchangeRates(http.MethodPost, "/admin/exchange-rates",
+		"crypto,fiat,rate,timestamp,source\nBTC,USD,30000.12345678,2023-07-01T13:00:00Z,kraken\n")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "larger than 64 bytes")
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/exchange-rates", nil)
+	w = httptest.NewRecorder()
+	handleAdminExchangeRates(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+const backfillUsage = "usage: backfill -from DATE [-to DATE] [-resolution hour|day] [-crypto BTC,ETH] [-fiat USD,INR]"
+
+// backfillHistoryURL is the history API the backfill subcommand calls, which
+// the tests replace.
+var backfillHistoryURL = ratestore.DefaultHistoryURL
+
+// runBackfill runs the backfill subcommand, which fills the hourly or daily
+// rollups of the given pairs, every active pair by default, from the history
+// of the price API. Running it again with the same -from resumes it.
+func runBackfill(db *ratestore.Database, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	from := fs.String("from", "", "first day (2006-01-02) or time (RFC 3339) to backfill")
+	to := fs.String("to", "", "day or time to backfill up to, now by default")
+	resolution := fs.String("resolution", ratestore.ResolutionHour, "hour or day")
+	cryptos := fs.String("crypto", "", "comma-separated cryptocurrencies, every active one by default")
+	fiats := fs.String("fiat", "", "comma-separated fiat currencies, every active one by default")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *from == "" {
+		return errors.New(backfillUsage)
+	}
+
+	request := ratestore.BackfillRequest{
+		Cryptos:    splitSymbols(*cryptos),
+		Fiats:      splitSymbols(*fiats),
+		To:         time.Now(),
+		Resolution: *resolution,
+	}
+	var err error
+	if request.From, err = parseDayOrTime(*from); err != nil {
+		return err
+	}
+	if *to != "" {
+		if request.To, err = parseDayOrTime(*to); err != nil {
+			return err
+		}
+	}
+
+	backfiller := &ratestore.Backfiller{DB: db, Client: &http.Client{Timeout: time.Minute}, HistoryURL: backfillHistoryURL}
+	result, err := backfiller.Backfill(context.Background(), request)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "backfilled %d pairs (%d resumed): %d buckets in %d pages, recomputed %d daily buckets\n",
+		result.Pairs, result.Resumed, result.Buckets, result.Pages, result.DailyBuckets)
+	return nil
+}
+
+// parseDayOrTime parses a day such as 2023-07-01 or an RFC 3339 time.
+func parseDayOrTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected a day such as 2023-07-01 or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// splitSymbols splits a comma-separated list of currency symbols.
+func splitSymbols(list string) []string {
+	var symbols []string
+	for _, symbol := range strings.Split(list, ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+func TestRunBackfill(t *testing.T) {
+	db := newSeedDatabase(t)
+	_, err := db.SeedCurrencies([]ratestore.Currency{
+		{Symbol: "BTC", Name: "Bitcoin", Type: ratestore.CurrencyTypeCrypto},
+		{Symbol: "USD", Name: "US Dollar", Type: ratestore.CurrencyTypeFiat},
+	}, false)
+	require.NoError(t, err)
+
+	day := time.Now().UTC().Truncate(24 * time.Hour).Add(-2 * 24 * time.Hour)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/histoday", r.URL.Path)
+		w.Write([]byte(`{"Response": "Success", "Data": {"Data": [{"time": ` + strconv.FormatInt(day.Unix(), 10) +
+			`, "open": 30000, "high": 31000, "low": 29000, "close": 30500}]}}`))
+	}))
+	defer server.Close()
+	previous := backfillHistoryURL
+	backfillHistoryURL = server.URL
+	t.Cleanup(func() { backfillHistoryURL = previous })
+
+	var out bytes.Buffer
+	args := []string{"-from", day.Format("2006-01-02"), "-to", day.Add(24 * time.Hour).Format(time.RFC3339), "-resolution", "day", "-crypto", "btc"}
+	require.NoError(t, runBackfill(db, args, &out))
+	assert.Equal(t, "backfilled 1 pairs (0 resumed): 1 buckets in 1 pages, recomputed 0 daily buckets\n", out.String())
+
+	assert.Error(t, runBackfill(db, nil, &out))
+	assert.Error(t, runBackfill(db, []string{"-from", "yesterday"}, &out))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// cachedStore returns db reading its latest rates and currencies through the
+// cache of cfg, or db itself when the cache is disabled. The cache is
+// invalidated by every snapshot the service ingests or imports and every
+// change it makes to the currencies, and its entries expire when the next
+// ingestion is expected, so that the snapshots ingested by another process
+// are served in time.
+func cachedStore(db *ratestore.Database, cfg Config) (ratestore.RateStore, error) {
+	cache, err := ratestore.NewCache(cfg.Cache)
+	if err != nil || cache == nil {
+		return db, err
+	}
+
+	ttl := cfg.Cache.TTL
+	if ttl == 0 {
+		ttl = cfg.Ingestion.Interval
+	}
+	cached := ratestore.NewCachedStore(db, cache, ttl)
+	db.OnChange(func() {
+		if err := cached.Invalidate(); err != nil {
+			log.Println("Error invalidating the rate cache:", err)
+		}
+	})
+
+	redis, ok := cache.(*ratestore.RedisCache)
+	if !ok {
+		log.Println("Caching the latest rates in memory")
+		return cached, nil
+	}
+	log.Printf("Caching the latest rates in Redis at %s", cfg.Cache.Address)
+	if err := redis.Ping(); err != nil {
+		log.Println("Rate cache unavailable, reading the rates from the database until it answers:", err)
+	}
+	return cached, nil
+}
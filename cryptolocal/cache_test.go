@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+func TestCachedStore(t *testing.T) {
+	db := newArchiveDatabase(t)
+	cryptoIDs, err := db.GetCryptoMappings()
+	require.NoError(t, err)
+	fiatIDs, err := db.GetFiatMappings()
+	require.NoError(t, err)
+	insertRate := func(rate string, timestamp time.Time) {
+		_, err := db.InsertExchangeRates([]ratestore.ExchangeRate{
+			{CryptoID: cryptoIDs["BTC"], FiatID: fiatIDs["USD"], Rate: decimal.RequireFromString(rate), Timestamp: timestamp},
+		})
+		require.NoError(t, err)
+	}
+
+	uncached, err := cachedStore(db, Config{Cache: ratestore.CacheConfig{Driver: ratestore.CacheDriverNone}})
+	require.NoError(t, err)
+	assert.Same(t, db, uncached)
+
+	cached, err := cachedStore(db, Config{Ingestion: IngestionConfig{Interval: 5 * time.Minute}})
+	require.NoError(t, err)
+	assert.IsType(t, &ratestore.CachedStore{}, cached)
+
+	now := time.Now().UTC().Truncate(ratestore.DefaultRateBucket)
+	insertRate("30000", now.Add(-ratestore.DefaultRateBucket))
+	rate, _, err := cached.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "30000", rate.String())
+
+	insertRate("31000", now)
+	rate, _, err = cached.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "31000", rate.String(), "an ingested snapshot invalidates the cache")
+}
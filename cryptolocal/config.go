@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the cryptolocal service.
+type Config struct {
+	// Addr is the address the HTTP server listens on.
+	Addr string `yaml:"addr"`
+	// Fixture, when set, serves the rates from an in-memory store seeded
+	// from this JSON fixture instead of the database.
+	Fixture   string                `yaml:"fixture"`
+	Database  ratestore.Config      `yaml:"database"`
+	Cache     ratestore.CacheConfig `yaml:"cache"`
+	Ingestion IngestionConfig       `yaml:"ingestion"`
+	Admin     AdminConfig           `yaml:"admin"`
+}
+
+// AdminConfig configures the admin endpoints.
+type AdminConfig struct {
+	// Token is the bearer token the admin endpoints require. They are
+	// disabled when it is empty.
+	Token string `yaml:"token"`
+}
+
+// IngestionConfig configures the in-process ingestion of fresh rates.
+type IngestionConfig struct {
+	// Interval is the time between two runs. Ingestion is disabled when it
+	// is zero.
+	Interval time.Duration `yaml:"interval"`
+	// Jitter is the maximum random delay added to every interval.
+	Jitter time.Duration `yaml:"jitter"`
+}
+
+// defaultConfig returns the settings used when nothing overrides them.
+func defaultConfig() Config {
+	return Config{
+		Addr: ":8080",
+		Database: ratestore.Config{
+			Driver: ratestore.DriverMySQL,
+		},
+	}
+}
+
+// LoadConfig builds the configuration from, in increasing order of
+// precedence, the defaults, the YAML file named by -config or
+// CRYPTOLOCAL_CONFIG, the environment and the command-line flags in args. It
+// returns the arguments left after the flags, which name a subcommand.
+func LoadConfig(args []string, stderr io.Writer) (Config, []string, error) {
+	fs := flag.NewFlagSet("cryptolocal", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var flags Config
+	configFile := fs.String("config", os.Getenv("CRYPTOLOCAL_CONFIG"), "path of the YAML configuration file")
+	fs.StringVar(&flags.Addr, "addr", "", "address the HTTP server listens on (default \":8080\")")
+	fs.StringVar(&flags.Fixture, "fixture", "", "serve from an in-memory store seeded from this JSON fixture instead of the database")
+	fs.StringVar(&flags.Database.Driver, "db-driver", "", "database driver: mysql, sqlite or postgres")
+	fs.StringVar(&flags.Database.Host, "db-host", "", "database host and port")
+	fs.StringVar(&flags.Database.User, "db-user", "", "database user")
+	fs.StringVar(&flags.Database.Database, "db-database", "", "database name, or file path for SQLite")
+	fs.StringVar(&flags.Database.SSLMode, "db-sslmode", "", "PostgreSQL sslmode")
+	fs.IntVar(&flags.Database.MaxOpenConns, "db-max-open-conns", 0, "maximum number of open database connections")
+	fs.IntVar(&flags.Database.MaxIdleConns, "db-max-idle-conns", 0, "maximum number of idle database connections")
+	fs.DurationVar(&flags.Database.ConnMaxLifetime, "db-conn-max-lifetime", 0, "maximum time a database connection is reused")
+	fs.DurationVar(&flags.Database.RawRetention, "db-raw-retention", 0, "delete raw rates older than this once rolled up; 0 keeps them")
+	fs.IntVar(&flags.Database.InsertChunkSize, "db-insert-chunk-size", 0, "rows written by each INSERT of an ingestion batch (default 100)")
+	fs.DurationVar(&flags.Database.RateBucket, "db-rate-bucket", 0, "keep one raw rate per pair and source in every bucket of this length (default 10m)")
+	fs.BoolVar(&flags.Database.PartitionRates, "db-partition-rates", false, "store the raw rates of every month in a table of its own")
+	replicas := fs.String("db-replicas", "", "comma-separated hosts, or file paths for SQLite, of read replicas serving the rates")
+	fs.DurationVar(&flags.Database.MaxReplicaLag, "db-max-replica-lag", 0, "read from the primary while every replica lags more than this (default 30s)")
+	fs.StringVar(&flags.Cache.Driver, "cache-driver", "", "cache of the latest rates: memory, redis or none (default memory)")
+	fs.StringVar(&flags.Cache.Address, "cache-address", "", "Redis host and port")
+	fs.IntVar(&flags.Cache.Size, "cache-size", 0, "maximum number of entries of the memory cache (default 1000)")
+	fs.DurationVar(&flags.Cache.TTL, "cache-ttl", 0, "cache the latest rates for this long after their snapshot (default the ingestion interval, or 10m)")
+	fs.DurationVar(&flags.Ingestion.Interval, "ingest-interval", 0, "fetch fresh rates on this interval; 0 disables ingestion")
+	fs.DurationVar(&flags.Ingestion.Jitter, "ingest-jitter", 0, "maximum random delay added to every ingestion interval")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := defaultConfig()
+
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return Config{}, nil, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	// Only the flags given on the command line override the settings.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = flags.Addr
+		case "fixture":
+			cfg.Fixture = flags.Fixture
+		case "db-driver":
+			cfg.Database.Driver = flags.Database.Driver
+		case "db-host":
+			cfg.Database.Host = flags.Database.Host
+		case "db-user":
+			cfg.Database.User = flags.Database.User
+		case "db-database":
+			cfg.Database.Database = flags.Database.Database
+		case "db-sslmode":
+			cfg.Database.SSLMode = flags.Database.SSLMode
+		case "db-max-open-conns":
+			cfg.Database.MaxOpenConns = flags.Database.MaxOpenConns
+		case "db-max-idle-conns":
+			cfg.Database.MaxIdleConns = flags.Database.MaxIdleConns
+		case "db-conn-max-lifetime":
+			cfg.Database.ConnMaxLifetime = flags.Database.ConnMaxLifetime
+		case "db-raw-retention":
+			cfg.Database.RawRetention = flags.Database.RawRetention
+		case "db-insert-chunk-size":
+			cfg.Database.InsertChunkSize = flags.Database.InsertChunkSize
+		case "db-rate-bucket":
+			cfg.Database.RateBucket = flags.Database.RateBucket
+		case "db-partition-rates":
+			cfg.Database.PartitionRates = flags.Database.PartitionRates
+		case "db-replicas":
+			cfg.Database.Replicas = strings.FieldsFunc(*replicas, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		case "db-max-replica-lag":
+			cfg.Database.MaxReplicaLag = flags.Database.MaxReplicaLag
+		case "cache-driver":
+			cfg.Cache.Driver = flags.Cache.Driver
+		case "cache-address":
+			cfg.Cache.Address = flags.Cache.Address
+		case "cache-size":
+			cfg.Cache.Size = flags.Cache.Size
+		case "cache-ttl":
+			cfg.Cache.TTL = flags.Cache.TTL
+		case "ingest-interval":
+			cfg.Ingestion.Interval = flags.Ingestion.Interval
+		case "ingest-jitter":
+			cfg.Ingestion.Jitter = flags.Ingestion.Jitter
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// loadFile overrides cfg with the settings present in the YAML file at path.
+func (cfg *Config) loadFile(path string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading configuration file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing configuration file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides cfg with the environment variables that are set:
+// CRYPTOLOCAL_ADDR, CRYPTOLOCAL_FIXTURE, CRYPTOLOCAL_INGEST_INTERVAL,
+// CRYPTOLOCAL_INGEST_JITTER, CRYPTOLOCAL_ADMIN_TOKEN and the DB_* and CACHE_*
+// variables shared with the Netlify functions.
+func (cfg *Config) loadEnv() error {
+	if value, ok := os.LookupEnv("CRYPTOLOCAL_ADDR"); ok {
+		cfg.Addr = value
+	}
+	if value, ok := os.LookupEnv("CRYPTOLOCAL_FIXTURE"); ok {
+		cfg.Fixture = value
+	}
+	if err := envDuration("CRYPTOLOCAL_INGEST_INTERVAL", &cfg.Ingestion.Interval); err != nil {
+		return err
+	}
+	if err := envDuration("CRYPTOLOCAL_INGEST_JITTER", &cfg.Ingestion.Jitter); err != nil {
+		return err
+	}
+	if value, ok := os.LookupEnv("CRYPTOLOCAL_ADMIN_TOKEN"); ok {
+		cfg.Admin.Token = value
+	}
+	if err := cfg.Cache.LoadEnv(); err != nil {
+		return err
+	}
+	return cfg.Database.LoadEnv()
+}
+
+// envDuration sets *value from the environment variable name, if it is set.
+func envDuration(name string, value *time.Duration) error {
+	raw, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("%s: invalid value %q", name, raw)
+	}
+	*value = parsed
+	return nil
+}
+
+// Validate reports every missing or invalid setting of cfg. The database
+// settings are not checked when the service runs from a fixture.
+func (cfg Config) Validate() error {
+	var problems []string
+
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		problems = append(problems, fmt.Sprintf("addr %q is not a host:port address", cfg.Addr))
+	}
+
+	if cfg.Fixture == "" {
+		if err := cfg.Database.Validate(); err != nil {
+			problems = append(problems, "database: "+err.Error())
+		}
+	}
+
+	if err := cfg.Cache.Validate(); err != nil {
+		problems = append(problems, "cache: "+err.Error())
+	}
+
+	if cfg.Ingestion.Interval < 0 {
+		problems = append(problems, "ingestion: interval must not be negative")
+	}
+	if cfg.Ingestion.Jitter < 0 {
+		problems = append(problems, "ingestion: jitter must not be negative")
+	}
+	if cfg.Ingestion.Interval > 0 && cfg.Fixture != "" {
+		problems = append(problems, "ingestion: needs the database and cannot run with a fixture")
+	}
+
+	if cfg.Admin.Token != "" && len(cfg.Admin.Token) < ratestore.MinAdminTokenLength {
+		problems = append(problems, fmt.Sprintf("admin: token must be at least %d characters", ratestore.MinAdminTokenLength))
+	}
+	if cfg.Admin.Token != "" && cfg.Fixture != "" {
+		problems = append(problems, "admin: needs the database and cannot run with a fixture")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// clearConfigEnv unsets the environment variables LoadConfig reads for the
+// duration of the test.
+func clearConfigEnv(t *testing.T) {
+	for _, name := range []string{
+		"CRYPTOLOCAL_CONFIG", "CRYPTOLOCAL_ADDR", "CRYPTOLOCAL_FIXTURE",
+		"CRYPTOLOCAL_INGEST_INTERVAL", "CRYPTOLOCAL_INGEST_JITTER", "CRYPTOLOCAL_ADMIN_TOKEN",
+		"DB_DRIVER", "DB_USER", "DB_PASSWORD", "DB_HOST", "DB_DATABASE", "DB_SSLMODE",
+		"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_RAW_RETENTION", "DB_INSERT_CHUNK_SIZE",
+		"DB_RATE_BUCKET", "DB_PARTITION_RATES", "DB_REPLICAS", "DB_MAX_REPLICA_LAG",
+		"CACHE_DRIVER", "CACHE_SIZE", "CACHE_TTL", "CACHE_ADDRESS", "CACHE_PASSWORD", "CACHE_REDIS_DB", "CACHE_TIMEOUT",
+	} {
+		value, ok := os.LookupEnv(name)
+		os.Unsetenv(name)
+		if ok {
+			t.Cleanup(func() { os.Setenv(name, value) })
+		}
+	}
+}
+
+func writeConfigFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "cryptolocal.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+addr: ":9000"
+database:
+  host: file-host:3306
+  user: file-user
+  password: secret
+  database: crypto
+  max_open_conns: 20
+  conn_max_lifetime: 1m
+`)
+	t.Setenv("DB_USER", "env-user")
+	t.Setenv("DB_HOST", "env-host:3306")
+
+	cfg, args, err := LoadConfig([]string{"-config", path, "-db-host", "flag-host:3306", "-db-insert-chunk-size", "250", "migrate", "up"}, io.Discard)
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9000", cfg.Addr)
+	assert.Equal(t, ratestore.Config{
+		Driver:          ratestore.DriverMySQL,
+		Host:            "flag-host:3306",
+		User:            "env-user",
+		Password:        "secret",
+		Database:        "crypto",
+		MaxOpenConns:    20,
+		ConnMaxLifetime: time.Minute,
+		InsertChunkSize: 250,
+	}, cfg.Database)
+	assert.Equal(t, []string{"migrate", "up"}, args)
+}
+
+func TestLoadConfigReplicas(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+database:
+  driver: sqlite
+  database: rates.db
+  replicas: [replica.db]
+  max_replica_lag: 1m
+  partition_rates: true
+`)
+
+	cfg, _, err := LoadConfig([]string{"-config", path}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"replica.db"}, cfg.Database.Replicas)
+	assert.Equal(t, time.Minute, cfg.Database.MaxReplicaLag)
+	assert.True(t, cfg.Database.PartitionRates)
+
+	cfg, _, err = LoadConfig([]string{"-config", path, "-db-replicas", "a.db, b.db", "-db-max-replica-lag", "10s", "-db-partition-rates=false"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.db", "b.db"}, cfg.Database.Replicas)
+	assert.Equal(t, 10*time.Second, cfg.Database.MaxReplicaLag)
+	assert.False(t, cfg.Database.PartitionRates)
+}
+
+func TestLoadConfigCache(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+database:
+  driver: sqlite
+  database: rates.db
+cache:
+  driver: redis
+  address: cache:6379
+  ttl: 5m
+`)
+	t.Setenv("CACHE_PASSWORD", "secret")
+
+	cfg, _, err := LoadConfig([]string{"-config", path}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, ratestore.CacheConfig{Driver: ratestore.CacheDriverRedis, Address: "cache:6379", Password: "secret", TTL: 5 * time.Minute}, cfg.Cache)
+
+	cfg, _, err = LoadConfig([]string{"-config", path, "-cache-driver", "memory", "-cache-size", "50", "-cache-ttl", "1m"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, ratestore.CacheDriverMemory, cfg.Cache.Driver)
+	assert.Equal(t, 50, cfg.Cache.Size)
+	assert.Equal(t, time.Minute, cfg.Cache.TTL)
+
+	_, _, err = LoadConfig([]string{"-config", path, "-cache-address", ""}, io.Discard)
+	assert.EqualError(t, err, "invalid configuration: cache: address is required")
+}
+
+func TestLoadConfigFixtureNeedsNoDatabase(t *testing.T) {
+	clearConfigEnv(t)
+
+	cfg, _, err := LoadConfig([]string{"-fixture", "testdata/rates.json"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Addr)
+	assert.Equal(t, "testdata/rates.json", cfg.Fixture)
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	clearConfigEnv(t)
+
+	_, _, err := LoadConfig([]string{"-addr", "8080"}, io.Discard)
+	assert.EqualError(t, err, `invalid configuration: addr "8080" is not a host:port address; `+
+		`database: host is required; user is required; database name is required`)
+
+	_, _, err = LoadConfig([]string{"-db-driver", "sqlite"}, io.Discard)
+	assert.EqualError(t, err, "invalid configuration: database: database file path is required")
+}
+
+func TestLoadConfigInvalidSources(t *testing.T) {
+	clearConfigEnv(t)
+
+	_, _, err := LoadConfig([]string{"-config", writeConfigFile(t, "database:\n  hots: localhost\n")}, io.Discard)
+	assert.ErrorContains(t, err, "field hots not found")
+
+	_, _, err = LoadConfig([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, io.Discard)
+	assert.ErrorContains(t, err, "reading configuration file")
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "lots")
+	_, _, err = LoadConfig(nil, io.Discard)
+	assert.EqualError(t, err, `invalid environment: DB_MAX_OPEN_CONNS: invalid value "lots"`)
+}
+
+func TestLoadConfigIngestion(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+database:
+  driver: sqlite
+  database: rates.db
+ingestion:
+  interval: 10m
+  jitter: 30s
+`)
+	t.Setenv("CRYPTOLOCAL_INGEST_JITTER", "1m")
+
+	cfg, _, err := LoadConfig([]string{"-config", path, "-ingest-interval", "5m"}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, IngestionConfig{Interval: 5 * time.Minute, Jitter: time.Minute}, cfg.Ingestion)
+
+	_, _, err = LoadConfig([]string{"-fixture", "testdata/rates.json", "-ingest-interval", "-1m"}, io.Discard)
+	assert.EqualError(t, err, "invalid configuration: ingestion: interval must not be negative")
+
+	_, _, err = LoadConfig([]string{"-fixture", "testdata/rates.json", "-ingest-interval", "1m"}, io.Discard)
+	assert.EqualError(t, err, "invalid configuration: ingestion: needs the database and cannot run with a fixture")
+
+	t.Setenv("CRYPTOLOCAL_INGEST_INTERVAL", "often")
+	_, _, err = LoadConfig([]string{"-config", path}, io.Discard)
+	assert.EqualError(t, err, `invalid environment: CRYPTOLOCAL_INGEST_INTERVAL: invalid value "often"`)
+}
+
+func TestLoadConfigAdmin(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, `
+database:
+  driver: sqlite
+  database: rates.db
+admin:
+  token: file-token-0123456789
+`)
+
+	cfg, _, err := LoadConfig([]string{"-config", path}, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "file-token-0123456789", cfg.Admin.Token)
+
+	t.Setenv("CRYPTOLOCAL_ADMIN_TOKEN", "short")
+	_, _, err = LoadConfig([]string{"-config", path}, io.Discard)
+	assert.EqualError(t, err, "invalid configuration: admin: token must be at least 16 characters")
+
+	t.Setenv("CRYPTOLOCAL_ADMIN_TOKEN", "env-token-0123456789")
+	_, _, err = LoadConfig([]string{"-fixture", "testdata/rates.json"}, io.Discard)
+	assert.EqualError(t, err, "invalid configuration: admin: needs the database and cannot run with a fixture")
+}
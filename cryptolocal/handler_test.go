@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// useMemoryStore serves the handlers from an in-memory store for the duration
+// of the test.
+func useMemoryStore(t *testing.T) *ratestore.MemoryStore {
+	memoryStore := ratestore.NewMemoryStore()
+	memoryStore.AddCryptoCurrency("BTC")
+	memoryStore.AddCryptoCurrency("ETH")
+	memoryStore.AddFiatCurrency("USD")
+	memoryStore.AddFiatCurrency("INR")
+
+	previous := store
+	store = memoryStore
+	t.Cleanup(func() { store = previous })
+
+	return memoryStore
+}
+
+func serve(path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	HandleRequest(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestHandleGetExchangeRate(t *testing.T) {
+	store := useMemoryStore(t)
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("25.2"), now.Add(-time.Hour)))
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("30.5"), now))
+
+	w := serve("/rates/BTC/USD")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"crypto": "BTC", "fiat": "USD", "value": "30.5", "snapshot_id": 2, "snapshot_time": "2023-07-01T12:00:00Z", "source": "cryptocompare"}`, w.Body.String())
+	assert.Equal(t, "2", w.Header().Get("X-Snapshot-Id"))
+	assert.Equal(t, "2023-07-01T12:00:00Z", w.Header().Get("X-Snapshot-Time"))
+	assert.Equal(t, "cryptocompare", w.Header().Get("X-Rate-Source"))
+}
+
+func TestHandleGetExchangeRateSource(t *testing.T) {
+	store := useMemoryStore(t)
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("30.5"), time.Now()))
+
+	assert.Equal(t, http.StatusOK, serve("/rates/BTC/USD?source=CryptoCompare").Code)
+	assert.Equal(t, http.StatusNotFound, serve("/rates/BTC/USD?source=kraken").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/rates/BTC/USD?source=kraken%3B").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/rates?source=a+b").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/rates/history/BTC/USD?source=kraken").Code)
+
+	w := serve("/rates/sources/xbt/usd")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serve("/rates/sources/btc/usd")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response SourcesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "BTC", response.Crypto)
+	require.Len(t, response.Sources, 1)
+	assert.Equal(t, ratestore.DefaultSource, response.Sources[0].Source)
+	assert.Equal(t, "30.5", response.Sources[0].Value.String())
+
+	assert.Equal(t, http.StatusNotFound, serve("/rates/sources/ETH/INR").Code)
+}
+
+func TestHandleGetExchangeRateResolvesSymbols(t *testing.T) {
+	store := useMemoryStore(t)
+	store.AddAlias(ratestore.CurrencyTypeCrypto, "XBT", "BTC")
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("30.5"), time.Now()))
+
+	for _, path := range []string{"/rates/btc/usd", "/rates/XBT/USD", "/rates/xbt/Usd"} {
+		w := serve(path)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		var response CryptoResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "BTC", response.Crypto, path)
+		assert.Equal(t, "USD", response.Fiat, path)
+		assert.Equal(t, "BTC", w.Header().Get("X-Crypto-Symbol"), path)
+		assert.Equal(t, "USD", w.Header().Get("X-Fiat-Symbol"), path)
+	}
+
+	w := serve("/rates/xbt")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "BTC", w.Header().Get("X-Crypto-Symbol"))
+
+	var history HistoricalRateResponse
+	w = serve("/rates/history/xbt/usd")
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, "BTC", history.Crypto)
+	assert.Equal(t, "USD", history.Fiat)
+}
+
+func TestHandleGetExchangeRateUnknownCurrency(t *testing.T) {
+	useMemoryStore(t)
+
+	assert.Equal(t, http.StatusNotFound, serve("/rates/DOGE/USD").Code)
+	assert.Equal(t, http.StatusNotFound, serve("/rates/BTC/JPY").Code)
+}
+
+func TestHandleGetExchangeRateNotFound(t *testing.T) {
+	useMemoryStore(t)
+
+	w := serve("/rates/ETH/INR")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Exchange rates not found.", w.Body.String())
+}
+
+func TestHandleGetExchangeRatesForCrypto(t *testing.T) {
+	store := useMemoryStore(t)
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("25.2"), time.Now()))
+	require.NoError(t, store.AddExchangeRate("BTC", "INR", decimal.RequireFromString("30.5"), time.Now()))
+
+	w := serve("/rates/BTC")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"USD": "25.2", "INR": "30.5"}`, w.Body.String())
+	assert.Equal(t, "2", w.Header().Get("X-Snapshot-Id"))
+}
+
+func TestHandleGetAllExchangeRates(t *testing.T) {
+	store := useMemoryStore(t)
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("25.2"), time.Now()))
+	require.NoError(t, store.AddExchangeRate("ETH", "INR", decimal.RequireFromString("31.1"), time.Now()))
+
+	w := serve("/rates")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"BTC": {"USD": "25.2"}, "ETH": {"INR": "31.1"}}`, w.Body.String())
+	assert.Equal(t, "2", w.Header().Get("X-Snapshot-Id"))
+	assert.NotEmpty(t, w.Header().Get("X-Snapshot-Time"))
+}
+
+func TestHandleGetHistoricalExchangeRates(t *testing.T) {
+	store := useMemoryStore(t)
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("25.2"), time.Now().Add(-2*time.Hour)))
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("30.5"), time.Now().Add(-1*time.Hour)))
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("530.5"), time.Now().Add(-26*time.Hour)))
+
+	w := serve("/rates/history/BTC/USD")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response HistoricalRateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.ExchangeRate, 2)
+	assert.Equal(t, "25.2", response.ExchangeRate[0].Value.String())
+	assert.Equal(t, "30.5", response.ExchangeRate[1].Value.String())
+}
+
+func TestHandleGetHistoricalExchangeRatesPeriod(t *testing.T) {
+	store := useMemoryStore(t)
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("25.2"), time.Now().Add(-1*time.Hour)))
+	require.NoError(t, store.AddExchangeRate("BTC", "USD", decimal.RequireFromString("530.5"), time.Now().Add(-3*24*time.Hour)))
+
+	var response HistoricalRateResponse
+	w := serve("/rates/history/BTC/USD?period=7d")
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.ExchangeRate, 2)
+	assert.Equal(t, "530.5", response.ExchangeRate[0].Value.String())
+
+	w = serve("/rates/history/BTC/USD?period=week")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `invalid period "week"`)
+}
+
+func TestHandleGetCurrencies(t *testing.T) {
+	useMemoryStore(t)
+
+	w := serve("/currencies")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[
+		{"symbol": "BTC", "name": "", "type": "crypto", "decimals": 0, "active": true},
+		{"symbol": "ETH", "name": "", "type": "crypto", "decimals": 0, "active": true},
+		{"symbol": "INR", "name": "", "type": "fiat", "decimals": 0, "active": true},
+		{"symbol": "USD", "name": "", "type": "fiat", "decimals": 0, "active": true}
+	]`, w.Body.String())
+
+	w = serve("/currencies/fiat?include_inactive=true")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var currencies []ratestore.Currency
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &currencies))
+	require.Len(t, currencies, 2)
+	assert.Equal(t, "INR", currencies[0].Symbol)
+
+	assert.Equal(t, http.StatusNotFound, serve("/currencies/stablecoin").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/currencies?include_inactive=maybe").Code)
+}
+
+func TestHandleInvalidParameters(t *testing.T) {
+	useMemoryStore(t)
+
+	assert.Equal(t, http.StatusBadRequest, serve("/prices").Code)
+	assert.Equal(t, http.StatusBadRequest, serve("/rates/history/BTC/USD/extra").Code)
+}
+
+func TestFixtureLoads(t *testing.T) {
+	store, err := ratestore.LoadMemoryStore("testdata/rates.json")
+	require.NoError(t, err)
+
+	rates, _, err := store.GetAllExchangeRates("")
+	assert.NoError(t, err)
+	assert.Len(t, rates, 10)
+	assert.Len(t, rates["BTC"], 10)
+}
@@ -1,282 +1,211 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+	"github.com/sushant-iitp/hellogo/ratestore"
 )
 
-type Database struct {
-	DB *sql.DB
-}
-
 type CryptoResponse struct {
-	Value float64 `json:"value"`
+	Crypto string          `json:"crypto"`
+	Fiat   string          `json:"fiat"`
+	Value  decimal.Decimal `json:"value"`
+	ratestore.Snapshot
 }
 
-type CryptoResponseWithTimestamp struct {
-	Value     float64 `json:"value"`
-	Timestamp string  `json:"timestamp"`
-}
+type CryptoResponseWithTimestamp = ratestore.RateWithTimestamp
 
 type HistoricalRateResponse struct {
+	Crypto       string                        `json:"crypto"`
+	Fiat         string                        `json:"fiat"`
 	ExchangeRate []CryptoResponseWithTimestamp `json:"exchange_rate"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// SourcesResponse lists the latest rate of a pair from every price source.
+type SourcesResponse struct {
+	Crypto  string                 `json:"crypto"`
+	Fiat    string                 `json:"fiat"`
+	Sources []ratestore.SourceRate `json:"sources"`
 }
 
-func (d *Database) CheckCryptoCurrency(crypto string) (bool, error) {
-	var exists bool
-	err := d.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM Cryptocurrencies WHERE symbol = ?)", crypto).Scan(&exists)
-	if err != nil {
-		return false, err
-	}
-	return exists, nil
-}
-
-func (d *Database) CheckFiatCurrency(fiat string) (bool, error) {
-	var exists bool
-	err := d.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM FiatCurrencies WHERE symbol = ?)", fiat).Scan(&exists)
-	if err != nil {
-		return false, err
-	}
-	return exists, nil
+type ErrorResponse struct {
+	Error string `json:"error"`
 }
 
-//Insert your DB credentials(User,Password,Host & database) here.
-func NewDatabase() (*Database, error) {
-	dbUser := ""
-	dbPassword := ""
-	dbHost := ""
-	dbDatabase := ""
-
-	connString := dbUser + ":" + dbPassword + "@tcp(" + dbHost + ")/" + dbDatabase + "?parseTime=true"
-	db, err := sql.Open("mysql", connString)
-	if err != nil {
-		return nil, err
-	}
+// store is the RateStore every request is served from. main opens it once at
+// startup so that all requests share its connection pool.
+var store ratestore.RateStore
 
-	err = db.Ping()
-	if err != nil {
-		return nil, err
-	}
-
-	return &Database{DB: db}, nil
-}
-
-func (d *Database) Close() error {
-	return d.DB.Close()
+func handleTooManyInvalidParameters(w http.ResponseWriter, r *http.Request) {
+	errorMessage := "Too many parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat}\n5. http://localhost:8080/rates/sources/{crypto}/{fiat} "
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(errorMessage))
 }
 
-func (d *Database) GetExchangeRate(crypto, fiat string) (float64, error) {
-	query := `
-		SELECT rate
-	    FROM ExchangeRates er
-	    JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-	    JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
-	    WHERE c.symbol = ? AND f.symbol = ?
-	    AND er.timestamp = (
-		SELECT MAX(timestamp)
-		FROM ExchangeRates
-		WHERE cryptocurrency_id = er.cryptocurrency_id
-		AND fiat_currency_id = er.fiat_currency_id)
-	`
-
-	row := d.DB.QueryRow(query, crypto, fiat)
-
-	var rate float64
-	err := row.Scan(&rate)
-	if err != nil {
-		return 0, err
-	}
+func handleInvalidParameters(w http.ResponseWriter, r *http.Request) {
+	errorMessage := "Invalid parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat}\n5. http://localhost:8080/rates/sources/{crypto}/{fiat} "
 
-	return rate, nil
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(errorMessage))
 }
 
-func (d *Database) GetExchangeRatesForCrypto(crypto string) (map[string]float64, error) {
-	query := `
-		SELECT f.symbol, er.rate
-		FROM ExchangeRates er
-		JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-		JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
-		WHERE c.symbol = ?
-		AND er.timestamp = (
-		SELECT MAX(timestamp)
-		FROM ExchangeRates
-		WHERE cryptocurrency_id = er.cryptocurrency_id
-	)
-	`
-
-	rows, err := d.DB.Query(query, crypto)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	rates := make(map[string]float64)
-	for rows.Next() {
-		var fiat string
-		var rate float64
-		if err := rows.Scan(&fiat, &rate); err != nil {
-			return nil, err
-		}
-		rates[fiat] = rate
-	}
+func handleInvalidCryptoCurrency(w http.ResponseWriter, r *http.Request) {
+	errorMessage := "Crypto currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat}\n5. http://localhost:8080/rates/sources/{crypto}/{fiat} \n\nSupported cryptocurrencies: http://localhost:8080/currencies/crypto"
 
-	return rates, nil
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(errorMessage))
 }
 
-func (d *Database) GetAllExchangeRates() (map[string]map[string]float64, error) {
-	query := `
-	SELECT c.symbol, f.symbol, er.rate
-	FROM (
-		SELECT cryptocurrency_id, fiat_currency_id, MAX(timestamp) AS max_timestamp
-		FROM ExchangeRates
-		GROUP BY cryptocurrency_id, fiat_currency_id
-	) AS latest
-	JOIN ExchangeRates er ON er.cryptocurrency_id = latest.cryptocurrency_id
-		AND er.fiat_currency_id = latest.fiat_currency_id
-		AND er.timestamp = latest.max_timestamp
-	JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-	JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id;
-	`
-
-	rows, err := d.DB.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	rates := make(map[string]map[string]float64)
-	for rows.Next() {
-		var crypto, fiat string
-		var rate float64
-		if err := rows.Scan(&crypto, &fiat, &rate); err != nil {
-			return nil, err
-		}
-
-		if rates[crypto] == nil {
-			rates[crypto] = make(map[string]float64)
-		}
-		rates[crypto][fiat] = rate
-	}
+func handleInvalidFiatCurrency(w http.ResponseWriter, r *http.Request) {
+	errorMessage := "Fiat currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat}\n5. http://localhost:8080/rates/sources/{crypto}/{fiat} \n\nSupported fiat currencies: http://localhost:8080/currencies/fiat"
 
-	return rates, nil
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(errorMessage))
 }
 
-func (d *Database) GetHistoricalExchangeRates(crypto, fiat string) ([]CryptoResponseWithTimestamp, error) {
-	query := `
-		SELECT er.rate, er.timestamp
-		FROM ExchangeRates er
-		JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-		JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
-		WHERE c.symbol = ? AND f.symbol = ? AND er.timestamp >= NOW() - INTERVAL 24 HOUR
-	`
-
-	rows, err := d.DB.Query(query, crypto, fiat)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	rates := make([]CryptoResponseWithTimestamp, 0)
-	for rows.Next() {
-		var rate float64
-		var timestamp string
-		if err := rows.Scan(&rate, &timestamp); err != nil {
-			return nil, err
-		}
-		response := CryptoResponseWithTimestamp{
-			Value:     rate,
-			Timestamp: timestamp,
-		}
-		rates = append(rates, response)
-	}
-
-	return rates, nil
-}
+func handleDisabledCurrency(w http.ResponseWriter, r *http.Request, symbol string) {
+	errorMessage := "Currency " + symbol + " is disabled and no longer served. \n\nSupported currencies: http://localhost:8080/currencies"
 
-func handleTooManyInvalidParameters(w http.ResponseWriter, r *http.Request) {
-	errorMessage := "Too many parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat} "
-	w.WriteHeader(http.StatusBadRequest)
 	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
 	w.Write([]byte(errorMessage))
 }
 
-func handleInvalidParameters(w http.ResponseWriter, r *http.Request) {
-	errorMessage := "Invalid parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat} "
+func handleInvalidCurrencyType(w http.ResponseWriter, r *http.Request) {
+	errorMessage := "Unknown currency type. \nValid URL formats:\n1. http://localhost:8080/currencies\n2. http://localhost:8080/currencies/crypto\n3. http://localhost:8080/currencies/fiat "
 
-	w.WriteHeader(http.StatusBadRequest)
 	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
 	w.Write([]byte(errorMessage))
 }
 
-func handleInvalidCryptoCurrency(w http.ResponseWriter, r *http.Request) {
-	errorMessage := "Crypto currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat} "
+func handleInvalidPeriod(w http.ResponseWriter, r *http.Request, err error) {
+	errorMessage := "Invalid history period: " + err.Error() + ". \nUse a number of days such as 7d or a duration such as 36h."
 
-	w.WriteHeader(http.StatusNotFound)
 	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusBadRequest)
 	w.Write([]byte(errorMessage))
 }
 
-func handleInvalidFiatCurrency(w http.ResponseWriter, r *http.Request) {
-	errorMessage := "Fiat currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. http://localhost:8080/rates\n2. http://localhost:8080/rates/{crypto}\n3. http://localhost:8080/rates/{crypto}/{fiat}\n4. http://localhost:8080/rates/history/{crypto}/{fiat} "
+func handleInvalidSource(w http.ResponseWriter, r *http.Request, err error) {
+	errorMessage := err.Error() + ". \nA source is a price provider such as " + ratestore.DefaultSource + ", the default. Compare the sources of a pair at http://localhost:8080/rates/sources/{crypto}/{fiat}"
 
-	w.WriteHeader(http.StatusNotFound)
 	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusBadRequest)
 	w.Write([]byte(errorMessage))
 }
 
 func handleExchangeRateNotFound(w http.ResponseWriter, r *http.Request) {
 	errorMessage := "Exchange rates not found."
 
-	w.WriteHeader(http.StatusNotFound)
 	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
 	w.Write([]byte(errorMessage))
 }
 
-func handleGetExchangeRate(w http.ResponseWriter, r *http.Request, splitPath []string) {
-	crypto := splitPath[2]
-	fiat := splitPath[3]
-
-	db, err := NewDatabase()
-	if err != nil {
-		log.Println("Error connecting to the database:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+// setSnapshotHeaders identifies the snapshot the rates of a response come from.
+func setSnapshotHeaders(w http.ResponseWriter, snapshot ratestore.Snapshot) {
+	if snapshot.ID == 0 {
 		return
 	}
-	defer db.Close()
-	cryptoExists, err := db.CheckCryptoCurrency(crypto)
+	w.Header().Set("X-Snapshot-Id", strconv.FormatInt(snapshot.ID, 10))
+	w.Header().Set("X-Snapshot-Time", snapshot.TakenAt.Format(time.RFC3339Nano))
+	w.Header().Set("X-Rate-Source", snapshot.Source)
+}
+
+// requestSource returns the price source requested with ?source=, or
+// ratestore.DefaultSource. It answers the request and returns false if the
+// source is invalid.
+func requestSource(w http.ResponseWriter, r *http.Request) (string, bool) {
+	source, err := ratestore.ParseSource(r.URL.Query().Get("source"))
 	if err != nil {
-		log.Println("Error checking if crypto currency exists:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		handleInvalidSource(w, r, err)
+		return "", false
 	}
-	if !cryptoExists {
-		handleInvalidCryptoCurrency(w, r)
-		return
+	return source, true
+}
+
+// setSymbolHeaders echoes the symbols a request was resolved to, which differ
+// from the requested ones for an alias or another case. fiat is empty when the
+// request names no fiat currency.
+func setSymbolHeaders(w http.ResponseWriter, crypto, fiat string) {
+	w.Header().Set("X-Crypto-Symbol", crypto)
+	if fiat != "" {
+		w.Header().Set("X-Fiat-Symbol", fiat)
 	}
-	fiatExists, err := db.CheckFiatCurrency(fiat)
-	if err != nil {
-		log.Println("Error checking if fiat currency exists:", err)
+}
+
+// resolveSymbol resolves the requested symbol or alias of a currency of
+// currencyType. It answers the request and returns false if the currency is
+// unknown or disabled, or cannot be resolved.
+func resolveSymbol(w http.ResponseWriter, r *http.Request, db ratestore.RateStore, currencyType, symbol string) (string, bool) {
+	resolve, handleUnknown := db.ResolveCryptoCurrency, handleInvalidCryptoCurrency
+	if currencyType == ratestore.CurrencyTypeFiat {
+		resolve, handleUnknown = db.ResolveFiatCurrency, handleInvalidFiatCurrency
+	}
+
+	resolved, err := resolve(symbol)
+	switch {
+	case err == nil:
+		return resolved, true
+	case errors.Is(err, ratestore.ErrUnknownCurrency):
+		handleUnknown(w, r)
+	case errors.Is(err, ratestore.ErrCurrencyDisabled):
+		handleDisabledCurrency(w, r, resolved)
+	default:
+		log.Printf("Error resolving %s currency: %v", currencyType, err)
 		w.WriteHeader(http.StatusInternalServerError)
+	}
+	return "", false
+}
+
+// resolvePair resolves the crypto and fiat currencies of a request like
+// resolveSymbol.
+func resolvePair(w http.ResponseWriter, r *http.Request, db ratestore.RateStore, crypto, fiat string) (string, string, bool) {
+	crypto, ok := resolveSymbol(w, r, db, ratestore.CurrencyTypeCrypto, crypto)
+	if !ok {
+		return "", "", false
+	}
+	fiat, ok = resolveSymbol(w, r, db, ratestore.CurrencyTypeFiat, fiat)
+	if !ok {
+		return "", "", false
+	}
+	return crypto, fiat, true
+}
+
+func handleGetExchangeRate(w http.ResponseWriter, r *http.Request, splitPath []string) {
+	crypto := splitPath[2]
+	fiat := splitPath[3]
+
+	source, ok := requestSource(w, r)
+	if !ok {
 		return
 	}
-	if !fiatExists {
-		handleInvalidFiatCurrency(w, r)
+
+	db := store
+	crypto, fiat, ok = resolvePair(w, r, db, crypto, fiat)
+	if !ok {
 		return
 	}
 
-	rate, err := db.GetExchangeRate(crypto, fiat)
+	rate, snapshot, err := db.GetExchangeRate(crypto, fiat, source)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			handleExchangeRateNotFound(w, r)
 			return
 		}
@@ -285,9 +214,11 @@ func handleGetExchangeRate(w http.ResponseWriter, r *http.Request, splitPath []s
 		return
 	}
 
-	response := CryptoResponse{Value: rate}
+	response := CryptoResponse{Crypto: crypto, Fiat: fiat, Value: rate, Snapshot: snapshot}
 	responseBody, _ := json.Marshal(response)
 
+	setSnapshotHeaders(w, snapshot)
+	setSymbolHeaders(w, crypto, fiat)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(responseBody)
@@ -296,27 +227,20 @@ func handleGetExchangeRate(w http.ResponseWriter, r *http.Request, splitPath []s
 func handleGetExchangeRatesForCrypto(w http.ResponseWriter, r *http.Request, splitPath []string) {
 	crypto := splitPath[2]
 
-	db, err := NewDatabase()
-	if err != nil {
-		log.Println("Error connecting to the database:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	source, ok := requestSource(w, r)
+	if !ok {
 		return
 	}
-	defer db.Close()
-	cryptoExists, err := db.CheckCryptoCurrency(crypto)
-	if err != nil {
-		log.Println("Error checking if crypto currency exists:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if !cryptoExists {
-		handleInvalidCryptoCurrency(w, r)
+
+	db := store
+	crypto, ok = resolveSymbol(w, r, db, ratestore.CurrencyTypeCrypto, crypto)
+	if !ok {
 		return
 	}
 
-	rates, err := db.GetExchangeRatesForCrypto(crypto)
+	rates, snapshot, err := db.GetExchangeRatesForCrypto(crypto, source)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			handleExchangeRateNotFound(w, r)
 			return
 		}
@@ -325,13 +249,15 @@ func handleGetExchangeRatesForCrypto(w http.ResponseWriter, r *http.Request, spl
 		return
 	}
 
-	response := make(map[string]float64)
+	response := make(map[string]decimal.Decimal)
 	for fiat, rate := range rates {
 		response[fiat] = rate
 	}
 
 	responseBody, _ := json.Marshal(response)
 
+	setSnapshotHeaders(w, snapshot)
+	setSymbolHeaders(w, crypto, "")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(responseBody)
@@ -341,65 +267,94 @@ func handleGetHistoricalExchangeRates(w http.ResponseWriter, r *http.Request, sp
 	crypto := splitPath[3]
 	fiat := splitPath[4]
 
-	db, err := NewDatabase()
-	if err != nil {
-		log.Println("Error connecting to the database:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	since := time.Now().Add(-ratestore.RawHistoryWindow)
+	if period := r.URL.Query().Get("period"); period != "" {
+		length, err := ratestore.ParsePeriod(period)
+		if err != nil {
+			handleInvalidPeriod(w, r, err)
+			return
+		}
+		since = time.Now().Add(-length)
+	}
+
+	source, ok := requestSource(w, r)
+	if !ok {
 		return
 	}
-	defer db.Close()
-	cryptoExists, err := db.CheckCryptoCurrency(crypto)
-	if err != nil {
-		log.Println("Error checking if crypto currency exists:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if source != ratestore.DefaultSource {
+		handleInvalidSource(w, r, errors.New("history is only kept for the "+ratestore.DefaultSource+" source"))
 		return
 	}
-	if !cryptoExists {
-		handleInvalidCryptoCurrency(w, r)
+
+	db := store
+	crypto, fiat, ok = resolvePair(w, r, db, crypto, fiat)
+	if !ok {
 		return
 	}
-	fiatExists, err := db.CheckFiatCurrency(fiat)
+
+	rates, err := db.GetRateHistory(crypto, fiat, since)
 	if err != nil {
-		log.Println("Error checking if fiat currency exists:", err)
+		if errors.Is(err, ratestore.ErrNotFound) {
+			handleExchangeRateNotFound(w, r)
+			return
+		}
+		log.Println("Error retrieving historical exchange rates:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if !fiatExists {
-		handleInvalidFiatCurrency(w, r)
+
+	response := HistoricalRateResponse{Crypto: crypto, Fiat: fiat, ExchangeRate: rates}
+	responseBody, _ := json.Marshal(response)
+
+	setSymbolHeaders(w, crypto, fiat)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
+
+// handleGetExchangeRateSources lists the latest rate of a pair from every
+// price source, so that the sources can be compared.
+func handleGetExchangeRateSources(w http.ResponseWriter, r *http.Request, splitPath []string) {
+	crypto := splitPath[3]
+	fiat := splitPath[4]
+
+	db := store
+	crypto, fiat, ok := resolvePair(w, r, db, crypto, fiat)
+	if !ok {
 		return
 	}
 
-	rates, err := db.GetHistoricalExchangeRates(crypto, fiat)
+	sources, err := db.GetExchangeRateSources(crypto, fiat)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			handleExchangeRateNotFound(w, r)
 			return
 		}
-		log.Println("Error retrieving historical exchange rates:", err)
+		log.Println("Error retrieving exchange rate sources:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	response := HistoricalRateResponse{ExchangeRate: rates}
+	response := SourcesResponse{Crypto: crypto, Fiat: fiat, Sources: sources}
 	responseBody, _ := json.Marshal(response)
 
+	setSymbolHeaders(w, crypto, fiat)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(responseBody)
 }
 
 func handleGetAllExchangeRates(w http.ResponseWriter, r *http.Request) {
-	db, err := NewDatabase()
-	if err != nil {
-		log.Println("Error connecting to the database:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	source, ok := requestSource(w, r)
+	if !ok {
 		return
 	}
-	defer db.Close()
 
-	rates, err := db.GetAllExchangeRates()
+	db := store
+
+	rates, snapshot, err := db.GetAllExchangeRates(source)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			handleExchangeRateNotFound(w, r)
 			return
 		}
@@ -410,6 +365,35 @@ func handleGetAllExchangeRates(w http.ResponseWriter, r *http.Request) {
 
 	responseBody, _ := json.Marshal(rates)
 
+	setSnapshotHeaders(w, snapshot)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
+
+// handleGetCurrencies lists the supported currencies, of one type if
+// currencyType is not empty. Disabled currencies are added with
+// ?include_inactive=true.
+func handleGetCurrencies(w http.ResponseWriter, r *http.Request, currencyType string) {
+	includeInactive := false
+	if value := r.URL.Query().Get("include_inactive"); value != "" {
+		var err error
+		includeInactive, err = strconv.ParseBool(value)
+		if err != nil {
+			handleInvalidParameters(w, r)
+			return
+		}
+	}
+
+	currencies, err := store.ListCurrencies(currencyType, includeInactive)
+	if err != nil {
+		log.Println("Error listing currencies:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	responseBody, _ := json.Marshal(currencies)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(responseBody)
@@ -427,8 +411,18 @@ func HandleRequest(w http.ResponseWriter, r *http.Request) {
 		handleGetExchangeRatesForCrypto(w, r, splitPath)
 	} else if numParams == 5 && splitPath[2] == "history" && splitPath[3] != "" && splitPath[4] != "" && splitPath[1] == "rates" {
 		handleGetHistoricalExchangeRates(w, r, splitPath)
+	} else if numParams == 5 && splitPath[2] == "sources" && splitPath[3] != "" && splitPath[4] != "" && splitPath[1] == "rates" {
+		handleGetExchangeRateSources(w, r, splitPath)
 	} else if numParams == 2 && splitPath[1] == "rates" {
 		handleGetAllExchangeRates(w, r)
+	} else if numParams == 2 && splitPath[1] == "currencies" {
+		handleGetCurrencies(w, r, "")
+	} else if numParams == 3 && splitPath[1] == "currencies" {
+		if splitPath[2] != ratestore.CurrencyTypeCrypto && splitPath[2] != ratestore.CurrencyTypeFiat {
+			handleInvalidCurrencyType(w, r)
+			return
+		}
+		handleGetCurrencies(w, r, splitPath[2])
 	} else {
 		handleInvalidParameters(w, r)
 	}
@@ -436,12 +430,81 @@ func HandleRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	http.HandleFunc("/", HandleRequest)
+	cfg, args, err := LoadConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 {
+		commands := map[string]func(*ratestore.Database, []string, io.Writer) error{
+			"migrate":    runMigrate,
+			"seed":       runSeed,
+			"rollup":     runRollup,
+			"backfill":   runBackfill,
+			"export":     runExport,
+			"import":     runImport,
+			"partitions": runPartitions,
+		}
+		command, ok := commands[args[0]]
+		if !ok {
+			log.Fatalf("unknown command %q, expected migrate, seed, rollup, backfill, export, import or partitions", args[0])
+		}
+		if err := cfg.Database.Validate(); err != nil {
+			log.Fatal("invalid configuration: database: ", err)
+		}
+		db, err := ratestore.NewDatabase(cfg.Database)
+		if err != nil {
+			log.Fatal("Error connecting to the database: ", err)
+		}
+		defer db.Close()
+		if err := command(db, args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// Set the server port
-	port := ":8080"
+	if cfg.Fixture != "" {
+		memoryStore, err := ratestore.LoadMemoryStore(cfg.Fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = memoryStore
+		log.Printf("Serving from in-memory fixture %s", cfg.Fixture)
+	} else {
+		db, err := ratestore.NewDatabase(cfg.Database)
+		if err != nil {
+			log.Fatal("Database health check failed: ", err)
+		}
+		defer db.Close()
+		if store, err = cachedStore(db, cfg); err != nil {
+			log.Fatal("invalid configuration: cache: ", err)
+		}
+		runLedger = db
+		adminDB, adminToken = db, cfg.Admin.Token
+		log.Printf("Connected to the %s database (max %d open connections)", cfg.Database.Driver, db.DB.Stats().MaxOpenConnections)
+		if len(cfg.Database.Replicas) > 0 {
+			log.Printf("Serving reads from the replicas %s", strings.Join(cfg.Database.Replicas, ", "))
+		}
+
+		if cfg.Ingestion.Interval > 0 {
+			ingester := &ratestore.Ingester{DB: db, Client: &http.Client{Timeout: time.Minute}}
+			scheduler = NewScheduler(ingester.Ingest, cfg.Ingestion.Interval, cfg.Ingestion.Jitter)
+			scheduler.Start(context.Background())
+			log.Printf("Ingesting rates every %s (jitter up to %s)", cfg.Ingestion.Interval, cfg.Ingestion.Jitter)
+		}
+	}
+
+	http.HandleFunc("/", HandleRequest)
+	http.HandleFunc("/ingestion/status", handleIngestionStatus)
+	http.HandleFunc("/ingestion/runs", handleIngestionRuns)
+	http.HandleFunc("/admin/currencies", handleAdminCurrencies)
+	http.HandleFunc("/admin/currencies/", handleAdminCurrencies)
+	http.HandleFunc("/admin/exchange-rates", handleAdminExchangeRates)
 
 	// Start the server
-	log.Printf("Server listening on port %s", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	log.Printf("Server listening on %s", cfg.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Addr, nil))
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate runs the migrate subcommand: "up" applies every pending
+// migration, "down" reverts the latest one (or the given number of steps) and
+// "status" lists every migration.
+func runMigrate(db *ratestore.Database, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp()
+		for _, m := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Fprintf(out, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = "applied " + s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return nil
+	}
+
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+func TestRunMigrate(t *testing.T) {
+	db, err := ratestore.NewDatabase(ratestore.Config{
+		Driver:   ratestore.DriverSQLite,
+		Database: filepath.Join(t.TempDir(), "rates.db"),
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, runMigrate(db, []string{"status"}, &out))
+	assert.Contains(t, out.String(), "0001_initial_schema\tpending")
+
+	out.Reset()
+	require.NoError(t, runMigrate(db, []string{"up"}, &out))
+	assert.Contains(t, out.String(), "applied 0001_initial_schema")
+
+	out.Reset()
+	require.NoError(t, runMigrate(db, []string{"up"}, &out))
+	assert.Equal(t, "schema is up to date\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runMigrate(db, []string{"down", "1"}, &out))
+	assert.Contains(t, out.String(), "reverted")
+
+	assert.Error(t, runMigrate(db, []string{"down", "zero"}, &out))
+	assert.Error(t, runMigrate(db, []string{"sideways"}, &out))
+	assert.Error(t, runMigrate(db, nil, &out))
+}
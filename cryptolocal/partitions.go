@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+const partitionsUsage = "usage: partitions [list | archive YYYY-MM | drop YYYY-MM]"
+
+// runPartitions runs the partitions subcommand, which lists the monthly
+// partitions of the raw rates, or archives or drops the partition of a month
+// once it is rolled up.
+func runPartitions(db *ratestore.Database, args []string, out io.Writer) error {
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		partitions, err := db.ListRatePartitions()
+		if err != nil {
+			return err
+		}
+		for _, p := range partitions {
+			state := "hot"
+			if p.Archived {
+				state = "archived"
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\n", p.Month.Format("2006-01"), p.Table, state)
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return errors.New(partitionsUsage)
+	}
+	month, err := time.Parse("2006-01", args[1])
+	if err != nil {
+		return fmt.Errorf("invalid month %q, expected YYYY-MM", args[1])
+	}
+
+	switch args[0] {
+	case "archive":
+		p, err := db.ArchiveRatePartition(month)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "archived the rates of %s to %s\n", args[1], p.Table)
+	case "drop":
+		p, err := db.DropRatePartition(month)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "dropped the rates of %s in %s\n", args[1], p.Table)
+	default:
+		return errors.New(partitionsUsage)
+	}
+	return nil
+}
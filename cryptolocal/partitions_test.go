@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+func TestRunPartitions(t *testing.T) {
+	db, err := ratestore.NewDatabase(ratestore.Config{
+		Driver:         ratestore.DriverSQLite,
+		Database:       filepath.Join(t.TempDir(), "rates.db"),
+		PartitionRates: true,
+	})
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.MigrateUp()
+	require.NoError(t, err)
+	seedArchiveCurrencies(t, db)
+	cryptoIDs, err := db.GetCryptoMappings()
+	require.NoError(t, err)
+	fiatIDs, err := db.GetFiatMappings()
+	require.NoError(t, err)
+
+	jan := time.Date(2023, 1, 15, 12, 0, 0, 0, time.UTC)
+	for _, timestamp := range []time.Time{jan, jan.AddDate(0, 1, 0)} {
+		_, err := db.InsertExchangeRates([]ratestore.ExchangeRate{
+			{CryptoID: cryptoIDs["BTC"], FiatID: fiatIDs["USD"], Rate: decimal.RequireFromString("30000"), Timestamp: timestamp},
+		})
+		require.NoError(t, err)
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, runPartitions(db, nil, &out))
+	assert.Equal(t, "2023-01\tExchangeRates_202301\thot\n2023-02\tExchangeRates_202302\thot\n", out.String())
+
+	assert.ErrorIs(t, runPartitions(db, []string{"archive", "2023-01"}, &out), ratestore.ErrNotRolledUp)
+	_, err = db.Rollup(jan.AddDate(0, 1, 1))
+	require.NoError(t, err)
+
+	out.Reset()
+	require.NoError(t, runPartitions(db, []string{"archive", "2023-01"}, &out))
+	assert.Equal(t, "archived the rates of 2023-01 to ExchangeRatesArchive_202301\n", out.String())
+	out.Reset()
+	require.NoError(t, runPartitions(db, []string{"list"}, &out))
+	assert.Equal(t, "2023-01\tExchangeRatesArchive_202301\tarchived\n2023-02\tExchangeRates_202302\thot\n", out.String())
+	out.Reset()
+	require.NoError(t, runPartitions(db, []string{"drop", "2023-01"}, &out))
+	assert.Equal(t, "dropped the rates of 2023-01 in ExchangeRatesArchive_202301\n", out.String())
+
+	assert.ErrorIs(t, runPartitions(db, []string{"drop", "2023-01"}, &out), ratestore.ErrNotFound)
+	assert.Error(t, runPartitions(db, []string{"archive", "january"}, &out))
+	assert.Error(t, runPartitions(db, []string{"merge", "2023-01"}, &out))
+	assert.Error(t, runPartitions(db, []string{"archive"}, &out))
+}
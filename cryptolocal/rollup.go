@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// runRollup runs the rollup subcommand, which brings the hourly and daily
+// rollups up to date and applies the raw retention. The scheduler does the
+// same after every ingestion run.
+func runRollup(db *ratestore.Database, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return errors.New("usage: rollup")
+	}
+
+	result, err := db.Rollup(time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "wrote %d hourly and %d daily buckets, pruned %d raw rates and %d partitions\n",
+		result.HourlyBuckets, result.DailyBuckets, result.Pruned, result.DroppedPartitions)
+	return nil
+}
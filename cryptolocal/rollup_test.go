@@ -0,0 +1,19 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunRollup(t *testing.T) {
+	db := newSeedDatabase(t)
+
+	var out bytes.Buffer
+	require.NoError(t, runRollup(db, nil, &out))
+	assert.Equal(t, "wrote 0 hourly and 0 daily buckets, pruned 0 raw rates and 0 partitions\n", out.String())
+
+	assert.Error(t, runRollup(db, []string{"now"}, &out))
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// IngestionStatus is the response of the ingestion status endpoint.
+type IngestionStatus struct {
+	Enabled  bool   `json:"enabled"`
+	Interval string `json:"interval,omitempty"`
+	Jitter   string `json:"jitter,omitempty"`
+	Running  bool   `json:"running"`
+	// Runs counts the completed runs, Failures the ones that failed and
+	// Skipped the ones not started because the previous run was still going.
+	Runs     int           `json:"runs"`
+	Failures int           `json:"failures"`
+	Skipped  int           `json:"skipped"`
+	NextRun  *time.Time    `json:"next_run,omitempty"`
+	LastRun  *IngestionRun `json:"last_run,omitempty"`
+}
+
+// IngestionRun describes one ingestion run.
+type IngestionRun struct {
+	// RunID is the ID of the run in the ingestion ledger, if it got recorded.
+	RunID      int64     `json:"run_id,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Rates      int       `json:"rates"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Scheduler runs the rate ingestion on an interval inside the server process.
+// Every wait is lengthened by a random jitter so that several instances do not
+// hit the price API at once, and a run is skipped while the previous one is
+// still going.
+type Scheduler struct {
+	ingest   func(context.Context) (ratestore.IngestResult, error)
+	interval time.Duration
+	jitter   time.Duration
+
+	mu      sync.Mutex
+	running bool
+	status  IngestionStatus
+}
+
+// NewScheduler returns a Scheduler calling ingest every interval plus up to
+// jitter.
+func NewScheduler(ingest func(context.Context) (ratestore.IngestResult, error), interval, jitter time.Duration) *Scheduler {
+	return &Scheduler{
+		ingest:   ingest,
+		interval: interval,
+		jitter:   jitter,
+		status: IngestionStatus{
+			Enabled:  true,
+			Interval: interval.String(),
+			Jitter:   jitter.String(),
+		},
+	}
+}
+
+// Start runs the ingestion right away and then on schedule until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		var delay time.Duration
+		for {
+			s.setNextRun(time.Now().Add(delay))
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			go s.RunOnce(ctx)
+			delay = s.interval
+			if s.jitter > 0 {
+				delay += time.Duration(rand.Int63n(int64(s.jitter)))
+			}
+		}
+	}()
+}
+
+// RunOnce runs the ingestion unless a run is already in progress, and reports
+// whether it ran. A run is cancelled if it takes longer than the interval.
+func (s *Scheduler) RunOnce(ctx context.Context) bool {
+	s.mu.Lock()
+	if s.running {
+		s.status.Skipped++
+		s.mu.Unlock()
+		log.Println("Ingestion skipped: the previous run is still in progress")
+		return false
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	run := IngestionRun{StartedAt: time.Now().UTC()}
+	ctx, cancel := context.WithTimeout(ctx, s.interval)
+	result, err := s.ingest(ctx)
+	cancel()
+	run.FinishedAt = time.Now().UTC()
+	run.RunID = result.RunID
+	run.Rates = result.Rates
+	if err != nil {
+		run.Error = err.Error()
+		log.Println("Ingestion failed:", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+	s.status.Runs++
+	if err != nil {
+		s.status.Failures++
+	}
+	s.status.LastRun = &run
+	return true
+}
+
+// Status returns the state of the scheduler and the outcome of the last run.
+func (s *Scheduler) Status() IngestionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.status
+	status.Running = s.running
+	if status.LastRun != nil {
+		lastRun := *status.LastRun
+		status.LastRun = &lastRun
+	}
+	return status
+}
+
+func (s *Scheduler) setNextRun(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next = next.UTC()
+	s.status.NextRun = &next
+}
+
+// scheduler runs the ingestion when it is enabled, and is nil otherwise.
+var scheduler *Scheduler
+
+// handleIngestionStatus serves GET /ingestion/status.
+func handleIngestionStatus(w http.ResponseWriter, r *http.Request) {
+	status := IngestionStatus{}
+	if scheduler != nil {
+		status = scheduler.Status()
+	}
+
+	responseBody, _ := json.Marshal(status)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
+
+// runLedger is the database the ingestion runs are recorded in, and nil when
+// serving from a fixture.
+var runLedger *ratestore.Database
+
+// handleIngestionRuns serves GET /ingestion/runs, listing the latest recorded
+// runs newest first. The number of runs is set with ?limit=. The runs carry
+// the errors of the provider, so it requires the admin token like the admin
+// endpoints.
+func handleIngestionRuns(w http.ResponseWriter, r *http.Request) {
+	if runLedger == nil {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Ingestion runs are only recorded when serving from a database."))
+		return
+	}
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	limit, err := ratestore.ParseRunLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Invalid ingestion run limit: " + err.Error() + "."))
+		return
+	}
+
+	runs, err := runLedger.ListIngestionRuns(limit)
+	if err != nil {
+		log.Println("Error listing ingestion runs:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	responseBody, _ := json.Marshal(runs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBody)
+}
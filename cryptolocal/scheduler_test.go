@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+func TestSchedulerRunOnce(t *testing.T) {
+	fail := false
+	s := NewScheduler(func(ctx context.Context) (ratestore.IngestResult, error) {
+		if fail {
+			return ratestore.IngestResult{}, errors.New("API call failed with status code: 429")
+		}
+		return ratestore.IngestResult{Rates: 100}, nil
+	}, time.Minute, 0)
+
+	assert.True(t, s.RunOnce(context.Background()))
+	status := s.Status()
+	assert.Equal(t, 1, status.Runs)
+	require.NotNil(t, status.LastRun)
+	assert.Equal(t, 100, status.LastRun.Rates)
+	assert.Empty(t, status.LastRun.Error)
+
+	fail = true
+	assert.True(t, s.RunOnce(context.Background()))
+	status = s.Status()
+	assert.Equal(t, 2, status.Runs)
+	assert.Equal(t, 1, status.Failures)
+	assert.Equal(t, "API call failed with status code: 429", status.LastRun.Error)
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s := NewScheduler(func(ctx context.Context) (ratestore.IngestResult, error) {
+		close(started)
+		<-release
+		return ratestore.IngestResult{}, nil
+	}, time.Minute, 0)
+
+	done := make(chan bool)
+	go func() { done <- s.RunOnce(context.Background()) }()
+	<-started
+
+	assert.True(t, s.Status().Running)
+	assert.False(t, s.RunOnce(context.Background()))
+
+	close(release)
+	assert.True(t, <-done)
+	status := s.Status()
+	assert.False(t, status.Running)
+	assert.Equal(t, 1, status.Runs)
+	assert.Equal(t, 1, status.Skipped)
+}
+
+func TestSchedulerStart(t *testing.T) {
+	var runs int32
+	s := NewScheduler(func(ctx context.Context) (ratestore.IngestResult, error) {
+		atomic.AddInt32(&runs, 1)
+		return ratestore.IngestResult{}, nil
+	}, 10*time.Millisecond, 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, time.Millisecond)
+	assert.NotNil(t, s.Status().NextRun)
+}
+
+func serveIngestionStatus() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handleIngestionStatus(w, httptest.NewRequest(http.MethodGet, "/ingestion/status", nil))
+	return w
+}
+
+func TestHandleIngestionStatus(t *testing.T) {
+	previous := scheduler
+	t.Cleanup(func() { scheduler = previous })
+
+	scheduler = nil
+	w := serveIngestionStatus()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"enabled": false, "running": false, "runs": 0, "failures": 0, "skipped": 0}`, w.Body.String())
+
+	scheduler = NewScheduler(func(ctx context.Context) (ratestore.IngestResult, error) {
+		return ratestore.IngestResult{Rates: 3}, nil
+	}, time.Minute, 0)
+	scheduler.RunOnce(context.Background())
+
+	var status IngestionStatus
+	require.NoError(t, json.Unmarshal(serveIngestionStatus().Body.Bytes(), &status))
+	assert.True(t, status.Enabled)
+	assert.Equal(t, "1m0s", status.Interval)
+	require.NotNil(t, status.LastRun)
+	assert.Equal(t, 3, status.LastRun.Rates)
+}
+
+// serveIngestionRuns serves a request for path with the admin token, if not
+// empty.
+func serveIngestionRuns(path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handleIngestionRuns(w, r)
+	return w
+}
+
+func TestHandleIngestionRuns(t *testing.T) {
+	previous := runLedger
+	t.Cleanup(func() { runLedger = previous })
+
+	runLedger = nil
+	w := serveIngestionRuns("/ingestion/runs", testAdminToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+
+	runLedger = useAdminDatabase(t)
+	start := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		_, err := runLedger.StartIngestionRun(ratestore.ProviderCryptoCompare, start.Add(time.Duration(i)*10*time.Minute))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serveIngestionRuns("/ingestion/runs", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serveIngestionRuns("/ingestion/runs", "wrong-token").Code)
+
+	w = serveIngestionRuns("/ingestion/runs?limit=2", testAdminToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var runs []ratestore.IngestionRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+	require.Len(t, runs, 2)
+	assert.Equal(t, int64(3), runs[0].ID)
+	assert.Equal(t, ratestore.RunStatusRunning, runs[0].Status)
+
+	w = serveIngestionRuns("/ingestion/runs?limit=1000", testAdminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+}
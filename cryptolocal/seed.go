@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sushant-iitp/hellogo/ratestore"
+	"gopkg.in/yaml.v3"
+)
+
+const seedUsage = "usage: seed [-dry-run] <manifest>"
+
+// Manifest is the list of supported currencies read by the seed subcommand.
+type Manifest struct {
+	Currencies []ratestore.Currency `yaml:"currencies"`
+}
+
+// LoadManifest reads the YAML currency manifest at path.
+func LoadManifest(path string) (Manifest, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var manifest Manifest
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil && !errors.Is(err, io.EOF) {
+		return Manifest{}, fmt.Errorf("parsing manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// runSeed runs the seed subcommand, which makes the currency tables match a
+// manifest and prints what it added, updated and disabled.
+func runSeed(db *ratestore.Database, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dryRun := fs.Bool("dry-run", false, "report the changes without making them")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errors.New(seedUsage)
+	}
+
+	manifest, err := LoadManifest(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	report, err := db.SeedCurrencies(manifest.Currencies, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range []struct {
+		verb       string
+		currencies []ratestore.Currency
+	}{
+		{"added", report.Added},
+		{"updated", report.Updated},
+		{"disabled", report.Disabled},
+	} {
+		for _, c := range change.currencies {
+			fmt.Fprintf(out, "%s %s %s\n", change.verb, c.Type, c.Symbol)
+		}
+	}
+	if len(report.Added)+len(report.Updated)+len(report.Disabled) == 0 {
+		fmt.Fprintln(out, "currencies are up to date")
+	} else if *dryRun {
+		fmt.Fprintln(out, "dry run, no changes were made")
+	}
+	return nil
+}
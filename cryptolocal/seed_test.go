@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+func newSeedDatabase(t *testing.T) *ratestore.Database {
+	db, err := ratestore.NewDatabase(ratestore.Config{
+		Driver:   ratestore.DriverSQLite,
+		Database: filepath.Join(t.TempDir(), "rates.db"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.MigrateUp()
+	require.NoError(t, err)
+	return db
+}
+
+func TestLoadManifest(t *testing.T) {
+	manifest, err := LoadManifest("currencies.yaml")
+	require.NoError(t, err)
+	assert.NoError(t, ratestore.ValidateCurrencies(manifest.Currencies))
+	assert.Len(t, manifest.Currencies, 20)
+	assert.Equal(t, ratestore.Currency{Symbol: "BTC", Name: "Bitcoin", Type: "crypto", Decimals: 8, Aliases: []string{"XBT"}},
+		manifest.Currencies[0])
+}
+
+func TestLoadManifestUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "currencies.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("currencies:\n  - {symbol: BTC, ticker: BTC}\n"), 0o644))
+
+	_, err := LoadManifest(path)
+	assert.Error(t, err)
+}
+
+func TestRunSeed(t *testing.T) {
+	db := newSeedDatabase(t)
+	path := filepath.Join(t.TempDir(), "currencies.yaml")
+	write := func(manifest string) {
+		require.NoError(t, os.WriteFile(path, []byte(manifest), 0o644))
+	}
+	write(`currencies:
+  - {symbol: BTC, name: Bitcoin, type: crypto, decimals: 8}
+  - {symbol: USD, name: US Dollar, type: fiat, decimals: 2}
+`)
+
+	var out bytes.Buffer
+	require.NoError(t, runSeed(db, []string{"-dry-run", path}, &out))
+	assert.Equal(t, "added crypto BTC\nadded fiat USD\ndry run, no changes were made\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runSeed(db, []string{path}, &out))
+	assert.Equal(t, "added crypto BTC\nadded fiat USD\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runSeed(db, []string{path}, &out))
+	assert.Equal(t, "currencies are up to date\n", out.String())
+
+	write(`currencies:
+  - {symbol: BTC, name: Bitcoin, type: crypto, decimals: 8}
+`)
+	out.Reset()
+	require.NoError(t, runSeed(db, []string{path}, &out))
+	assert.Equal(t, "disabled fiat USD\n", out.String())
+
+	assert.Error(t, runSeed(db, nil, &out))
+	assert.Error(t, runSeed(db, []string{"-force", path}, &out))
+}
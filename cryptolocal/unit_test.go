@@ -1,66 +1,79 @@
 package main
 
 import (
-	"database/sql"
+	"encoding/json"
 	"log"
 	"os"
 	"testing"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sushant-iitp/hellogo/ratestore"
 )
 
-func setup() {
-	//Insert your DB credentials(User,Password,Host & database) here.
-	db, err := sql.Open("mysql", "user:password@tcp(host)/database")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+// mysqlEnabled reports whether the MySQL tests should run. They need a live
+// database, so they are skipped unless MYSQL_TESTS is set.
+func mysqlEnabled() bool {
+	return os.Getenv("MYSQL_TESTS") != ""
+}
 
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS FiatCurrencies (fiat_currency_id INT PRIMARY KEY AUTO_INCREMENT, symbol VARCHAR(10) UNIQUE)")
-	if err != nil {
-		log.Fatal(err)
+func requireMySQL(t *testing.T) {
+	if !mysqlEnabled() {
+		t.Skip("set MYSQL_TESTS=1 to run the MySQL tests")
 	}
+}
 
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS Cryptocurrencies (cryptocurrency_id INT PRIMARY KEY AUTO_INCREMENT, symbol VARCHAR(10) UNIQUE)")
+// newMySQLDatabase opens the test database configured by the DB_USER,
+// DB_PASSWORD, DB_HOST and DB_DATABASE environment variables.
+func newMySQLDatabase() (*ratestore.Database, error) {
+	cfg, err := ratestore.ConfigFromEnv()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	return ratestore.NewDatabase(cfg)
+}
 
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS ExchangeRates (exchange_rate_id INT PRIMARY KEY AUTO_INCREMENT, cryptocurrency_id INT, fiat_currency_id INT, rate FLOAT, timestamp DATETIME)")
-	if err != nil {
-		log.Fatal(err)
-	}
+// assertSameJSON compares the JSON encodings of expected and actual, so that
+// the decimals read back from MySQL with trailing zeros equal their literals.
+func assertSameJSON(t *testing.T, expected, actual interface{}) {
+	want, err := json.Marshal(expected)
+	require.NoError(t, err)
+	got, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got))
 }
 
-func tearDown() {
-	//Insert your DB credentials(User,Password,Host & database) here.
-	db, err := sql.Open("mysql", "user:password@tcp(host)/database")
+func setup() {
+	db, err := newMySQLDatabase()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
-	_, err = db.Exec("DROP TABLE IF EXISTS ExchangeRates")
+	_, err = db.MigrateUp()
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	_, err = db.Exec("DROP TABLE IF EXISTS Cryptocurrencies")
+func tearDown() {
+	db, err := newMySQLDatabase()
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer db.Close()
 
-	_, err = db.Exec("DROP TABLE IF EXISTS FiatCurrencies")
+	_, err = db.MigrateDown(0)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 func TestNewDatabase(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 
 	assert.NoError(t, err)
@@ -71,7 +84,8 @@ func TestNewDatabase(t *testing.T) {
 }
 
 func TestInsertFiatCurrencies(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 
@@ -89,7 +103,8 @@ func TestInsertFiatCurrencies(t *testing.T) {
 }
 
 func TestInsertCryptocurrencies(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 
@@ -107,17 +122,23 @@ func TestInsertCryptocurrencies(t *testing.T) {
 }
 
 func TestInsertExchangeRates(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 
+	_, err = db.DB.Exec("INSERT INTO Cryptocurrencies (symbol) VALUES (?)", "BTC")
+	assert.NoError(t, err)
+	_, err = db.DB.Exec("INSERT INTO FiatCurrencies (symbol) VALUES (?)", "USD")
+	assert.NoError(t, err)
+
 	// Prepare the values for the insertion
 	cryptocurrencyID := 1
 	fiatCurrencyID := 1
-	rate := 25.2
+	rate := decimal.RequireFromString("25.2")
 	timestamp := time.Now()
 
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)", cryptocurrencyID, fiatCurrencyID, rate, timestamp)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{{CryptoID: cryptocurrencyID, FiatID: fiatCurrencyID, Rate: rate, Timestamp: timestamp}})
 	assert.NoError(t, err)
 
 	var count int
@@ -127,7 +148,8 @@ func TestInsertExchangeRates(t *testing.T) {
 }
 
 func TestCheckCryptoCurrency(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 
@@ -140,7 +162,8 @@ func TestCheckCryptoCurrency(t *testing.T) {
 }
 
 func TestCheckFiatCurrency(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 
@@ -152,7 +175,8 @@ func TestCheckFiatCurrency(t *testing.T) {
 }
 
 func TestGetExchangeRate(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 
@@ -164,19 +188,20 @@ func TestGetExchangeRate(t *testing.T) {
 	assert.NoError(t, err)
 	cryptocurrencyID := 1
 	fiatCurrencyID := 1
-	rate := 25.254
+	rate := decimal.RequireFromString("25.254")
 	timestamp := time.Now()
 
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)", cryptocurrencyID, fiatCurrencyID, rate, timestamp)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{{CryptoID: cryptocurrencyID, FiatID: fiatCurrencyID, Rate: rate, Timestamp: timestamp}})
 	assert.NoError(t, err)
-	getrate, err := db.GetExchangeRate(cryptoSymbol, fiatSymbol)
+	getrate, _, err := db.GetExchangeRate(cryptoSymbol, fiatSymbol, "")
 	assert.NoError(t, err)
 	assert.NotZero(t, getrate)
 }
 
 // TestGetExchangeRatesForCrypto tests the retrieval of exchange rates for a given cryptocurrency.
 func TestGetExchangeRatesForCrypto(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 
@@ -187,8 +212,8 @@ func TestGetExchangeRatesForCrypto(t *testing.T) {
 	cryptocurrencyID := 1
 	fiatCurrencyID1 := 1
 	fiatCurrencyID2 := 2
-	rate1 := 25.2
-	rate2 := 30.5
+	rate1 := decimal.RequireFromString("25.2")
+	rate2 := decimal.RequireFromString("30.5")
 	timestamp := time.Now()
 
 	// Insert the necessary data into the database
@@ -198,27 +223,27 @@ func TestGetExchangeRatesForCrypto(t *testing.T) {
 	assert.NoError(t, err)
 	_, err = db.DB.Exec("INSERT INTO FiatCurrencies (symbol) VALUES (?)", fiatSymbol2)
 	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID, fiatCurrencyID1, rate1, timestamp)
-	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID, fiatCurrencyID2, rate2, timestamp)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{
+		{CryptoID: cryptocurrencyID, FiatID: fiatCurrencyID1, Rate: rate1, Timestamp: timestamp},
+		{CryptoID: cryptocurrencyID, FiatID: fiatCurrencyID2, Rate: rate2, Timestamp: timestamp},
+	})
 	assert.NoError(t, err)
 
 	// Retrieve the exchange rates for the cryptocurrency
-	rates, err := db.GetExchangeRatesForCrypto(cryptoSymbol)
+	rates, _, err := db.GetExchangeRatesForCrypto(cryptoSymbol, "")
 	assert.NoError(t, err)
 
 	// Check the expected result
-	expectedRates := map[string]float64{
+	expectedRates := map[string]decimal.Decimal{
 		fiatSymbol1: rate1,
 		fiatSymbol2: rate2,
 	}
-	assert.Equal(t, expectedRates, rates)
+	assertSameJSON(t, expectedRates, rates)
 }
 
 func TestGetAllExchangeRates(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 	// Prepare the test data
@@ -230,14 +255,14 @@ func TestGetAllExchangeRates(t *testing.T) {
 	cryptocurrencyID2 := 2
 	fiatCurrencyID1 := 1
 	fiatCurrencyID2 := 2
-	rate1 := 25.2
-	rate2 := 30.5
-	rate3 := 31.1
-	rate4 := 26.4
-	rate5 := 5484.6
-	rate6 := 345.6
-	rate7 := 86.6
-	rate8 := 125.6
+	rate1 := decimal.RequireFromString("25.2")
+	rate2 := decimal.RequireFromString("30.5")
+	rate3 := decimal.RequireFromString("31.1")
+	rate4 := decimal.RequireFromString("26.4")
+	rate5 := decimal.RequireFromString("5484.6")
+	rate6 := decimal.RequireFromString("345.6")
+	rate7 := decimal.RequireFromString("86.6")
+	rate8 := decimal.RequireFromString("125.6")
 	timestamp := time.Now()
 
 	// Insert the necessary data into the database
@@ -249,37 +274,27 @@ func TestGetAllExchangeRates(t *testing.T) {
 	assert.NoError(t, err)
 	_, err = db.DB.Exec("INSERT INTO FiatCurrencies (symbol) VALUES (?)", fiatSymbol2)
 	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID1, fiatCurrencyID1, rate1, timestamp)
-	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID1, fiatCurrencyID2, rate2, timestamp)
-	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID2, fiatCurrencyID1, rate3, timestamp)
-	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID2, fiatCurrencyID2, rate4, timestamp)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{
+		{CryptoID: cryptocurrencyID1, FiatID: fiatCurrencyID1, Rate: rate1, Timestamp: timestamp},
+		{CryptoID: cryptocurrencyID1, FiatID: fiatCurrencyID2, Rate: rate2, Timestamp: timestamp},
+		{CryptoID: cryptocurrencyID2, FiatID: fiatCurrencyID1, Rate: rate3, Timestamp: timestamp},
+		{CryptoID: cryptocurrencyID2, FiatID: fiatCurrencyID2, Rate: rate4, Timestamp: timestamp},
+	})
 	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID1, fiatCurrencyID1, rate5, timestamp)
-	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID1, fiatCurrencyID2, rate6, timestamp)
-	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID2, fiatCurrencyID1, rate7, timestamp)
-	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID2, fiatCurrencyID2, rate8, timestamp)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{
+		{CryptoID: cryptocurrencyID1, FiatID: fiatCurrencyID1, Rate: rate5, Timestamp: timestamp},
+		{CryptoID: cryptocurrencyID1, FiatID: fiatCurrencyID2, Rate: rate6, Timestamp: timestamp},
+		{CryptoID: cryptocurrencyID2, FiatID: fiatCurrencyID1, Rate: rate7, Timestamp: timestamp},
+		{CryptoID: cryptocurrencyID2, FiatID: fiatCurrencyID2, Rate: rate8, Timestamp: timestamp},
+	})
 	assert.NoError(t, err)
 
 	// Retrieve all exchange rates
-	rates, err := db.GetAllExchangeRates()
+	rates, _, err := db.GetAllExchangeRates("")
 	assert.NoError(t, err)
 
 	// Check the expected result
-	expectedRates := map[string]map[string]float64{
+	expectedRates := map[string]map[string]decimal.Decimal{
 		cryptoSymbol1: {
 			fiatSymbol1: rate5,
 			fiatSymbol2: rate6,
@@ -289,20 +304,21 @@ func TestGetAllExchangeRates(t *testing.T) {
 			fiatSymbol2: rate8,
 		},
 	}
-	assert.Equal(t, expectedRates, rates)
+	assertSameJSON(t, expectedRates, rates)
 }
 
 // TestGetHistoricalExchangeRates tests the retrieval of historical exchange rates.
 func TestGetHistoricalExchangeRates(t *testing.T) {
-	db, err := NewDatabase()
+	requireMySQL(t)
+	db, err := newMySQLDatabase()
 	defer db.Close()
 	assert.NoError(t, err)
 	// Prepare the test data
 	cryptoSymbol := "BTC"
 	fiatSymbol := "USD"
-	rate1 := 25.2
-	rate2 := 30.5
-	rate3 := 530.5
+	rate1 := decimal.RequireFromString("25.2")
+	rate2 := decimal.RequireFromString("30.5")
+	rate3 := decimal.RequireFromString("530.5")
 	timestamp1 := time.Now().UTC().Add(-2 * time.Hour).Round(time.Second)  // 2 hours ago
 	timestamp2 := time.Now().UTC().Add(-1 * time.Hour).Round(time.Second)  // 1 hour ago
 	timestamp3 := time.Now().UTC().Add(-26 * time.Hour).Round(time.Second) // 26 hour ago
@@ -315,14 +331,11 @@ func TestGetHistoricalExchangeRates(t *testing.T) {
 	assert.NoError(t, err)
 	_, err = db.DB.Exec("INSERT INTO FiatCurrencies (symbol) VALUES (?)", fiatSymbol)
 	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID, fiatCurrencyID, rate1, timestamp1)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{{CryptoID: cryptocurrencyID, FiatID: fiatCurrencyID, Rate: rate1, Timestamp: timestamp1}})
 	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID, fiatCurrencyID, rate2, timestamp2)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{{CryptoID: cryptocurrencyID, FiatID: fiatCurrencyID, Rate: rate2, Timestamp: timestamp2}})
 	assert.NoError(t, err)
-	_, err = db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?,?,?,?)",
-		cryptocurrencyID, fiatCurrencyID, rate3, timestamp3)
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{{CryptoID: cryptocurrencyID, FiatID: fiatCurrencyID, Rate: rate3, Timestamp: timestamp3}})
 	assert.NoError(t, err)
 
 	// Retrieve historical exchange rates
@@ -340,10 +353,13 @@ func TestGetHistoricalExchangeRates(t *testing.T) {
 			Timestamp: timestamp2.UTC().Format("2006-01-02T15:04:05Z"),
 		},
 	}
-	assert.Equal(t, expectedRates, rates)
+	assertSameJSON(t, expectedRates, rates)
 }
 
 func TestMain(m *testing.M) {
+	if !mysqlEnabled() {
+		os.Exit(m.Run())
+	}
 	setup()
 	code := m.Run()
 	tearDown()
@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/aws/aws-lambda-go v1.41.0
 	github.com/ethereum/go-ethereum v1.12.0
+	github.com/shopspring/decimal v1.4.0
 )
 
 require (
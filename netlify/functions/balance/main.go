@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"log"
-	"math"
 	"math/big"
 	"net/http"
 	"os"
@@ -15,6 +14,7 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/shopspring/decimal"
 )
 
 func isValidAddress(address string) bool {
@@ -24,13 +24,10 @@ func isValidAddress(address string) bool {
 	return match
 }
 
-// Helper function to convert balance from Wei to Ether
-func weiToEther(balance *big.Int) float64 {
-	etherValue := new(big.Float)
-	etherValue.SetString(balance.String())
-	etherValue = etherValue.Quo(etherValue, big.NewFloat(math.Pow10(18)))
-	ether, _ := etherValue.Float64()
-	return ether
+// Helper function to convert balance from Wei to Ether. One Ether is 10^18 Wei,
+// so the conversion only moves the decimal point and is exact.
+func weiToEther(balance *big.Int) decimal.Decimal {
+	return decimal.NewFromBigInt(balance, -18)
 }
 
 func GetBalanceHandler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -75,8 +72,8 @@ func GetBalanceHandler(ctx context.Context, request events.APIGatewayProxyReques
 
 	// Prepare the response payload
 	response := struct {
-		Address string  `json:"address"`
-		Balance float64 `json:"balance"`
+		Address string          `json:"address"`
+		Balance decimal.Decimal `json:"balance"`
 	}{
 		Address: address,
 		Balance: weiToEther(balance),
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestWeiToEther(t *testing.T) {
+	for wei, want := range map[string]string{
+		"0":                           "0",
+		"1":                           "0.000000000000000001",
+		"1000000000000000000":         "1",
+		"123456789012345678901234567": "123456789.012345678901234567",
+	} {
+		balance, _ := new(big.Int).SetString(wei, 10)
+		if got := weiToEther(balance).String(); got != want {
+			t.Errorf("weiToEther(%s) = %s, want %s", wei, got, want)
+		}
+	}
+}
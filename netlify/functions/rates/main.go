@@ -1,247 +1,181 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/shopspring/decimal"
+	"github.com/sushant-iitp/hellogo/ratestore"
 )
 
-type Database struct {
-	DB *sql.DB
-}
-
 type CryptoResponse struct {
-	Value float64 `json:"value"`
+	Crypto string          `json:"crypto"`
+	Fiat   string          `json:"fiat"`
+	Value  decimal.Decimal `json:"value"`
+	ratestore.Snapshot
 }
 
-type CryptoResponseWithTimestamp struct {
-	Value     float64 `json:"value"`
-	Timestamp string  `json:"timestamp"`
-}
+type CryptoResponseWithTimestamp = ratestore.RateWithTimestamp
 
 type HistoricalRateResponse struct {
+	Crypto       string                        `json:"crypto"`
+	Fiat         string                        `json:"fiat"`
 	ExchangeRate []CryptoResponseWithTimestamp `json:"exchange_rate"`
 }
 
+// SourcesResponse lists the latest rate of a pair from every price source.
+type SourcesResponse struct {
+	Crypto  string                 `json:"crypto"`
+	Fiat    string                 `json:"fiat"`
+	Sources []ratestore.SourceRate `json:"sources"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-func (d *Database) CheckCryptoCurrency(crypto string) (bool, error) {
-	var exists bool
-	err := d.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM Cryptocurrencies WHERE symbol = ?)", crypto).Scan(&exists)
-	if err != nil {
-		return false, err
-	}
-	return exists, nil
-}
+// database is shared by every invocation served by this function instance, so
+// the connection pool outlives a single request.
+var database = ratestore.NewSharedDatabase(NewDatabase)
 
-func (d *Database) CheckFiatCurrency(fiat string) (bool, error) {
-	var exists bool
-	err := d.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM FiatCurrencies WHERE symbol = ?)", fiat).Scan(&exists)
+func NewDatabase() (*ratestore.Database, error) {
+	cfg, err := ratestore.ConfigFromEnv()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return exists, nil
+	return ratestore.NewDatabase(cfg)
 }
 
-func NewDatabase() (*Database, error) {
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbDatabase := os.Getenv("DB_DATABASE")
+// store is database read through the cache of its latest rates, which is
+// selected by the CACHE_* variables and kept by the function instance like the
+// connection pool. A Redis cache is invalidated by the ingestions of the
+// updatetable function. No ingestion reaches the memory cache of an
+// instance, so it checks the latest snapshot ID before every cached read and
+// is invalidated as soon as it changes.
+var (
+	storeMu sync.Mutex
+	store   ratestore.RateStore
+)
 
-	connString := dbUser + ":" + dbPassword + "@tcp(" + dbHost + ")/" + dbDatabase + "?parseTime=true"
-	db, err := sql.Open("mysql", connString)
-	if err != nil {
-		return nil, err
-	}
+// rateStore returns store, opening the database and the cache if needed.
+func rateStore() (ratestore.RateStore, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
 
-	err = db.Ping()
+	if store != nil {
+		return store, nil
+	}
+	db, err := database.Get()
 	if err != nil {
 		return nil, err
 	}
-
-	return &Database{DB: db}, nil
-}
-
-func (d *Database) Close() error {
-	return d.DB.Close()
-}
-
-func (d *Database) GetExchangeRate(crypto, fiat string) (float64, error) {
-	query := `
-	SELECT rate
-	FROM ExchangeRates er
-	JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-	JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
-	WHERE c.symbol = ? AND f.symbol = ?
-	AND er.timestamp = (
-		SELECT MAX(timestamp)
-		FROM ExchangeRates
-		WHERE cryptocurrency_id = er.cryptocurrency_id
-		AND fiat_currency_id = er.fiat_currency_id
-	)
-	`
-
-	row := d.DB.QueryRow(query, crypto, fiat)
-
-	var rate float64
-	err := row.Scan(&rate)
+	cfg, err := ratestore.CacheConfigFromEnv()
+	if err == nil {
+		err = cfg.Validate()
+	}
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("invalid cache configuration: %w", err)
 	}
-
-	return rate, nil
-}
-
-func (d *Database) GetExchangeRatesForCrypto(crypto string) (map[string]float64, error) {
-	query := `
-	SELECT f.symbol, er.rate
-	FROM ExchangeRates er
-	JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-	JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
-	WHERE c.symbol = ?
-	AND er.timestamp = (
-		SELECT MAX(timestamp)
-		FROM ExchangeRates
-		WHERE cryptocurrency_id = er.cryptocurrency_id
-	)
-	`
-
-	rows, err := d.DB.Query(query, crypto)
+	cache, err := ratestore.NewCache(cfg)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	rates := make(map[string]float64)
-	for rows.Next() {
-		var fiat string
-		var rate float64
-		if err := rows.Scan(&fiat, &rate); err != nil {
-			return nil, err
-		}
-		rates[fiat] = rate
+	if cache == nil {
+		store = db
+		return store, nil
 	}
-
-	return rates, nil
+	cached := ratestore.NewCachedStore(db, cache, cfg.TTL)
+	if _, ok := cache.(*ratestore.LRUCache); ok {
+		cached.InvalidateOnVersion(db.LatestSnapshotID)
+	}
+	store = cached
+	return store, nil
 }
 
-func (d *Database) GetAllExchangeRates() (map[string]map[string]float64, error) {
-	query := `
-	SELECT c.symbol, f.symbol, er.rate
-	FROM (
-		SELECT cryptocurrency_id, fiat_currency_id, MAX(timestamp) AS max_timestamp
-		FROM ExchangeRates
-		GROUP BY cryptocurrency_id, fiat_currency_id
-	) AS latest
-	JOIN ExchangeRates er ON er.cryptocurrency_id = latest.cryptocurrency_id
-		AND er.fiat_currency_id = latest.fiat_currency_id
-		AND er.timestamp = latest.max_timestamp
-	JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-	JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id;
-	
-	`
-
-	rows, err := d.DB.Query(query)
-	if err != nil {
-		return nil, err
+func handleTooManyInvalidParameters() events.APIGatewayProxyResponse {
+	errorMessage := "Too many parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n5. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/sources/{crypto}/{fiat}\n\nSupported currencies: https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies"
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusBadRequest,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       errorMessage,
 	}
-	defer rows.Close()
+}
 
-	rates := make(map[string]map[string]float64)
-	for rows.Next() {
-		var crypto, fiat string
-		var rate float64
-		if err := rows.Scan(&crypto, &fiat, &rate); err != nil {
-			return nil, err
-		}
+func handleInvalidParameters() events.APIGatewayProxyResponse {
+	errorMessage := "Invalid parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n5. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/sources/{crypto}/{fiat}\n\nSupported currencies: https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies"
 
-		if rates[crypto] == nil {
-			rates[crypto] = make(map[string]float64)
-		}
-		rates[crypto][fiat] = rate
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusBadRequest,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       errorMessage,
 	}
-
-	return rates, nil
 }
 
-func (d *Database) GetHistoricalExchangeRates(crypto, fiat string) ([]CryptoResponseWithTimestamp, error) {
-	query := `
-		SELECT er.rate, er.timestamp
-		FROM ExchangeRates er
-		JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
-		JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
-		WHERE c.symbol = ? AND f.symbol = ? AND er.timestamp >= NOW() - INTERVAL 24 HOUR
-	`
+func handleInvalidCryptoCurrency() events.APIGatewayProxyResponse {
+	errorMessage := "Crypto currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n5. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/sources/{crypto}/{fiat}\n\nSupported currencies: https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies"
 
-	rows, err := d.DB.Query(query, crypto, fiat)
-	if err != nil {
-		return nil, err
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusNotFound,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       errorMessage,
 	}
-	defer rows.Close()
+}
 
-	rates := make([]CryptoResponseWithTimestamp, 0)
-	for rows.Next() {
-		var rate float64
-		var timestamp string
-		if err := rows.Scan(&rate, &timestamp); err != nil {
-			return nil, err
-		}
-		response := CryptoResponseWithTimestamp{
-			Value:     rate,
-			Timestamp: timestamp,
-		}
-		rates = append(rates, response)
-	}
+func handleInvalidFiatCurrency() events.APIGatewayProxyResponse {
+	errorMessage := "Fiat currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n5. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/sources/{crypto}/{fiat}\n\nSupported currencies: https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies"
 
-	return rates, nil
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusNotFound,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       errorMessage,
+	}
 }
 
-func handleTooManyInvalidParameters() events.APIGatewayProxyResponse {
-	errorMessage := "Too many parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n\nValid cryptocurrencies: BTC, ETH, USDT, BNB, USDC, XRP, ADA, DOGE, LTC, SOL\nValid fiat currencies: CNY, USD, EUR, JPY, GBP, KRW, INR, CAD, HKD, BRL"
+func handleDisabledCurrency(symbol string) events.APIGatewayProxyResponse {
+	errorMessage := "Currency " + symbol + " is disabled and no longer served. \n\nSupported currencies: https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies"
 
 	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusBadRequest,
+		StatusCode: http.StatusNotFound,
 		Headers:    map[string]string{"Content-Type": "text/plain"},
 		Body:       errorMessage,
 	}
 }
 
-func handleInvalidParameters() events.APIGatewayProxyResponse {
-	errorMessage := "Invalid parameters. Please try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n\nValid cryptocurrencies: BTC, ETH, USDT, BNB, USDC, XRP, ADA, DOGE, LTC, SOL\nValid fiat currencies: CNY, USD, EUR, JPY, GBP, KRW, INR, CAD, HKD, BRL"
+func handleInvalidCurrencyType() events.APIGatewayProxyResponse {
+	errorMessage := "Unknown currency type. \nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies/crypto\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/currencies/fiat"
 
 	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusBadRequest,
+		StatusCode: http.StatusNotFound,
 		Headers:    map[string]string{"Content-Type": "text/plain"},
 		Body:       errorMessage,
 	}
 }
 
-func handleInvalidCryptoCurrency() events.APIGatewayProxyResponse {
-	errorMessage := "Crypto currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n\nValid cryptocurrencies: BTC, ETH, USDT, BNB, USDC, XRP, ADA, DOGE, LTC, SOL\nValid fiat currencies: CNY, USD, EUR, JPY, GBP, KRW, INR, CAD, HKD, BRL"
+func handleInvalidPeriod(err error) events.APIGatewayProxyResponse {
+	errorMessage := "Invalid history period: " + err.Error() + ". \nUse a number of days such as 7d or a duration such as 36h."
 
 	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusNotFound,
+		StatusCode: http.StatusBadRequest,
 		Headers:    map[string]string{"Content-Type": "text/plain"},
 		Body:       errorMessage,
 	}
 }
 
-func handleInvalidFiatCurrency() events.APIGatewayProxyResponse {
-	errorMessage := "Fiat currency does not exist or is not servicable. \nPlease try again with valid parameters.\n\nValid URL formats:\n1. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate\n2. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}\n3. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/{crypto}/{fiat}\n4. https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/history/{crypto}/{fiat}\n\nValid cryptocurrencies: BTC, ETH, USDT, BNB, USDC, XRP, ADA, DOGE, LTC, SOL\nValid fiat currencies: CNY, USD, EUR, JPY, GBP, KRW, INR, CAD, HKD, BRL"
+func handleInvalidSource(err error) events.APIGatewayProxyResponse {
+	errorMessage := err.Error() + ". \nA source is a price provider such as " + ratestore.DefaultSource + ", the default. Compare the sources of a pair at https://main--euphonious-brioche-40b22d.netlify.app/.netlify/functions/rate/sources/{crypto}/{fiat}"
 
 	return events.APIGatewayProxyResponse{
-		StatusCode: http.StatusNotFound,
+		StatusCode: http.StatusBadRequest,
 		Headers:    map[string]string{"Content-Type": "text/plain"},
 		Body:       errorMessage,
 	}
@@ -258,79 +192,133 @@ func handleExchangeRateNotFound() events.APIGatewayProxyResponse {
 
 }
 
-func handleGetExchangeRate(splitPath []string) (events.APIGatewayProxyResponse, error) {
+// jsonHeaders returns the headers of a JSON response, identifying the snapshot
+// its rates come from.
+func jsonHeaders(snapshot ratestore.Snapshot) map[string]string {
+	headers := map[string]string{"Content-Type": "application/json"}
+	if snapshot.ID != 0 {
+		headers["X-Snapshot-Id"] = strconv.FormatInt(snapshot.ID, 10)
+		headers["X-Snapshot-Time"] = snapshot.TakenAt.Format(time.RFC3339Nano)
+		headers["X-Rate-Source"] = snapshot.Source
+	}
+	return headers
+}
+
+// withSymbols adds to headers the symbols a request was resolved to, which
+// differ from the requested ones for an alias or another case. fiat is empty
+// when the request names no fiat currency.
+func withSymbols(headers map[string]string, crypto, fiat string) map[string]string {
+	headers["X-Crypto-Symbol"] = crypto
+	if fiat != "" {
+		headers["X-Fiat-Symbol"] = fiat
+	}
+	return headers
+}
+
+// resolveSymbol resolves the requested symbol or alias of a currency of
+// currencyType. It returns the response to answer with instead if the currency
+// is unknown or disabled, or cannot be resolved.
+func resolveSymbol(db ratestore.RateStore, currencyType, symbol string) (string, *events.APIGatewayProxyResponse, error) {
+	resolve, handleUnknown := db.ResolveCryptoCurrency, handleInvalidCryptoCurrency
+	if currencyType == ratestore.CurrencyTypeFiat {
+		resolve, handleUnknown = db.ResolveFiatCurrency, handleInvalidFiatCurrency
+	}
+
+	resolved, err := resolve(symbol)
+	var response events.APIGatewayProxyResponse
+	switch {
+	case err == nil:
+		return resolved, nil, nil
+	case errors.Is(err, ratestore.ErrUnknownCurrency):
+		response, err = handleUnknown(), nil
+	case errors.Is(err, ratestore.ErrCurrencyDisabled):
+		response, err = handleDisabledCurrency(resolved), nil
+	default:
+		log.Printf("Error resolving %s currency: %v", currencyType, err)
+		response = events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}
+	}
+	return "", &response, err
+}
+
+// resolvePair resolves the crypto and fiat currencies of a request like
+// resolveSymbol.
+func resolvePair(db ratestore.RateStore, crypto, fiat string) (string, string, *events.APIGatewayProxyResponse, error) {
+	crypto, failed, err := resolveSymbol(db, ratestore.CurrencyTypeCrypto, crypto)
+	if failed != nil {
+		return "", "", failed, err
+	}
+	fiat, failed, err = resolveSymbol(db, ratestore.CurrencyTypeFiat, fiat)
+	if failed != nil {
+		return "", "", failed, err
+	}
+	return crypto, fiat, nil, nil
+}
+
+func handleGetExchangeRate(splitPath []string, source string) (events.APIGatewayProxyResponse, error) {
 	crypto := splitPath[4]
 	fiat := splitPath[5]
 
-	db, err := NewDatabase()
+	source, err := ratestore.ParseSource(source)
 	if err != nil {
-		log.Println("Error connecting to the database:", err)
-		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+		return handleInvalidSource(err), nil
 	}
-	defer db.Close()
-	cryptoExists, err := db.CheckCryptoCurrency(crypto)
-	if err != nil {
-		log.Println("Error checking if crypto currency exists:", err)
-		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
-	}
-	if !cryptoExists {
-		return handleInvalidCryptoCurrency(), nil
-	}
-	fiatExists, err := db.CheckFiatCurrency(fiat)
+
+	db, err := rateStore()
 	if err != nil {
-		log.Println("Error checking if fiat currency exists:", err)
+		log.Println("Error connecting to the database:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	if !fiatExists {
-		return handleInvalidFiatCurrency(), nil
+	crypto, fiat, failed, err := resolvePair(db, crypto, fiat)
+	if failed != nil {
+		return *failed, err
 	}
 
-	rate, err := db.GetExchangeRate(crypto, fiat)
+	rate, snapshot, err := db.GetExchangeRate(crypto, fiat, source)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			return handleExchangeRateNotFound(), nil
 		}
 		log.Println("Error retrieving exchange rate:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
 
-	response := CryptoResponse{Value: rate}
+	response := CryptoResponse{Crypto: crypto, Fiat: fiat, Value: rate, Snapshot: snapshot}
 	responseBody, _ := json.Marshal(response)
 	return events.APIGatewayProxyResponse{
 		StatusCode: http.StatusOK,
-		Headers:    map[string]string{"Content-Type": "application/json"},
+		Headers:    withSymbols(jsonHeaders(snapshot), crypto, fiat),
 		Body:       string(responseBody),
 	}, nil
 }
 
-func handleGetExchangeRatesForCrypto(splitPath []string) (events.APIGatewayProxyResponse, error) {
+func handleGetExchangeRatesForCrypto(splitPath []string, source string) (events.APIGatewayProxyResponse, error) {
 	crypto := splitPath[4]
 
-	db, err := NewDatabase()
+	source, err := ratestore.ParseSource(source)
 	if err != nil {
-		log.Println("Error connecting to the database:", err)
-		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+		return handleInvalidSource(err), nil
 	}
-	defer db.Close()
-	cryptoExists, err := db.CheckCryptoCurrency(crypto)
+
+	db, err := rateStore()
 	if err != nil {
-		log.Println("Error checking if crypto currency exists:", err)
+		log.Println("Error connecting to the database:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	if !cryptoExists {
-		return handleInvalidCryptoCurrency(), nil
+	crypto, failed, err := resolveSymbol(db, ratestore.CurrencyTypeCrypto, crypto)
+	if failed != nil {
+		return *failed, err
 	}
 
-	rates, err := db.GetExchangeRatesForCrypto(crypto)
+	rates, snapshot, err := db.GetExchangeRatesForCrypto(crypto, source)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			return handleExchangeRateNotFound(), nil
 		}
 		log.Println("Error retrieving exchange rates:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
 
-	response := make(map[string]float64)
+	response := make(map[string]decimal.Decimal)
 	for fiat, rate := range rates {
 		response[fiat] = rate
 	}
@@ -338,67 +326,109 @@ func handleGetExchangeRatesForCrypto(splitPath []string) (events.APIGatewayProxy
 	responseBody, _ := json.Marshal(response)
 	return events.APIGatewayProxyResponse{
 		StatusCode: http.StatusOK,
-		Headers:    map[string]string{"Content-Type": "application/json"},
+		Headers:    withSymbols(jsonHeaders(snapshot), crypto, ""),
 		Body:       string(responseBody),
 	}, nil
 }
 
-func handleGetHistoricalExchangeRates(splitPath []string) (events.APIGatewayProxyResponse, error) {
+func handleGetHistoricalExchangeRates(splitPath []string, period, source string) (events.APIGatewayProxyResponse, error) {
 	crypto := splitPath[5]
 	fiat := splitPath[6]
 
-	db, err := NewDatabase()
+	since := time.Now().Add(-ratestore.RawHistoryWindow)
+	if period != "" {
+		length, err := ratestore.ParsePeriod(period)
+		if err != nil {
+			return handleInvalidPeriod(err), nil
+		}
+		since = time.Now().Add(-length)
+	}
+
+	source, err := ratestore.ParseSource(source)
+	if err != nil {
+		return handleInvalidSource(err), nil
+	}
+	if source != ratestore.DefaultSource {
+		return handleInvalidSource(errors.New("history is only kept for the " + ratestore.DefaultSource + " source")), nil
+	}
+
+	db, err := rateStore()
 	if err != nil {
 		log.Println("Error connecting to the database:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	defer db.Close()
-	cryptoExists, err := db.CheckCryptoCurrency(crypto)
+	crypto, fiat, failed, err := resolvePair(db, crypto, fiat)
+	if failed != nil {
+		return *failed, err
+	}
+
+	rates, err := db.GetRateHistory(crypto, fiat, since)
 	if err != nil {
-		log.Println("Error checking if crypto currency exists:", err)
+		if errors.Is(err, ratestore.ErrNotFound) {
+			return handleExchangeRateNotFound(), nil
+		}
+		log.Println("Error retrieving historical exchange rates:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	if !cryptoExists {
-		return handleInvalidCryptoCurrency(), nil
-	}
-	fiatExists, err := db.CheckFiatCurrency(fiat)
+
+	response := HistoricalRateResponse{Crypto: crypto, Fiat: fiat, ExchangeRate: rates}
+	responseBody, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    withSymbols(map[string]string{"Content-Type": "application/json"}, crypto, fiat),
+		Body:       string(responseBody),
+	}, nil
+}
+
+// handleGetExchangeRateSources lists the latest rate of a pair from every
+// price source, so that the sources can be compared.
+func handleGetExchangeRateSources(splitPath []string) (events.APIGatewayProxyResponse, error) {
+	crypto := splitPath[5]
+	fiat := splitPath[6]
+
+	db, err := rateStore()
 	if err != nil {
-		log.Println("Error checking if fiat currency exists:", err)
+		log.Println("Error connecting to the database:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	if !fiatExists {
-		return handleInvalidFiatCurrency(), nil
+	crypto, fiat, failed, err := resolvePair(db, crypto, fiat)
+	if failed != nil {
+		return *failed, err
 	}
 
-	rates, err := db.GetHistoricalExchangeRates(crypto, fiat)
+	sources, err := db.GetExchangeRateSources(crypto, fiat)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			return handleExchangeRateNotFound(), nil
 		}
-		log.Println("Error retrieving historical exchange rates:", err)
+		log.Println("Error retrieving exchange rate sources:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
 
-	response := HistoricalRateResponse{ExchangeRate: rates}
+	response := SourcesResponse{Crypto: crypto, Fiat: fiat, Sources: sources}
 	responseBody, _ := json.Marshal(response)
 	return events.APIGatewayProxyResponse{
 		StatusCode: http.StatusOK,
-		Headers:    map[string]string{"Content-Type": "application/json"},
+		Headers:    withSymbols(map[string]string{"Content-Type": "application/json"}, crypto, fiat),
 		Body:       string(responseBody),
 	}, nil
 }
 
-func handleGetAllExchangeRates() (events.APIGatewayProxyResponse, error) {
-	db, err := NewDatabase()
+func handleGetAllExchangeRates(source string) (events.APIGatewayProxyResponse, error) {
+	source, err := ratestore.ParseSource(source)
+	if err != nil {
+		return handleInvalidSource(err), nil
+	}
+
+	db, err := rateStore()
 	if err != nil {
 		log.Println("Error connecting to the database:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	defer db.Close()
 
-	rates, err := db.GetAllExchangeRates()
+	rates, snapshot, err := db.GetAllExchangeRates(source)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, ratestore.ErrNotFound) {
 			return handleExchangeRateNotFound(), nil
 		}
 		log.Println("Error retrieving exchange rates:", err)
@@ -406,6 +436,42 @@ func handleGetAllExchangeRates() (events.APIGatewayProxyResponse, error) {
 	}
 
 	responseBody, _ := json.Marshal(rates)
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    jsonHeaders(snapshot),
+		Body:       string(responseBody),
+	}, nil
+}
+
+// handleGetCurrencies lists the supported currencies, of one type if
+// currencyType is not empty. Disabled currencies are added with
+// ?include_inactive=true.
+func handleGetCurrencies(currencyType, includeInactive string) (events.APIGatewayProxyResponse, error) {
+	if currencyType != "" && currencyType != ratestore.CurrencyTypeCrypto && currencyType != ratestore.CurrencyTypeFiat {
+		return handleInvalidCurrencyType(), nil
+	}
+	inactive := false
+	if includeInactive != "" {
+		var err error
+		inactive, err = strconv.ParseBool(includeInactive)
+		if err != nil {
+			return handleInvalidParameters(), nil
+		}
+	}
+
+	db, err := rateStore()
+	if err != nil {
+		log.Println("Error connecting to the database:", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	currencies, err := db.ListCurrencies(currencyType, inactive)
+	if err != nil {
+		log.Println("Error listing currencies:", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	responseBody, _ := json.Marshal(currencies)
 	return events.APIGatewayProxyResponse{
 		StatusCode: http.StatusOK,
 		Headers:    map[string]string{"Content-Type": "application/json"},
@@ -419,14 +485,20 @@ func HandleRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProx
 
 	if numParams > 7 {
 		return handleTooManyInvalidParameters(), nil
+	} else if numParams == 5 && splitPath[4] == "currencies" {
+		return handleGetCurrencies("", request.QueryStringParameters["include_inactive"])
+	} else if numParams == 6 && splitPath[4] == "currencies" {
+		return handleGetCurrencies(splitPath[5], request.QueryStringParameters["include_inactive"])
 	} else if numParams == 6 {
-		return handleGetExchangeRate(splitPath)
+		return handleGetExchangeRate(splitPath, request.QueryStringParameters["source"])
 	} else if numParams == 5 && splitPath[4] != "" {
-		return handleGetExchangeRatesForCrypto(splitPath)
+		return handleGetExchangeRatesForCrypto(splitPath, request.QueryStringParameters["source"])
 	} else if numParams == 7 && splitPath[4] == "history" && splitPath[5] != "" && splitPath[6] != "" {
-		return handleGetHistoricalExchangeRates(splitPath)
+		return handleGetHistoricalExchangeRates(splitPath, request.QueryStringParameters["period"], request.QueryStringParameters["source"])
+	} else if numParams == 7 && splitPath[4] == "sources" && splitPath[5] != "" && splitPath[6] != "" {
+		return handleGetExchangeRateSources(splitPath)
 	} else if numParams == 4 {
-		return handleGetAllExchangeRates()
+		return handleGetAllExchangeRates(request.QueryStringParameters["source"])
 	} else {
 		return handleInvalidParameters(), nil
 	}
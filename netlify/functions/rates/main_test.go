@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/shopspring/decimal"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// useTestDatabase points the function at a migrated SQLite database holding
+// the BTC/USD rate 30000, and resets its shared database and store. It
+// returns the path of the database.
+func useTestDatabase(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "rates.db")
+	t.Setenv("DB_DRIVER", ratestore.DriverSQLite)
+	t.Setenv("DB_DATABASE", path)
+	t.Setenv("CACHE_DRIVER", "")
+
+	db, err := ratestore.NewDatabase(ratestore.Config{Driver: ratestore.DriverSQLite, Database: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.SeedCurrencies([]ratestore.Currency{
+		{Symbol: "BTC", Name: "Bitcoin", Type: ratestore.CurrencyTypeCrypto},
+		{Symbol: "USD", Name: "US Dollar", Type: ratestore.CurrencyTypeFiat},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cryptoIDs, _ := db.GetCryptoMappings()
+	fiatIDs, _ := db.GetFiatMappings()
+	_, err = db.InsertExchangeRates([]ratestore.ExchangeRate{
+		{CryptoID: cryptoIDs["BTC"], FiatID: fiatIDs["USD"], Rate: decimal.RequireFromString("30000"), Timestamp: time.Now().UTC()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousDatabase, previousStore := database, store
+	database, store = ratestore.NewSharedDatabase(NewDatabase), nil
+	t.Cleanup(func() {
+		if store != nil {
+			store.Close()
+		}
+		database, store = previousDatabase, previousStore
+	})
+	return path
+}
+
+func TestRateStore(t *testing.T) {
+	useTestDatabase(t)
+
+	stores := make(chan ratestore.RateStore)
+	go func() {
+		for i := 0; i < 2; i++ {
+			s, err := rateStore()
+			if err != nil {
+				t.Error(err)
+			}
+			stores <- s
+		}
+	}()
+	var got []ratestore.RateStore
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-stores:
+			got = append(got, s)
+		case <-time.After(5 * time.Second):
+			t.Fatal("rateStore did not return")
+		}
+	}
+	if got[0] != got[1] {
+		t.Error("rateStore opened a second store")
+	}
+	if _, ok := got[0].(*ratestore.CachedStore); !ok {
+		t.Errorf("rateStore returned %T, want a *ratestore.CachedStore", got[0])
+	}
+}
+
+func TestHandleRequestServesCachedRates(t *testing.T) {
+	useTestDatabase(t)
+
+	for i := 0; i < 2; i++ {
+		response, err := HandleRequest(events.APIGatewayProxyRequest{Path: "/.netlify/functions/rate/BTC/USD"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != http.StatusOK || !strings.Contains(response.Body, `"value":"30000"`) {
+			t.Errorf("response %d: %d %s", i, response.StatusCode, response.Body)
+		}
+	}
+}
+
+func TestHandleRequestServesNewSnapshots(t *testing.T) {
+	path := useTestDatabase(t)
+
+	response, err := HandleRequest(events.APIGatewayProxyRequest{Path: "/.netlify/functions/rate/BTC/USD"})
+	if err != nil || !strings.Contains(response.Body, `"value":"30000"`) {
+		t.Fatalf("first response: %v %s", err, response.Body)
+	}
+
+	// A snapshot ingested by another process, such as updatetable.
+	other, err := ratestore.NewDatabase(ratestore.Config{Driver: ratestore.DriverSQLite, Database: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	cryptoIDs, _ := other.GetCryptoMappings()
+	fiatIDs, _ := other.GetFiatMappings()
+	_, err = other.InsertExchangeRates([]ratestore.ExchangeRate{
+		{CryptoID: cryptoIDs["BTC"], FiatID: fiatIDs["USD"], Rate: decimal.RequireFromString("31000"), Timestamp: time.Now().UTC().Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err = HandleRequest(events.APIGatewayProxyRequest{Path: "/.netlify/functions/rate/BTC/USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(response.Body, `"value":"31000"`) {
+		t.Errorf("the memory cache served the previous snapshot: %s", response.Body)
+	}
+}
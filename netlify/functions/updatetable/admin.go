@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+// authorizeAdmin reports whether request carries the admin bearer token of
+// the ADMIN_TOKEN variable, and returns the response to it otherwise. The
+// admin endpoints are disabled without the variable.
+func authorizeAdmin(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, bool) {
+	if ratestore.AuthorizeAdmin(requestHeader(request, "Authorization"), os.Getenv("ADMIN_TOKEN")) {
+		return events.APIGatewayProxyResponse{}, true
+	}
+	response := adminError(http.StatusUnauthorized, "A valid admin bearer token is required.")
+	response.Headers["WWW-Authenticate"] = "Bearer"
+	return response, false
+}
+
+// handleAdminCurrencies serves the currency admin endpoints, once the request
+// is authorized with authorizeAdmin:
+//
+//	POST   .../currencies                 adds the currency in the body
+//	PATCH  .../currencies/{type}/{symbol} enables or disables it with {"active": false}
+//	DELETE .../currencies/{type}/{symbol} removes a currency that has no rates
+//
+// args are the path segments after currencies. Changes are picked up by the
+// next ingestion run.
+func handleAdminCurrencies(db *ratestore.Database, request events.APIGatewayProxyRequest, args []string) (events.APIGatewayProxyResponse, error) {
+	switch {
+	case len(args) == 0 && request.HTTPMethod == http.MethodPost:
+		return handleAddCurrency(db, request.Body)
+	case len(args) == 2 && args[0] != ratestore.CurrencyTypeCrypto && args[0] != ratestore.CurrencyTypeFiat:
+		return adminError(http.StatusNotFound, "Unknown currency type "+args[0]+", expected crypto or fiat."), nil
+	case len(args) == 2 && request.HTTPMethod == http.MethodPatch:
+		return handleSetCurrencyActive(db, args[0], args[1], request.Body)
+	case len(args) == 2 && request.HTTPMethod == http.MethodDelete:
+		return handleRemoveCurrency(db, args[0], args[1])
+	default:
+		return adminError(http.StatusNotFound, "Valid admin requests:\n1. POST .../currencies\n2. PATCH .../currencies/{type}/{symbol}\n3. DELETE .../currencies/{type}/{symbol}"), nil
+	}
+}
+
+func handleAddCurrency(db *ratestore.Database, body string) (events.APIGatewayProxyResponse, error) {
+	var c ratestore.Currency
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return adminError(http.StatusBadRequest, "Invalid currency: "+err.Error()+"."), nil
+	}
+	if err := ratestore.ValidateCurrencies([]ratestore.Currency{c}); err != nil {
+		return adminError(http.StatusBadRequest, err.Error()+"."), nil
+	}
+
+	added, err := db.AddCurrency(c)
+	if err != nil {
+		return adminErrorFor(err)
+	}
+	log.Printf("Admin added %s currency %s", added.Type, added.Symbol)
+
+	return adminJSON(http.StatusCreated, added), nil
+}
+
+func handleSetCurrencyActive(db *ratestore.Database, currencyType, symbol, body string) (events.APIGatewayProxyResponse, error) {
+	var change struct {
+		Active *bool `json:"active"`
+	}
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&change); err != nil || change.Active == nil {
+		return adminError(http.StatusBadRequest, `The body must be {"active": true} or {"active": false}.`), nil
+	}
+
+	c, err := db.SetCurrencyActive(currencyType, symbol, *change.Active)
+	if err != nil {
+		return adminErrorFor(err)
+	}
+	log.Printf("Admin set %s currency %s active=%t", currencyType, symbol, c.Active)
+
+	return adminJSON(http.StatusOK, c), nil
+}
+
+func handleRemoveCurrency(db *ratestore.Database, currencyType, symbol string) (events.APIGatewayProxyResponse, error) {
+	if err := db.RemoveCurrency(currencyType, symbol); err != nil {
+		return adminErrorFor(err)
+	}
+	log.Printf("Admin removed %s currency %s", currencyType, symbol)
+
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusNoContent}, nil
+}
+
+// adminErrorFor returns the response matching an error of the currency
+// administration.
+func adminErrorFor(err error) (events.APIGatewayProxyResponse, error) {
+	switch {
+	case errors.Is(err, ratestore.ErrNotFound):
+		return adminError(http.StatusNotFound, "Currency not found."), nil
+	case errors.Is(err, ratestore.ErrCurrencyExists):
+		return adminError(http.StatusConflict, "The currency already exists; enable it with PATCH if it is disabled."), nil
+	case errors.Is(err, ratestore.ErrCurrencyInUse):
+		return adminError(http.StatusConflict, "The currency has exchange rates and cannot be removed; disable it instead."), nil
+	default:
+		log.Println("Error changing currencies:", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+}
+
+func adminError(status int, message string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       message,
+	}
+}
+
+func adminJSON(status int, c ratestore.Currency) events.APIGatewayProxyResponse {
+	responseBody, _ := json.Marshal(c)
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseBody),
+	}
+}
+
+// requestHeader returns the header name of request, whose header names may
+// have been lower-cased on the way.
+func requestHeader(request events.APIGatewayProxyRequest, name string) string {
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
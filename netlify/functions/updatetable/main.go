@@ -1,201 +1,142 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"time"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/sushant-iitp/hellogo/ratestore"
 )
 
-// Database represents the MySQL database connection
-type Database struct {
-	DB *sql.DB
-}
-
-// CryptoResponse represents the response from the API
-type CryptoResponse struct {
-	Symbol string             `json:"symbol"`
-	Rates  map[string]float64 `json:"rates"`
-}
-
-// ExchangeRate represents the exchange rate data to be inserted into the database
-type ExchangeRate struct {
-	CryptoID  int       `json:"cryptocurrency_id"`
-	FiatID    int       `json:"fiat_currency_id"`
-	Rate      float64   `json:"rate"`
-	Timestamp time.Time `json:"timestamp"`
-}
-
-// APIResponse represents the response from the API
-type APIResponse map[string]map[string]float64
-
 func main() {
 	lambda.Start(HandleRequest)
 }
 
-func HandleRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	db, err := NewDatabase()
-	if err != nil {
-		log.Println("Error connecting to the database:", err)
-		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+// HandleRequest runs the ingestion when the path is the function's own, lists
+// the recorded ingestion runs when it continues with /runs, or changes the
+// currencies when it continues with /currencies. Both require the admin
+// bearer token, and the other paths are not found.
+func HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// The path is /.netlify/functions/updatetable followed by args.
+	var args []string
+	if splitPath := strings.Split(strings.Trim(request.Path, "/"), "/"); len(splitPath) > 3 {
+		args = splitPath[3:]
+	}
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && args[0] == "runs", args[0] == "currencies":
+		if response, ok := authorizeAdmin(request); !ok {
+			return response, nil
+		}
+	default:
+		return adminError(http.StatusNotFound, "Valid requests:\n1. .../updatetable\n2. GET .../updatetable/runs\n3. .../updatetable/currencies"), nil
 	}
-	defer db.DB.Close()
 
-	apiURL := "https://min-api.cryptocompare.com/data/pricemulti?fsyms=BTC,ETH,USDT,BNB,USDC,XRP,ADA,DOGE,LTC,SOL&tsyms=CNY,USD,EUR,JPY,GBP,KRW,INR,CAD,HKD,BRL"
-	response, err := http.Get(apiURL)
+	db, err := database.Get()
 	if err != nil {
-		log.Println("API call failed:", err)
+		log.Println("Error connecting to the database:", err)
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode == http.StatusOK {
-		var apiResp APIResponse
-		err := json.NewDecoder(response.Body).Decode(&apiResp)
-		if err != nil {
-			log.Println("Error decoding API response:", err)
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
-		}
-
-		var exchangeRates []ExchangeRate
-		cryptoMappings, err := db.GetCryptoMappings()
-		if err != nil {
-			log.Println("Error fetching crypto mappings:", err)
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
-		}
-
-		fiatMappings, err := db.GetFiatMappings()
-		if err != nil {
-			log.Println("Error fetching fiat mappings:", err)
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
-		}
-
-		timestamp := time.Now().UTC()
-
-		for cryptoSymbol, rates := range apiResp {
-			cryptoID := cryptoMappings[cryptoSymbol]
-			if cryptoID != 0 {
-				for fiatSymbol, rate := range rates {
-					fiatID := fiatMappings[fiatSymbol]
-					if fiatID != 0 {
-						exchangeRates = append(exchangeRates, ExchangeRate{
-							CryptoID:  cryptoID,
-							FiatID:    fiatID,
-							Rate:      rate,
-							Timestamp: timestamp,
-						})
-					}
-				}
-			}
-		}
-
-		err = db.InsertExchangeRates(exchangeRates)
-		if err != nil {
-			log.Println("Error inserting exchange rates:", err)
-			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
-		}
+	switch {
+	case len(args) == 0:
+		return handleIngest(ctx, db)
+	case args[0] == "runs":
+		return handleListRuns(db, request.QueryStringParameters["limit"])
+	default:
+		return handleAdminCurrencies(db, request, args[1:])
+	}
+}
 
-		return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+// handleIngest runs the ingestion and returns its result.
+func handleIngest(ctx context.Context, db *ratestore.Database) (events.APIGatewayProxyResponse, error) {
+	ingester := &ratestore.Ingester{DB: db}
+	result, err := ingester.Ingest(ctx)
+	if err != nil {
+		log.Printf("Error updating exchange rates in run %d: %v", result.RunID, err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
 
-	log.Println("API call failed with status code:", response.StatusCode)
-	return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, fmt.Errorf("API call failed with status code: %d", response.StatusCode)
+	log.Printf("Run %d inserted %d of %d exchange rates", result.RunID, result.Rates, result.Requested)
+	responseBody, _ := json.Marshal(result)
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseBody),
+	}, nil
 }
 
-// NewDatabase creates a new Database instance with a connection pool.
-func NewDatabase() (*Database, error) {
-	dbHost := os.Getenv("DB_HOST")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_DATABASE")
-
-	connString := fmt.Sprintf("%s:%s@tcp(%s)/%s", dbUser, dbPassword, dbHost, dbName)
-	db, err := sql.Open("mysql", connString)
+// handleListRuns lists the latest recorded ingestion runs, newest first.
+func handleListRuns(db *ratestore.Database, limitParam string) (events.APIGatewayProxyResponse, error) {
+	limit, err := ratestore.ParseRunLimit(limitParam)
 	if err != nil {
-		return nil, err
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+			Headers:    map[string]string{"Content-Type": "text/plain"},
+			Body:       "Invalid ingestion run limit: " + err.Error() + ".",
+		}, nil
 	}
 
-	// Set a maximum connection pool size appropriate for your application's needs.
-	db.SetMaxOpenConns(10)
-
-	err = db.Ping()
+	runs, err := db.ListIngestionRuns(limit)
 	if err != nil {
-		return nil, err
+		log.Println("Error listing ingestion runs:", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
 	}
 
-	return &Database{DB: db}, nil
+	responseBody, _ := json.Marshal(runs)
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(responseBody),
+	}, nil
 }
 
-// GetCryptoMappings fetches the symbol-ID mappings for cryptocurrencies from the database.
-func (d *Database) GetCryptoMappings() (map[string]int, error) {
-	query := "SELECT symbol, cryptocurrency_id FROM Cryptocurrencies"
-	rows, err := d.DB.Query(query)
+// database is shared by every invocation served by this function instance, so
+// the connection pool outlives a single run.
+var database = ratestore.NewSharedDatabase(NewDatabase)
+
+// NewDatabase creates a new Database instance with a connection pool sized by
+// the DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_LIFETIME variables.
+func NewDatabase() (*ratestore.Database, error) {
+	cfg, err := ratestore.ConfigFromEnv()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	mappings := make(map[string]int)
-	for rows.Next() {
-		var symbol string
-		var id int
-		if err := rows.Scan(&symbol, &id); err != nil {
-			return nil, err
-		}
-		mappings[symbol] = id
-	}
-
-	return mappings, nil
-}
-
-// GetFiatMappings fetches the symbol-ID mappings for fiat currencies from the database.
-func (d *Database) GetFiatMappings() (map[string]int, error) {
-	query := "SELECT symbol, fiat_currency_id FROM FiatCurrencies"
-	rows, err := d.DB.Query(query)
+	db, err := ratestore.NewDatabase(cfg)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	mappings := make(map[string]int)
-	for rows.Next() {
-		var symbol string
-		var id int
-		if err := rows.Scan(&symbol, &id); err != nil {
-			return nil, err
-		}
-		mappings[symbol] = id
+	if err := invalidateCacheOnChange(db); err != nil {
+		db.Close()
+		return nil, err
 	}
-
-	return mappings, nil
+	return db, nil
 }
 
-// InsertExchangeRates inserts the exchange rates into the database.
-func (d *Database) InsertExchangeRates(rates []ExchangeRate) error {
-	if len(rates) == 0 {
-		return nil
-	}
-
-	query := "INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?, ?, ?, ?)"
-	stmt, err := d.DB.Prepare(query)
+// invalidateCacheOnChange purges the Redis cache of the rates function, when
+// CACHE_DRIVER selects one, every time the latest rates change. A memory cache
+// lives in the instances of the rates function and expires on its own.
+func invalidateCacheOnChange(db *ratestore.Database) error {
+	cfg, err := ratestore.CacheConfigFromEnv()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-
-	for _, rate := range rates {
-		_, err := stmt.Exec(rate.CryptoID, rate.FiatID, rate.Rate, rate.Timestamp)
-		if err != nil {
-			return err
-		}
+	if cfg.Driver != ratestore.CacheDriverRedis {
+		return nil
 	}
-
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid cache configuration: %w", err)
+	}
+	cache := ratestore.NewRedisCache(cfg)
+	db.OnChange(func() {
+		if err := cache.Purge(); err != nil {
+			log.Println("Error invalidating the rate cache:", err)
+		}
+	})
 	return nil
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/sushant-iitp/hellogo/ratestore"
+)
+
+const testAdminToken = "0123456789abcdef"
+
+// useTestDatabase points the function at a migrated, empty SQLite database,
+// and resets its shared database.
+func useTestDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.db")
+	t.Setenv("DB_DRIVER", ratestore.DriverSQLite)
+	t.Setenv("DB_DATABASE", path)
+	t.Setenv("CACHE_DRIVER", "")
+	t.Setenv("ADMIN_TOKEN", testAdminToken)
+
+	db, err := ratestore.NewDatabase(ratestore.Config{Driver: ratestore.DriverSQLite, Database: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database
+	database = ratestore.NewSharedDatabase(NewDatabase)
+	t.Cleanup(func() {
+		if db, err := database.Get(); err == nil {
+			db.Close()
+		}
+		database = previous
+	})
+}
+
+func TestHandleRequestRoutes(t *testing.T) {
+	useTestDatabase(t)
+
+	for _, test := range []struct {
+		path, authorization string
+		status              int
+	}{
+		{"/.netlify/functions/updatetable/runs", "", http.StatusUnauthorized},
+		{"/.netlify/functions/updatetable/runs", "Bearer wrong-token-of-16-bytes", http.StatusUnauthorized},
+		{"/.netlify/functions/updatetable/runs/", "Bearer " + testAdminToken, http.StatusOK},
+		{"/.netlify/functions/updatetable/currencies", "", http.StatusUnauthorized},
+		{"/.netlify/functions/updatetable/unknown", "Bearer " + testAdminToken, http.StatusNotFound},
+		{"/.netlify/functions/updatetable/runs/1", "Bearer " + testAdminToken, http.StatusNotFound},
+	} {
+		response, err := HandleRequest(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: http.MethodGet,
+			Path:       test.path,
+			Headers:    map[string]string{"Authorization": test.authorization},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.path, response.StatusCode, test.status, response.Body)
+		}
+	}
+
+	db, err := database.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := db.ListIngestionRuns(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 0 {
+		t.Errorf("%d ingestion runs, want none: only the function's own path ingests", len(runs))
+	}
+}
@@ -0,0 +1,22 @@
+package ratestore
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+// MinAdminTokenLength is the length below which an admin token is rejected as
+// too easy to guess.
+const MinAdminTokenLength = 16
+
+// AuthorizeAdmin reports whether the Authorization header of a request to an
+// admin endpoint carries the bearer token. It always fails when token is
+// shorter than MinAdminTokenLength, so the admin endpoints are disabled until
+// a token is configured.
+func AuthorizeAdmin(authorization, token string) bool {
+	if len(token) < MinAdminTokenLength || !strings.HasPrefix(authorization, "Bearer ") {
+		return false
+	}
+	given := strings.TrimPrefix(authorization, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
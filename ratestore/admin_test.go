@@ -0,0 +1,16 @@
+package ratestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizeAdmin(t *testing.T) {
+	assert.True(t, AuthorizeAdmin("Bearer s3cret-admin-token", "s3cret-admin-token"))
+	assert.False(t, AuthorizeAdmin("Bearer wrong", "s3cret-admin-token"))
+	assert.False(t, AuthorizeAdmin("s3cret-admin-token", "s3cret-admin-token"))
+	assert.False(t, AuthorizeAdmin("", "s3cret-admin-token"))
+	assert.False(t, AuthorizeAdmin("Bearer ", ""))
+	assert.False(t, AuthorizeAdmin("Bearer short", "short"))
+}
@@ -0,0 +1,137 @@
+package ratestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NormalizeSymbol returns symbol in the form currencies are stored in: upper
+// case and without surrounding spaces.
+func NormalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// ResolveCryptoCurrency returns the symbol of the cryptocurrency that symbol
+// names, in any case and either as its symbol or as one of its aliases. It
+// returns ErrUnknownCurrency if there is none, and the symbol with
+// ErrCurrencyDisabled if the cryptocurrency is disabled.
+func (d *Database) ResolveCryptoCurrency(symbol string) (string, error) {
+	table, _ := currencyTableFor(CurrencyTypeCrypto)
+	return d.resolveCurrency(d.readQueryRow, table, symbol)
+}
+
+// ResolveFiatCurrency returns the symbol of the fiat currency that symbol
+// names, like ResolveCryptoCurrency.
+func (d *Database) ResolveFiatCurrency(symbol string) (string, error) {
+	table, _ := currencyTableFor(CurrencyTypeFiat)
+	return d.resolveCurrency(d.readQueryRow, table, symbol)
+}
+
+// resolveCurrency resolves symbol to a currency of table with queryRow, which
+// is queryRow or readQueryRow. A currency symbol takes precedence over an
+// alias.
+func (d *Database) resolveCurrency(queryRow func(string, ...interface{}) *sql.Row, table currencyTable,
+	symbol string) (string, error) {
+	symbol = NormalizeSymbol(symbol)
+
+	var resolved string
+	var active bool
+	var viaAlias int
+	err := queryRow(`
+	SELECT symbol, active, 0 AS via_alias FROM `+table.table+` WHERE symbol = ?
+	UNION ALL
+	SELECT c.symbol, c.active, 1 AS via_alias
+	FROM CurrencyAliases a
+	JOIN `+table.table+` c ON c.symbol = a.symbol
+	WHERE a.currency_type = ? AND a.alias = ?
+	ORDER BY via_alias
+	LIMIT 1
+	`, symbol, table.currencyType, symbol).Scan(&resolved, &active, &viaAlias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s currency %s: %w", table.currencyType, symbol, ErrUnknownCurrency)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !active {
+		return resolved, fmt.Errorf("%s currency %s: %w", table.currencyType, resolved, ErrCurrencyDisabled)
+	}
+	return resolved, nil
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadAliases returns the aliases of the currencies of table, keyed by
+// currency symbol and sorted.
+func (d *Database) loadAliases(q querier, table currencyTable) (map[string][]string, error) {
+	rows, err := q.Query(d.dialect.rebind("SELECT alias, symbol FROM CurrencyAliases WHERE currency_type = ? ORDER BY alias"),
+		table.currencyType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[string][]string)
+	for rows.Next() {
+		var alias, symbol string
+		if err := rows.Scan(&alias, &symbol); err != nil {
+			return nil, err
+		}
+		aliases[symbol] = append(aliases[symbol], alias)
+	}
+	return aliases, rows.Err()
+}
+
+// replaceAliases makes the aliases of the currencies in changed match their
+// Aliases. The aliases are removed before any is added, so that an alias can
+// move from one currency to another.
+func (d *Database) replaceAliases(tx *sql.Tx, table currencyTable, changed []Currency) error {
+	for _, c := range changed {
+		if _, err := tx.Exec(d.dialect.rebind("DELETE FROM CurrencyAliases WHERE currency_type = ? AND symbol = ?"),
+			table.currencyType, c.Symbol); err != nil {
+			return err
+		}
+	}
+	for _, c := range changed {
+		for _, alias := range c.Aliases {
+			if _, err := tx.Exec(d.dialect.rebind("DELETE FROM CurrencyAliases WHERE currency_type = ? AND alias = ?"),
+				table.currencyType, alias); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(d.dialect.rebind("INSERT INTO CurrencyAliases (currency_type, alias, symbol) VALUES (?, ?, ?)"),
+				table.currencyType, alias, c.Symbol); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sameCurrency reports whether a and b are equal, in any order of their
+// aliases.
+func sameCurrency(a, b Currency) bool {
+	aliasesA, aliasesB := sortedAliases(a.Aliases), sortedAliases(b.Aliases)
+	if len(aliasesA) != len(aliasesB) {
+		return false
+	}
+	for i := range aliasesA {
+		if aliasesA[i] != aliasesB[i] {
+			return false
+		}
+	}
+	return a.Symbol == b.Symbol && a.Name == b.Name && a.Type == b.Type && a.Decimals == b.Decimals &&
+		a.ISONumeric == b.ISONumeric && a.Chain == b.Chain && a.ContractAddress == b.ContractAddress &&
+		a.Active == b.Active
+}
+
+func sortedAliases(aliases []string) []string {
+	sorted := append([]string(nil), aliases...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,122 @@
+package ratestore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeSymbol(t *testing.T) {
+	assert.Equal(t, "BTC", NormalizeSymbol(" btc "))
+	assert.Equal(t, "USD", NormalizeSymbol("USD"))
+}
+
+func TestDatabaseResolveCurrency(t *testing.T) {
+	db := newTestDatabase(t)
+	_, err := db.SeedCurrencies([]Currency{
+		{Symbol: "BTC", Name: "Bitcoin", Type: CurrencyTypeCrypto, Decimals: 8, Aliases: []string{"XBT"}},
+		{Symbol: "ETH", Name: "Ethereum", Type: CurrencyTypeCrypto, Decimals: 18},
+		{Symbol: "CNY", Name: "Chinese Yuan", Type: CurrencyTypeFiat, Decimals: 2, Aliases: []string{"RMB"}},
+	}, false)
+	require.NoError(t, err)
+
+	for _, symbol := range []string{"BTC", "btc", "XBT", "xbt"} {
+		resolved, err := db.ResolveCryptoCurrency(symbol)
+		assert.NoError(t, err, symbol)
+		assert.Equal(t, "BTC", resolved, symbol)
+	}
+	resolved, err := db.ResolveFiatCurrency("rmb")
+	assert.NoError(t, err)
+	assert.Equal(t, "CNY", resolved)
+
+	_, err = db.ResolveCryptoCurrency("RMB")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+	_, err = db.ResolveFiatCurrency("XBT")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	exists, err := db.CheckCryptoCurrency("xbt")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// USD is not in the manifest and is disabled by the seed.
+	resolved, err = db.ResolveFiatCurrency("usd")
+	assert.ErrorIs(t, err, ErrCurrencyDisabled)
+	assert.Equal(t, "USD", resolved)
+}
+
+func TestSeedCurrenciesAliases(t *testing.T) {
+	db := newTestDatabase(t)
+	btc := Currency{Symbol: "BTC", Name: "Bitcoin", Type: CurrencyTypeCrypto, Decimals: 8, Aliases: []string{"XBT"}}
+	eth := Currency{Symbol: "ETH", Name: "Ethereum", Type: CurrencyTypeCrypto, Decimals: 18}
+
+	report, err := db.SeedCurrencies([]Currency{btc, eth}, false)
+	require.NoError(t, err)
+	assert.Len(t, report.Updated, 2)
+
+	report, err = db.SeedCurrencies([]Currency{btc, eth}, false)
+	require.NoError(t, err)
+	assert.Equal(t, SeedReport{}, report)
+
+	// The alias moves from BTC to ETH.
+	btc.Aliases, eth.Aliases = nil, []string{"WETH", "XBT"}
+	report, err = db.SeedCurrencies([]Currency{btc, eth}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Currency{btc, eth}, report.Updated)
+
+	resolved, err := db.ResolveCryptoCurrency("XBT")
+	assert.NoError(t, err)
+	assert.Equal(t, "ETH", resolved)
+
+	currencies, err := db.ListCurrencies(CurrencyTypeCrypto, false)
+	require.NoError(t, err)
+	require.Len(t, currencies, 2)
+	assert.Empty(t, currencies[0].Aliases)
+	assert.Equal(t, []string{"WETH", "XBT"}, currencies[1].Aliases)
+}
+
+func TestValidateCurrenciesAliases(t *testing.T) {
+	err := ValidateCurrencies([]Currency{
+		{Symbol: "BTC", Name: "Bitcoin", Type: CurrencyTypeCrypto, Aliases: []string{"xbt", "BTC"}},
+		{Symbol: "ETH", Name: "Ethereum", Type: CurrencyTypeCrypto, Aliases: []string{"WETH", "BTC"}},
+		{Symbol: "WBTC", Name: "Wrapped Bitcoin", Type: CurrencyTypeCrypto, Aliases: []string{"WETH"}},
+		{Symbol: "CNY", Name: "Chinese Yuan", Type: CurrencyTypeFiat, Aliases: []string{"WETH"}},
+	})
+	require.Error(t, err)
+	for _, problem := range []string{
+		"currency BTC: alias xbt must be upper case",
+		"currency BTC: alias BTC is its own symbol",
+		"currency ETH: alias BTC is the symbol of another currency",
+		"currency WBTC: alias WETH is already an alias of ETH",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+	assert.NotContains(t, err.Error(), "currency CNY")
+}
+
+func TestAddCurrencyAliasConflict(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := db.AddCurrency(Currency{Symbol: "WBTC", Name: "Wrapped Bitcoin", Type: CurrencyTypeCrypto, Aliases: []string{"BTC"}})
+	assert.ErrorIs(t, err, ErrCurrencyExists)
+
+	_, err = db.AddCurrency(Currency{Symbol: "WBTC", Name: "Wrapped Bitcoin", Type: CurrencyTypeCrypto, Aliases: []string{"BTCB"}})
+	require.NoError(t, err)
+	resolved, err := db.ResolveCryptoCurrency("btcb")
+	assert.NoError(t, err)
+	assert.Equal(t, "WBTC", resolved)
+
+	// A symbol that is already an alias of another currency, even a disabled
+	// one, is rejected too.
+	_, err = db.SetCurrencyActive(CurrencyTypeCrypto, "WBTC", false)
+	require.NoError(t, err)
+	_, err = db.AddCurrency(Currency{Symbol: "BTCB", Name: "Binance Bitcoin", Type: CurrencyTypeCrypto})
+	assert.ErrorIs(t, err, ErrCurrencyExists)
+	assert.EqualError(t, err, "crypto currency BTCB, an alias of WBTC: currency already exists")
+	_, err = db.SetCurrencyActive(CurrencyTypeCrypto, "WBTC", true)
+	require.NoError(t, err)
+
+	require.NoError(t, db.RemoveCurrency(CurrencyTypeCrypto, "WBTC"))
+	_, err = db.ResolveCryptoCurrency("BTCB")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
@@ -0,0 +1,193 @@
+package ratestore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrInvalidArchive is returned for an archive that cannot be imported
+// because of its contents.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ArchivedRate is a raw exchange rate as it is exported to and imported from
+// an archive, with the symbols of its pair instead of their IDs, so that it can
+// be imported into any database.
+type ArchivedRate struct {
+	Crypto    string
+	Fiat      string
+	Rate      decimal.Decimal
+	Timestamp time.Time
+	Source    string
+}
+
+// ImportResult describes the work done by ImportExchangeRates.
+type ImportResult struct {
+	// Rates counts the rates read and Snapshots the snapshots they were
+	// stored in. Replayed counts the rates of the batches that were already
+	// stored, which were skipped.
+	Rates     int `json:"rates"`
+	Snapshots int `json:"snapshots"`
+	Replayed  int `json:"replayed"`
+}
+
+// ExportExchangeRates calls fn with the raw exchange rates of every source
+// with a timestamp from from up to to, archived partitions included, in the
+// order of their timestamp, and returns the number of rates exported. It stops at the first error of fn.
+func (d *Database) ExportExchangeRates(from, to time.Time, fn func(ArchivedRate) error) (int, error) {
+	query := `
+	SELECT c.symbol AS crypto, f.symbol AS fiat, er.rate, er.timestamp, er.source
+	FROM ` + ratesPlaceholder + ` er
+	JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
+	JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
+	WHERE er.timestamp >= ? AND er.timestamp < ?
+	`
+	tables, err := d.rateTables(from, to, true)
+	if err != nil {
+		return 0, err
+	}
+	query, args := unionRates(query, tables, []interface{}{from.UTC(), to.UTC()})
+	rows, err := d.query(query+" ORDER BY timestamp, source, crypto, fiat", args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	exported := 0
+	for rows.Next() {
+		var rate ArchivedRate
+		if err := rows.Scan(&rate.Crypto, &rate.Fiat, &rate.Rate, &rate.Timestamp, &rate.Source); err != nil {
+			return exported, err
+		}
+		rate.Timestamp = rate.Timestamp.UTC()
+		if err := fn(rate); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+	return exported, rows.Err()
+}
+
+// ImportExchangeRates stores the archived rates returned by next until it
+// returns io.EOF. The consecutive rates with the same timestamp and source are
+// stored as one snapshot with InsertExchangeRates, so an export imports as the
+// batches it was ingested in, and an archive imported twice is only stored
+// once. The currencies of the rates must exist, enabled or not, and their
+// sources be valid.
+//
+// Every batch is stored in its own transaction: the batches before a failed
+// one stay stored, and the import can be run again once the error is fixed.
+// The functions registered with OnChange are called once, when the import
+// ends, if a batch it stored is served.
+//
+// Once every batch is stored, the hourly and daily rollups of the completed
+// buckets covering the imported rates of DefaultSource are recomputed, so
+// that their history is served past RawHistoryWindow and kept once the raw
+// rates are pruned.
+func (d *Database) ImportExchangeRates(next func() (ArchivedRate, error)) (ImportResult, error) {
+	var result ImportResult
+	var first, last time.Time
+	served := false
+	defer func() {
+		if served {
+			d.changed()
+		}
+	}()
+
+	cryptoIDs, err := d.symbolMappings("SELECT symbol, cryptocurrency_id FROM Cryptocurrencies")
+	if err != nil {
+		return result, fmt.Errorf("fetching crypto mappings: %w", err)
+	}
+	fiatIDs, err := d.symbolMappings("SELECT symbol, fiat_currency_id FROM FiatCurrencies")
+	if err != nil {
+		return result, fmt.Errorf("fetching fiat mappings: %w", err)
+	}
+
+	var batch []ExchangeRate
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		snapshot, latest, err := d.insertSnapshot(batch)
+		if err != nil {
+			return fmt.Errorf("importing the rates of %s: %w", batch[0].Timestamp.Format(time.RFC3339Nano), err)
+		}
+		served = served || latest
+		if snapshot.ID == 0 {
+			result.Replayed += len(batch)
+		} else {
+			result.Snapshots++
+		}
+		if batch[0].Source == DefaultSource {
+			if first.IsZero() || batch[0].Timestamp.Before(first) {
+				first = batch[0].Timestamp
+			}
+			if batch[0].Timestamp.After(last) {
+				last = batch[0].Timestamp
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		archived, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Rates++
+
+		rate := ExchangeRate{
+			CryptoID:  cryptoIDs[NormalizeSymbol(archived.Crypto)],
+			FiatID:    fiatIDs[NormalizeSymbol(archived.Fiat)],
+			Rate:      archived.Rate,
+			Timestamp: archived.Timestamp.UTC(),
+		}
+		if rate.Source, err = ParseSource(archived.Source); err != nil {
+			return result, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if rate.CryptoID == 0 {
+			return result, fmt.Errorf("crypto currency %s: %w", archived.Crypto, ErrUnknownCurrency)
+		}
+		if rate.FiatID == 0 {
+			return result, fmt.Errorf("fiat currency %s: %w", archived.Fiat, ErrUnknownCurrency)
+		}
+
+		if len(batch) > 0 && (!batch[0].Timestamp.Equal(rate.Timestamp) || batch[0].Source != rate.Source) {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+		batch = append(batch, rate)
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	if first.IsZero() {
+		return result, nil
+	}
+	return result, d.rollupImported(first, last, time.Now().UTC())
+}
+
+// rollupImported recomputes the completed hourly and daily buckets before now
+// covering the rates imported between first and last. The hourly buckets are
+// merged into the stored ones rather than replaced, since the raw rates they
+// were rolled up from may have been pruned since.
+func (d *Database) rollupImported(first, last, now time.Time) error {
+	for _, level := range []rollupLevel{hourlyRollup, dailyRollup} {
+		end := last.Truncate(level.size).Add(level.size)
+		if limit := now.Truncate(level.size); limit.Before(end) {
+			end = limit
+		}
+		if _, err := d.rollupBetween(level, first.Truncate(level.size), end, !level.raw); err != nil {
+			return fmt.Errorf("rolling up the imported rates into %s: %w", level.table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package ratestore
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archiveReader returns the next function of ImportExchangeRates for rates.
+func archiveReader(rates []ArchivedRate) func() (ArchivedRate, error) {
+	return func() (ArchivedRate, error) {
+		if len(rates) == 0 {
+			return ArchivedRate{}, io.EOF
+		}
+		rate := rates[0]
+		rates = rates[1:]
+		return rate, nil
+	}
+}
+
+func TestDatabaseExportImportExchangeRates(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC().Truncate(DefaultRateBucket)
+	_, err := db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("30150.12"), Timestamp: now.Add(-time.Hour)},
+		{CryptoID: 2, FiatID: 2, Rate: dec("153000"), Timestamp: now.Add(-time.Hour)},
+	})
+	require.NoError(t, err)
+	_, err = db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("30149.8"), Timestamp: now.Add(-time.Hour), Source: "kraken"},
+	})
+	require.NoError(t, err)
+	insertTestRate(t, db, 1, 2, "2487686.4", now)
+
+	var exported []ArchivedRate
+	n, err := db.ExportExchangeRates(now.Add(-2*time.Hour), now, func(rate ArchivedRate) error {
+		exported = append(exported, rate)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []ArchivedRate{
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("30150.12"), Timestamp: now.Add(-time.Hour), Source: DefaultSource},
+		{Crypto: "ETH", Fiat: "INR", Rate: dec("153000"), Timestamp: now.Add(-time.Hour), Source: DefaultSource},
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("30149.8"), Timestamp: now.Add(-time.Hour), Source: "kraken"},
+	}, exported)
+
+	other := newTestDatabase(t)
+	changes := 0
+	other.OnChange(func() { changes++ })
+	result, err := other.ImportExchangeRates(archiveReader(exported))
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Rates: 3, Snapshots: 2}, result)
+	assert.Equal(t, 1, changes, "an import notifies once, not once per snapshot")
+
+	rate, _, err := other.GetExchangeRate("ETH", "INR", "")
+	assert.NoError(t, err)
+	assert.Equal(t, dec("153000"), rate)
+	rate, _, err = other.GetExchangeRate("BTC", "USD", "kraken")
+	assert.NoError(t, err)
+	assert.Equal(t, dec("30149.8"), rate)
+
+	// Importing the same archive again stores nothing.
+	result, err = other.ImportExchangeRates(archiveReader(exported))
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Rates: 3, Replayed: 3}, result)
+	assert.Equal(t, 1, changes)
+	var stored int
+	require.NoError(t, other.DB.QueryRow("SELECT COUNT(*) FROM ExchangeRates").Scan(&stored))
+	assert.Equal(t, 3, stored)
+}
+
+func TestDatabaseImportExchangeRatesUnknownCurrency(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := db.ImportExchangeRates(archiveReader([]ArchivedRate{
+		{Crypto: "DOGE", Fiat: "USD", Rate: dec("0.07"), Timestamp: time.Now()},
+	}))
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = db.ImportExchangeRates(archiveReader([]ArchivedRate{
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("30000"), Timestamp: time.Now(), Source: "kraken; drop"},
+	}))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+}
+
+func TestDatabaseImportExchangeRatesRollsUp(t *testing.T) {
+	db := newTestDatabase(t)
+	hour := time.Now().UTC().Add(-72 * time.Hour).Truncate(time.Hour)
+
+	result, err := db.ImportExchangeRates(archiveReader([]ArchivedRate{
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("30000"), Timestamp: hour, Source: DefaultSource},
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("30100"), Timestamp: hour.Add(10 * time.Minute), Source: DefaultSource},
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("99999"), Timestamp: hour.Add(20 * time.Minute), Source: "kraken"},
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("30200"), Timestamp: hour.Add(time.Hour), Source: DefaultSource},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Rates)
+
+	hourly := queryCandles(t, db, "HourlyRates")
+	require.Len(t, hourly, 2)
+	assert.Equal(t, 2, hourly[0].samples, "only the rates of the default source are rolled up")
+	assert.Equal(t, "30100", hourly[0].close.String())
+	assert.NotEmpty(t, queryCandles(t, db, "DailyRates"))
+
+	history, err := db.GetRateHistory("BTC", "USD", hour.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, history, 2, "the history past the raw window includes the imported rates")
+	assert.Equal(t, "30100", history[0].Value.String())
+	assert.Equal(t, hour.Format(time.RFC3339Nano), history[0].Timestamp)
+	assert.Equal(t, "30200", history[1].Value.String())
+}
@@ -0,0 +1,343 @@
+package ratestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Resolutions of a backfill: hourly candles are stored in HourlyRates and
+// daily ones in DailyRates.
+const (
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+)
+
+// DefaultHistoryURL is the base of the CryptoCompare endpoints returning the
+// hourly (histohour) and daily (histoday) prices of a pair.
+const DefaultHistoryURL = "https://min-api.cryptocompare.com/data/v2"
+
+// DefaultBackfillPageSize is the number of candles asked from the history API
+// per call, the most it returns.
+const DefaultBackfillPageSize = 2000
+
+// BackfillRequest selects the history to backfill.
+type BackfillRequest struct {
+	// Cryptos and Fiats are the symbols of the pairs to backfill, every
+	// active currency of the type if empty.
+	Cryptos []string
+	Fiats   []string
+	// From and To bound the buckets to backfill. They are aligned to the
+	// resolution, and To is capped at the last bucket completed.
+	From, To   time.Time
+	Resolution string
+}
+
+// BackfillResult describes the work done by Backfill.
+type BackfillResult struct {
+	Pairs int `json:"pairs"`
+	// Resumed counts the pairs that continued an earlier backfill of the same
+	// range.
+	Resumed int `json:"resumed"`
+	Pages   int `json:"pages"`
+	// Buckets counts the candles received, which are stored unless their
+	// bucket was rolled up from ingested rates.
+	Buckets int `json:"buckets"`
+	// DailyBuckets counts the daily rollups recomputed from the backfilled
+	// hours.
+	DailyBuckets int `json:"daily_buckets"`
+}
+
+// Backfiller fills the hourly or daily rollups of pairs from the history of
+// the price API, so that pairs get a history before the rates ingested since
+// they were added. It is used by the backfill command of cryptolocal.
+type Backfiller struct {
+	DB *Database
+	// Client is used for the API calls, or http.DefaultClient if nil.
+	Client *http.Client
+	// HistoryURL is the base of the history endpoints, or DefaultHistoryURL
+	// if empty.
+	HistoryURL string
+	// PageSize is the number of candles asked per call, or
+	// DefaultBackfillPageSize if zero or larger.
+	PageSize int
+}
+
+// historyResponse is the response of the history API.
+type historyResponse struct {
+	Response string `json:"Response"`
+	Message  string `json:"Message"`
+	Data     struct {
+		Data []historyCandle `json:"Data"`
+	} `json:"Data"`
+}
+
+// historyCandle is a bucket of the history API, starting at Time in Unix
+// seconds.
+type historyCandle struct {
+	Time  int64           `json:"time"`
+	Open  decimal.Decimal `json:"open"`
+	High  decimal.Decimal `json:"high"`
+	Low   decimal.Decimal `json:"low"`
+	Close decimal.Decimal `json:"close"`
+}
+
+// Backfill stores the candles of the history API for every requested pair
+// between From and To, one page per transaction. Backfilled candles have no
+// samples, and never replace a bucket rolled up from ingested rates, while the
+// rollup replaces them, so a backfill can run at any time and as often as
+// needed. The progress of every pair is stored with its pages: a backfill of
+// the same pairs and start that failed or was interrupted resumes after the
+// last page stored, and one that completed only fetches the buckets after its
+// previous end.
+//
+// An hourly backfill then recomputes the daily rollups of the complete days it
+// covers.
+func (b *Backfiller) Backfill(ctx context.Context, req BackfillRequest) (BackfillResult, error) {
+	var result BackfillResult
+
+	level, _, err := backfillLevel(req.Resolution)
+	if err != nil {
+		return result, err
+	}
+	from := req.From.UTC().Truncate(level.size)
+	end := req.To.UTC().Truncate(level.size)
+	if limit := time.Now().UTC().Truncate(level.size); limit.Before(end) {
+		end = limit
+	}
+	if !from.Before(end) {
+		return result, fmt.Errorf("nothing to backfill between %s and %s", from.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	cryptos, err := b.DB.backfillCurrencies(CurrencyTypeCrypto, req.Cryptos)
+	if err != nil {
+		return result, err
+	}
+	fiats, err := b.DB.backfillCurrencies(CurrencyTypeFiat, req.Fiats)
+	if err != nil {
+		return result, err
+	}
+
+	for _, crypto := range cryptos {
+		for _, fiat := range fiats {
+			result.Pairs++
+			if err := b.backfillPair(ctx, req.Resolution, crypto, fiat, from, end, &result); err != nil {
+				return result, fmt.Errorf("backfilling %s/%s: %w", crypto.Symbol, fiat.Symbol, err)
+			}
+		}
+	}
+
+	if req.Resolution == ResolutionHour {
+		result.DailyBuckets, err = b.DB.rollupBetween(dailyRollup, from.Truncate(dailyRollup.size), end.Truncate(dailyRollup.size), true)
+		if err != nil {
+			return result, fmt.Errorf("rolling up daily rates: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// backfillLevel returns the rollup level and history endpoint of resolution.
+func backfillLevel(resolution string) (rollupLevel, string, error) {
+	switch resolution {
+	case ResolutionHour:
+		return hourlyRollup, "histohour", nil
+	case ResolutionDay:
+		return dailyRollup, "histoday", nil
+	}
+	return rollupLevel{}, "", fmt.Errorf("invalid resolution %q, expected %s or %s", resolution, ResolutionHour, ResolutionDay)
+}
+
+// backfillCurrency is a currency a backfill fetches the history of.
+type backfillCurrency struct {
+	ID     int
+	Symbol string
+}
+
+// backfillCurrencies returns the active currencies of currencyType named by
+// symbols, or all of them by symbol if symbols is empty.
+func (d *Database) backfillCurrencies(currencyType string, symbols []string) ([]backfillCurrency, error) {
+	var mappings map[string]int
+	var err error
+	if currencyType == CurrencyTypeCrypto {
+		mappings, err = d.GetCryptoMappings()
+	} else {
+		mappings, err = d.GetFiatMappings()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(symbols) == 0 {
+		symbols = sortedSymbols(mappings)
+	}
+	currencies := make([]backfillCurrency, 0, len(symbols))
+	for _, symbol := range symbols {
+		symbol = NormalizeSymbol(symbol)
+		id, ok := mappings[symbol]
+		if !ok {
+			return nil, fmt.Errorf("%s currency %s: %w", currencyType, symbol, ErrUnknownCurrency)
+		}
+		currencies = append(currencies, backfillCurrency{ID: id, Symbol: symbol})
+	}
+	if len(currencies) == 0 {
+		return nil, fmt.Errorf("no active %s currencies to backfill", currencyType)
+	}
+	return currencies, nil
+}
+
+// backfillPair stores the candles of one pair from its progress, or from, up
+// to end.
+func (b *Backfiller) backfillPair(ctx context.Context, resolution string, crypto, fiat backfillCurrency,
+	from, end time.Time, result *BackfillResult) error {
+	level, endpoint, err := backfillLevel(resolution)
+	if err != nil {
+		return err
+	}
+	cursor, resumed, err := b.DB.backfillProgress(crypto.ID, fiat.ID, resolution, from)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		result.Resumed++
+	}
+
+	pageSize := b.PageSize
+	if pageSize <= 0 || pageSize > DefaultBackfillPageSize {
+		pageSize = DefaultBackfillPageSize
+	}
+
+	for cursor.Before(end) {
+		last := cursor.Add(time.Duration(pageSize-1) * level.size)
+		if !last.Before(end) {
+			last = end.Add(-level.size)
+		}
+
+		// The API returns the limit+1 buckets up to last, so the page asks
+		// for one more bucket than it covers, dropped below, rather than for
+		// a limit of 0, which the API does not take, for a single bucket.
+		limit := int(last.Sub(cursor)/level.size) + 1
+		if limit < 1 {
+			limit = 1
+		} else if limit > DefaultBackfillPageSize {
+			limit = DefaultBackfillPageSize
+		}
+		history, err := b.fetch(ctx, endpoint, crypto.Symbol, fiat.Symbol, last, limit)
+		if err != nil {
+			return err
+		}
+		result.Pages++
+
+		var candles []candle
+		for _, h := range history {
+			bucketStart := time.Unix(h.Time, 0).UTC()
+			// The API returns zero prices before the pair was traded.
+			if bucketStart.Before(cursor) || bucketStart.After(last) || h.Close.IsZero() {
+				continue
+			}
+			candles = append(candles, candle{
+				cryptoID: crypto.ID, fiatID: fiat.ID, bucketStart: bucketStart,
+				open: h.Open, high: h.High, low: h.Low, close: h.Close,
+			})
+		}
+
+		cursor = last.Add(level.size)
+		if err := b.DB.storeBackfillPage(level, candles, crypto.ID, fiat.ID, resolution, from, cursor); err != nil {
+			return err
+		}
+		result.Buckets += len(candles)
+	}
+	return nil
+}
+
+// backfillProgress returns where the backfill of a pair at resolution
+// starting at from is to continue, and whether an earlier backfill got there.
+func (d *Database) backfillProgress(cryptoID, fiatID int, resolution string, from time.Time) (time.Time, bool, error) {
+	var next time.Time
+	err := d.queryRow(`
+	SELECT next_start FROM BackfillProgress
+	WHERE cryptocurrency_id = ? AND fiat_currency_id = ? AND resolution = ? AND range_start = ?
+	`, cryptoID, fiatID, resolution, from).Scan(&next)
+	if errors.Is(err, sql.ErrNoRows) {
+		return from, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return next.UTC(), true, nil
+}
+
+// storeBackfillPage writes the candles of a page and the progress of its pair
+// in one transaction.
+func (d *Database) storeBackfillPage(level rollupLevel, candles []candle, cryptoID, fiatID int, resolution string,
+	from, next time.Time) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := d.insertCandles(tx, level, candles); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(d.dialect.rebind(`
+	INSERT INTO BackfillProgress (cryptocurrency_id, fiat_currency_id, resolution, range_start, next_start, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)`+d.dialect.upsert("BackfillProgress",
+		[]string{"cryptocurrency_id", "fiat_currency_id", "resolution", "range_start"}, []string{"updated_at"}, "next_start", ">")),
+		cryptoID, fiatID, resolution, from, next, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// fetch calls the history endpoint for the limit+1 buckets of a pair up to
+// the one starting at last.
+func (b *Backfiller) fetch(ctx context.Context, endpoint, crypto, fiat string, last time.Time, limit int) ([]historyCandle, error) {
+	historyURL := b.HistoryURL
+	if historyURL == "" {
+		historyURL = DefaultHistoryURL
+	}
+	client := b.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	query := url.Values{
+		"fsym":  {crypto},
+		"tsym":  {fiat},
+		"limit": {strconv.Itoa(limit)},
+		"toTs":  {strconv.FormatInt(last.Unix(), 10)},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, historyURL+"/"+endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("API call failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API call failed with status code: %d", response.StatusCode)
+	}
+
+	var history historyResponse
+	if err := json.NewDecoder(response.Body).Decode(&history); err != nil {
+		return nil, fmt.Errorf("decoding API response: %w", err)
+	}
+	if history.Response != "Success" {
+		return nil, fmt.Errorf("API call failed: %s", history.Message)
+	}
+	return history.Data.Data, nil
+}
@@ -0,0 +1,209 @@
+package ratestore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHistory serves the history API. The prices of a bucket are its start in
+// Unix hours, and zero before listed.
+type fakeHistory struct {
+	listed time.Time
+	// failCall makes the call with this number, from 1, fail.
+	failCall int
+	calls    []url.Values
+}
+
+func (f *fakeHistory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls = append(f.calls, r.URL.Query())
+	if len(f.calls) == f.failCall {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	size := int64(3600)
+	if r.URL.Path == "/histoday" {
+		size = 24 * 3600
+	}
+	limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	toTs, _ := strconv.ParseInt(r.URL.Query().Get("toTs"), 10, 64)
+
+	var data []map[string]interface{}
+	for ts := toTs - limit*size; ts <= toTs; ts += size {
+		price := ts / 3600
+		if ts < f.listed.Unix() {
+			price = 0
+		}
+		data = append(data, map[string]interface{}{"time": ts, "open": price, "high": price, "low": price, "close": price})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"Response": "Success", "Data": map[string]interface{}{"Data": data}})
+}
+
+func newTestBackfiller(t *testing.T, db *Database, history *fakeHistory) *Backfiller {
+	server := httptest.NewServer(history)
+	t.Cleanup(server.Close)
+	return &Backfiller{DB: db, HistoryURL: server.URL}
+}
+
+func TestBackfillerBackfill(t *testing.T) {
+	db := newTestDatabase(t)
+	from := time.Now().UTC().Truncate(24 * time.Hour).Add(-3 * 24 * time.Hour)
+	history := &fakeHistory{listed: from.Add(time.Hour)}
+	backfiller := newTestBackfiller(t, db, history)
+	backfiller.PageSize = 4
+
+	request := BackfillRequest{Cryptos: []string{"btc"}, Fiats: []string{"USD"}, From: from, To: from.Add(6 * time.Hour), Resolution: ResolutionHour}
+	result, err := backfiller.Backfill(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, BackfillResult{Pairs: 1, Pages: 2, Buckets: 5}, result)
+	assert.Equal(t, "4", history.calls[0].Get("limit"))
+	assert.Equal(t, strconv.FormatInt(from.Add(3*time.Hour).Unix(), 10), history.calls[0].Get("toTs"))
+
+	hour := dec(strconv.FormatInt(from.Add(time.Hour).Unix()/3600, 10))
+	candles := queryCandles(t, db, "HourlyRates")
+	require.Len(t, candles, 5)
+	assert.Equal(t, candle{1, 1, from.Add(time.Hour), hour, hour, hour, hour, 0}, candles[0])
+
+	// The same backfill again has nothing left to fetch, and a later end only
+	// fetches the buckets after the previous one.
+	result, err = backfiller.Backfill(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, BackfillResult{Pairs: 1, Resumed: 1}, result)
+
+	request.To = from.Add(8 * time.Hour)
+	result, err = backfiller.Backfill(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, BackfillResult{Pairs: 1, Resumed: 1, Pages: 1, Buckets: 2}, result)
+	assert.Len(t, queryCandles(t, db, "HourlyRates"), 7)
+
+	rates, err := db.GetRateHistory("BTC", "USD", from)
+	assert.NoError(t, err)
+	assert.Len(t, rates, 7)
+}
+
+func TestBackfillerBackfillSingleBucket(t *testing.T) {
+	db := newTestDatabase(t)
+	from := time.Now().UTC().Truncate(24 * time.Hour).Add(-3 * 24 * time.Hour)
+	history := &fakeHistory{}
+	backfiller := newTestBackfiller(t, db, history)
+
+	result, err := backfiller.Backfill(context.Background(), BackfillRequest{
+		Cryptos: []string{"BTC"}, Fiats: []string{"USD"}, From: from, To: from.Add(time.Hour), Resolution: ResolutionHour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, BackfillResult{Pairs: 1, Pages: 1, Buckets: 1}, result)
+	assert.Equal(t, "1", history.calls[0].Get("limit"))
+	assert.Equal(t, strconv.FormatInt(from.Unix(), 10), history.calls[0].Get("toTs"))
+	candles := queryCandles(t, db, "HourlyRates")
+	require.Len(t, candles, 1)
+	assert.Equal(t, from, candles[0].bucketStart)
+}
+
+func TestBackfillerServesRecentHistory(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC()
+	from := now.Truncate(time.Hour).Add(-23 * time.Hour)
+
+	backfiller := newTestBackfiller(t, db, &fakeHistory{})
+	result, err := backfiller.Backfill(context.Background(), BackfillRequest{
+		Cryptos: []string{"ETH"}, Fiats: []string{"USD"}, From: from, To: now, Resolution: ResolutionHour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 23, result.Buckets)
+
+	// The pair has no raw rates yet, so its last 24 hours are read from the
+	// backfilled hourly rollups.
+	rates, err := db.GetHistoricalExchangeRates("ETH", "USD")
+	require.NoError(t, err)
+	require.Len(t, rates, 23)
+	assert.Equal(t, from.Format(time.RFC3339Nano), rates[0].Timestamp)
+	assert.Equal(t, strconv.FormatInt(from.Unix()/3600, 10), rates[0].Value.String())
+
+	insertTestRate(t, db, 2, 1, "1800", now)
+	rates, err = db.GetHistoricalExchangeRates("ETH", "USD")
+	require.NoError(t, err)
+	require.Len(t, rates, 1, "the raw rates are served once there are any")
+	assert.Equal(t, "1800", rates[0].Value.String())
+}
+
+func TestBackfillerBackfillResumes(t *testing.T) {
+	db := newTestDatabase(t)
+	from := time.Now().UTC().Truncate(24 * time.Hour).Add(-10 * 24 * time.Hour)
+	history := &fakeHistory{failCall: 2}
+	backfiller := newTestBackfiller(t, db, history)
+	backfiller.PageSize = 2
+
+	request := BackfillRequest{Cryptos: []string{"BTC"}, Fiats: []string{"USD"}, From: from, To: from.Add(5 * 24 * time.Hour), Resolution: ResolutionDay}
+	_, err := backfiller.Backfill(context.Background(), request)
+	assert.EqualError(t, err, "backfilling BTC/USD: API call failed with status code: 502")
+	assert.Len(t, queryCandles(t, db, "DailyRates"), 2)
+
+	history.failCall = 0
+	history.calls = nil
+	result, err := backfiller.Backfill(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, BackfillResult{Pairs: 1, Resumed: 1, Pages: 2, Buckets: 3}, result)
+	assert.Equal(t, strconv.FormatInt(from.Add(3*24*time.Hour).Unix(), 10), history.calls[0].Get("toTs"))
+	assert.Len(t, queryCandles(t, db, "DailyRates"), 5)
+}
+
+func TestBackfillerKeepsRollups(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour).Add(-2 * 24 * time.Hour)
+	insertTestRate(t, db, 1, 1, "10", day.Add(10*time.Minute))
+	insertTestRate(t, db, 1, 1, "30", now)
+	_, err := db.Rollup(now)
+	require.NoError(t, err)
+
+	backfiller := newTestBackfiller(t, db, &fakeHistory{})
+	result, err := backfiller.Backfill(context.Background(), BackfillRequest{
+		Cryptos: []string{"BTC", "ETH"}, Fiats: []string{"USD"}, From: day, To: day.Add(24 * time.Hour), Resolution: ResolutionHour,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, BackfillResult{Pairs: 2, Pages: 2, Buckets: 48, DailyBuckets: 2}, result)
+
+	// The bucket rolled up from ingested rates is kept, and the rollup keeps
+	// the backfilled ones.
+	_, err = db.Rollup(now)
+	require.NoError(t, err)
+	candles := queryCandles(t, db, "HourlyRates")
+	assert.Equal(t, candle{1, 1, day, dec("10"), dec("10"), dec("10"), dec("10"), 1}, candles[0])
+	assert.Equal(t, 0, candles[1].samples)
+
+	var backfilled int
+	require.NoError(t, db.DB.QueryRow("SELECT COUNT(*) FROM HourlyRates WHERE samples = 0").Scan(&backfilled))
+	assert.Equal(t, 47, backfilled)
+
+	// The daily rollup of the day takes in both.
+	daily := queryCandles(t, db, "DailyRates")
+	require.Len(t, daily, 2)
+	assert.Equal(t, dec("10"), daily[0].open)
+	assert.Equal(t, 1, daily[0].samples)
+	assert.Equal(t, 2, daily[1].cryptoID)
+	assert.Equal(t, 0, daily[1].samples)
+}
+
+func TestBackfillerInvalidRequest(t *testing.T) {
+	db := newTestDatabase(t)
+	backfiller := newTestBackfiller(t, db, &fakeHistory{})
+	from := time.Now().UTC().Add(-48 * time.Hour)
+
+	_, err := backfiller.Backfill(context.Background(), BackfillRequest{From: from, To: from.Add(time.Hour), Resolution: "minute"})
+	assert.EqualError(t, err, `invalid resolution "minute", expected hour or day`)
+
+	_, err = backfiller.Backfill(context.Background(), BackfillRequest{Cryptos: []string{"DOGE"}, From: from, To: from.Add(time.Hour), Resolution: ResolutionHour})
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = backfiller.Backfill(context.Background(), BackfillRequest{From: from, To: from, Resolution: ResolutionHour})
+	assert.Error(t, err)
+}
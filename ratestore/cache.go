@@ -0,0 +1,351 @@
+package ratestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// minCacheTTL is the shortest time a latest rate is cached for, so that the
+// rates of a late ingestion are still cached, if briefly.
+const minCacheTTL = 5 * time.Second
+
+// cacheRetryInterval is how long a CachedStore reads past its cache after the
+// cache failed.
+const cacheRetryInterval = 5 * time.Second
+
+// Cache is an expiring key-value store a CachedStore reads through.
+type Cache interface {
+	// Generation returns the current generation of the cache, which Purge
+	// bumps. The keys of a CachedStore include it, so that the entries of an
+	// earlier generation are never read again.
+	Generation() (int64, error)
+	// Get returns the value of key, and whether it is cached.
+	Get(key string) ([]byte, bool, error)
+	// Set caches value under key for ttl.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Purge invalidates every entry and bumps the generation.
+	Purge() error
+	// Close releases the resources held by the cache.
+	Close() error
+}
+
+// NewCache returns the Cache selected by cfg, or nil for CacheDriverNone.
+func NewCache(cfg CacheConfig) (Cache, error) {
+	cfg = cfg.withDefaults()
+	switch cfg.Driver {
+	case CacheDriverMemory:
+		return NewLRUCache(cfg.Size), nil
+	case CacheDriverRedis:
+		return NewRedisCache(cfg), nil
+	case CacheDriverNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported cache driver %q", cfg.Driver)
+}
+
+// CachedStore is a RateStore reading the latest rates, and the resolution of
+// the currency symbols and aliases every request starts with, through a
+// Cache. The other queries, the history and the listings, are passed to the
+// underlying store.
+//
+// A latest rate is cached until the next snapshot of its source is expected,
+// its snapshot time plus the TTL, which should be the ingestion interval, and
+// a resolution for the TTL. Invalidate drops both as soon as a new snapshot
+// is ingested or the currencies change. While the cache fails, they are read
+// from the underlying store.
+type CachedStore struct {
+	RateStore
+	cache Cache
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	failedAt time.Time
+
+	// version, if set, is read before every cached read, and the cache is
+	// purged when it differs from seen.
+	version func() (int64, error)
+	seen    int64
+
+	// now returns the current time, used for the TTL of the entries.
+	now func() time.Time
+}
+
+// cachedRates is a cache entry of a CachedStore.
+type cachedRates struct {
+	Rate     decimal.Decimal                       `json:"rate,omitempty"`
+	Rates    map[string]decimal.Decimal            `json:"rates,omitempty"`
+	AllRates map[string]map[string]decimal.Decimal `json:"all_rates,omitempty"`
+	Snapshot Snapshot                              `json:"snapshot"`
+	Currency *cachedCurrency                       `json:"currency,omitempty"`
+}
+
+// cachedCurrency is the resolution of a currency symbol: the symbol it
+// resolves to, and the message and kind of the error it resolves with, if
+// any.
+type cachedCurrency struct {
+	Symbol   string `json:"symbol,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Unknown  bool   `json:"unknown,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// cachedCurrencyError is a cached ErrUnknownCurrency or ErrCurrencyDisabled,
+// with the message of the error it was cached from.
+type cachedCurrencyError struct {
+	message string
+	err     error
+}
+
+func (e cachedCurrencyError) Error() string { return e.message }
+func (e cachedCurrencyError) Unwrap() error { return e.err }
+
+var _ RateStore = (*CachedStore)(nil)
+
+// NewCachedStore returns store reading its latest rates through cache, with
+// entries expiring ttl after their snapshot.
+func NewCachedStore(store RateStore, cache Cache, ttl time.Duration) *CachedStore {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &CachedStore{RateStore: store, cache: cache, ttl: ttl, now: time.Now}
+}
+
+// Invalidate drops every cached rate.
+func (s *CachedStore) Invalidate() error {
+	if err := s.cache.Purge(); err != nil {
+		s.failed()
+		return err
+	}
+	return nil
+}
+
+// InvalidateOnVersion makes the store read version, such as the
+// LatestSnapshotID of its database, before every read through the cache, and
+// invalidate the cache whenever it changed. It is how a cache that no OnChange
+// reaches, such as the memory cache of a process that does not ingest, drops
+// the rates replaced by the ingestions of another process at once rather than
+// when they expire. It must be called before the store is used.
+func (s *CachedStore) InvalidateOnVersion(version func() (int64, error)) {
+	s.version = version
+	s.seen = -1
+}
+
+// checkVersion invalidates the cache if the version changed since the last
+// read, and reports whether the cache can be read.
+func (s *CachedStore) checkVersion() bool {
+	if s.version == nil {
+		return true
+	}
+	version, err := s.version()
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	changed := version != s.seen
+	s.mu.Unlock()
+	if !changed {
+		return true
+	}
+	if s.Invalidate() != nil {
+		return false
+	}
+	s.mu.Lock()
+	s.seen = version
+	s.mu.Unlock()
+	return true
+}
+
+// Close closes the cache and the underlying store.
+func (s *CachedStore) Close() error {
+	cacheErr := s.cache.Close()
+	if err := s.RateStore.Close(); err != nil {
+		return err
+	}
+	return cacheErr
+}
+
+// CheckCryptoCurrency reports whether crypto names a cryptocurrency, like the
+// underlying store.
+func (s *CachedStore) CheckCryptoCurrency(crypto string) (bool, error) {
+	_, err := s.ResolveCryptoCurrency(crypto)
+	return checkResolved(err)
+}
+
+// CheckFiatCurrency reports whether fiat names a fiat currency, like the
+// underlying store.
+func (s *CachedStore) CheckFiatCurrency(fiat string) (bool, error) {
+	_, err := s.ResolveFiatCurrency(fiat)
+	return checkResolved(err)
+}
+
+// ResolveCryptoCurrency returns the symbol of the cryptocurrency crypto names,
+// like the underlying store.
+func (s *CachedStore) ResolveCryptoCurrency(crypto string) (string, error) {
+	return s.resolve(CurrencyTypeCrypto, crypto, s.RateStore.ResolveCryptoCurrency)
+}
+
+// ResolveFiatCurrency returns the symbol of the fiat currency fiat names, like
+// the underlying store.
+func (s *CachedStore) ResolveFiatCurrency(fiat string) (string, error) {
+	return s.resolve(CurrencyTypeFiat, fiat, s.RateStore.ResolveFiatCurrency)
+}
+
+// resolve resolves symbol, a currency of currencyType, through the cache with
+// load. An unknown or disabled currency is cached like a resolved one; the
+// other errors are not.
+func (s *CachedStore) resolve(currencyType, symbol string, load func(string) (string, error)) (string, error) {
+	var entry cachedRates
+	err := s.read("currency:"+currencyType+":"+NormalizeSymbol(symbol), &entry, func() error {
+		resolved, err := load(symbol)
+		c := &cachedCurrency{
+			Symbol:   resolved,
+			Unknown:  errors.Is(err, ErrUnknownCurrency),
+			Disabled: errors.Is(err, ErrCurrencyDisabled),
+		}
+		if !c.Unknown && !c.Disabled && err != nil {
+			return err
+		}
+		if err != nil {
+			c.Error = err.Error()
+		}
+		entry.Currency = c
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if entry.Currency == nil {
+		return load(symbol)
+	}
+	switch c := entry.Currency; {
+	case c.Unknown:
+		return c.Symbol, cachedCurrencyError{c.Error, ErrUnknownCurrency}
+	case c.Disabled:
+		return c.Symbol, cachedCurrencyError{c.Error, ErrCurrencyDisabled}
+	}
+	return entry.Currency.Symbol, nil
+}
+
+// GetExchangeRate returns the latest rate of crypto in fiat from source, like
+// the underlying store.
+func (s *CachedStore) GetExchangeRate(crypto, fiat, source string) (decimal.Decimal, Snapshot, error) {
+	var entry cachedRates
+	err := s.read("rate:"+cacheSource(source)+":"+crypto+":"+fiat, &entry, func() error {
+		var err error
+		entry.Rate, entry.Snapshot, err = s.RateStore.GetExchangeRate(crypto, fiat, source)
+		return err
+	})
+	return entry.Rate, entry.Snapshot, err
+}
+
+// GetExchangeRatesForCrypto returns the latest rates of crypto from source,
+// like the underlying store.
+func (s *CachedStore) GetExchangeRatesForCrypto(crypto, source string) (map[string]decimal.Decimal, Snapshot, error) {
+	var entry cachedRates
+	err := s.read("crypto:"+cacheSource(source)+":"+crypto, &entry, func() error {
+		var err error
+		entry.Rates, entry.Snapshot, err = s.RateStore.GetExchangeRatesForCrypto(crypto, source)
+		return err
+	})
+	if err == nil && entry.Rates == nil {
+		entry.Rates = make(map[string]decimal.Decimal)
+	}
+	return entry.Rates, entry.Snapshot, err
+}
+
+// GetAllExchangeRates returns the latest rate of every pair from source, like
+// the underlying store.
+func (s *CachedStore) GetAllExchangeRates(source string) (map[string]map[string]decimal.Decimal, Snapshot, error) {
+	var entry cachedRates
+	err := s.read("all:"+cacheSource(source), &entry, func() error {
+		var err error
+		entry.AllRates, entry.Snapshot, err = s.RateStore.GetAllExchangeRates(source)
+		return err
+	})
+	if err == nil && entry.AllRates == nil {
+		entry.AllRates = make(map[string]map[string]decimal.Decimal)
+	}
+	return entry.AllRates, entry.Snapshot, err
+}
+
+// read decodes the entry of key into entry, or fills entry with load and
+// caches it. The errors of load are returned and not cached.
+func (s *CachedStore) read(key string, entry *cachedRates, load func() error) error {
+	if !s.available() || !s.checkVersion() {
+		return load()
+	}
+
+	generation, err := s.cache.Generation()
+	if err != nil {
+		s.failed()
+		return load()
+	}
+	key = strconv.FormatInt(generation, 10) + ":" + key
+	value, ok, err := s.cache.Get(key)
+	if err != nil {
+		s.failed()
+		return load()
+	}
+	if ok && json.Unmarshal(value, entry) == nil {
+		return nil
+	}
+
+	if err := load(); err != nil {
+		return err
+	}
+	ttl := s.ttl
+	if entry.Currency == nil {
+		ttl = s.entryTTL(entry.Snapshot)
+	}
+	if value, err := json.Marshal(entry); err == nil {
+		if s.cache.Set(key, value, ttl) != nil {
+			s.failed()
+		}
+	}
+	return nil
+}
+
+// entryTTL returns how long the rates of snapshot are cached for: until the
+// TTL has passed since the snapshot was taken, when the next one is expected.
+func (s *CachedStore) entryTTL(snapshot Snapshot) time.Duration {
+	if snapshot.TakenAt.IsZero() {
+		return minCacheTTL
+	}
+	ttl := snapshot.TakenAt.Add(s.ttl).Sub(s.now())
+	if ttl < minCacheTTL {
+		return minCacheTTL
+	}
+	if ttl > s.ttl {
+		return s.ttl
+	}
+	return ttl
+}
+
+// available reports whether the cache did not fail in the last
+// cacheRetryInterval.
+func (s *CachedStore) available() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now().Sub(s.failedAt) >= cacheRetryInterval
+}
+
+// failed skips the cache for cacheRetryInterval.
+func (s *CachedStore) failed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failedAt = s.now()
+}
+
+// cacheSource returns the source of the cache keys of source.
+func cacheSource(source string) string {
+	if source == "" {
+		return DefaultSource
+	}
+	return source
+}
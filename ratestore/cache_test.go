@@ -0,0 +1,280 @@
+package ratestore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts the latest-rate queries and currency resolutions
+// reaching the store.
+type countingStore struct {
+	RateStore
+	reads    int
+	resolves int
+}
+
+func (s *countingStore) ResolveCryptoCurrency(crypto string) (string, error) {
+	s.resolves++
+	return s.RateStore.ResolveCryptoCurrency(crypto)
+}
+
+func (s *countingStore) ResolveFiatCurrency(fiat string) (string, error) {
+	s.resolves++
+	return s.RateStore.ResolveFiatCurrency(fiat)
+}
+
+func (s *countingStore) GetExchangeRate(crypto, fiat, source string) (decimal.Decimal, Snapshot, error) {
+	s.reads++
+	return s.RateStore.GetExchangeRate(crypto, fiat, source)
+}
+
+func (s *countingStore) GetExchangeRatesForCrypto(crypto, source string) (map[string]decimal.Decimal, Snapshot, error) {
+	s.reads++
+	return s.RateStore.GetExchangeRatesForCrypto(crypto, source)
+}
+
+func (s *countingStore) GetAllExchangeRates(source string) (map[string]map[string]decimal.Decimal, Snapshot, error) {
+	s.reads++
+	return s.RateStore.GetAllExchangeRates(source)
+}
+
+// failingCache is a Cache whose server is down.
+type failingCache struct {
+	calls int
+}
+
+var errCacheDown = errors.New("cache down")
+
+func (c *failingCache) Generation() (int64, error)              { c.calls++; return 0, errCacheDown }
+func (c *failingCache) Get(string) ([]byte, bool, error)        { c.calls++; return nil, false, errCacheDown }
+func (c *failingCache) Set(string, []byte, time.Duration) error { c.calls++; return errCacheDown }
+func (c *failingCache) Purge() error                            { c.calls++; return errCacheDown }
+func (c *failingCache) Close() error                            { return nil }
+
+// newCachedTestStore returns a test database read through an LRU cache, which
+// is invalidated by the changes of the database, and the store counting the
+// reads past the cache.
+func newCachedTestStore(t *testing.T) (*CachedStore, *Database, *countingStore) {
+	db := newTestDatabase(t)
+	counting := &countingStore{RateStore: db}
+	cached := NewCachedStore(counting, NewLRUCache(DefaultCacheSize), DefaultCacheTTL)
+	db.OnChange(func() { cached.Invalidate() })
+	return cached, db, counting
+}
+
+func TestCachedStoreReadsThrough(t *testing.T) {
+	cached, db, counting := newCachedTestStore(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	insertTestRate(t, db, 1, 1, "30000.5", now)
+
+	for i := 0; i < 2; i++ {
+		rate, snapshot, err := cached.GetExchangeRate("BTC", "USD", "")
+		require.NoError(t, err)
+		assert.Equal(t, "30000.5", rate.String())
+		assert.True(t, now.Equal(snapshot.TakenAt))
+		assert.Equal(t, DefaultSource, snapshot.Source)
+
+		rates, _, err := cached.GetExchangeRatesForCrypto("BTC", DefaultSource)
+		require.NoError(t, err)
+		assert.Equal(t, "30000.5", rates["USD"].String())
+
+		all, _, err := cached.GetAllExchangeRates("")
+		require.NoError(t, err)
+		assert.Equal(t, "30000.5", all["BTC"]["USD"].String())
+	}
+	assert.Equal(t, 3, counting.reads, "the second reads are served from the cache")
+
+	// Errors are not cached.
+	for i := 0; i < 2; i++ {
+		_, _, err := cached.GetExchangeRate("ETH", "USD", "")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, 5, counting.reads)
+	rates, snapshot, err := cached.GetExchangeRatesForCrypto("BTC", "kraken")
+	require.NoError(t, err)
+	assert.Empty(t, rates)
+	assert.NotNil(t, rates)
+	assert.Zero(t, snapshot)
+}
+
+func TestCachedStoreInvalidatedByChanges(t *testing.T) {
+	cached, db, counting := newCachedTestStore(t)
+	now := time.Now().UTC().Truncate(DefaultRateBucket)
+	insertTestRate(t, db, 1, 1, "30000", now.Add(-DefaultRateBucket))
+
+	rate, _, err := cached.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "30000", rate.String())
+
+	insertTestRate(t, db, 1, 1, "31000", now)
+	rate, _, err = cached.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "31000", rate.String(), "a new snapshot invalidates the cache")
+
+	// A replayed batch writes no snapshot and keeps the cache.
+	insertTestRate(t, db, 1, 1, "31000", now)
+	_, _, err = cached.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, counting.reads)
+
+	_, err = db.SetCurrencyActive(CurrencyTypeFiat, "USD", false)
+	require.NoError(t, err)
+	all, _, err := cached.GetAllExchangeRates("")
+	require.NoError(t, err)
+	assert.Empty(t, all, "disabling a currency invalidates the cache")
+}
+
+func TestCachedStoreInvalidatedByVersion(t *testing.T) {
+	db := newTestDatabase(t)
+	counting := &countingStore{RateStore: db}
+	cached := NewCachedStore(counting, NewLRUCache(DefaultCacheSize), DefaultCacheTTL)
+	cached.InvalidateOnVersion(db.LatestSnapshotID)
+	now := time.Now().UTC().Truncate(DefaultRateBucket)
+	insertTestRate(t, db, 1, 1, "30000", now.Add(-DefaultRateBucket))
+
+	for i := 0; i < 2; i++ {
+		rate, _, err := cached.GetExchangeRate("BTC", "USD", "")
+		require.NoError(t, err)
+		assert.Equal(t, "30000", rate.String())
+	}
+	assert.Equal(t, 1, counting.reads)
+
+	// No OnChange reaches the cache, as for a snapshot ingested by another
+	// process.
+	insertTestRate(t, db, 1, 1, "31000", now)
+	rate, _, err := cached.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "31000", rate.String(), "a new snapshot invalidates the cache")
+	assert.Equal(t, 2, counting.reads)
+}
+
+func TestCachedStoreResolvesCurrencies(t *testing.T) {
+	cached, db, counting := newCachedTestStore(t)
+
+	for i := 0; i < 2; i++ {
+		symbol, err := cached.ResolveCryptoCurrency(" btc")
+		require.NoError(t, err)
+		assert.Equal(t, "BTC", symbol)
+		symbol, err = cached.ResolveFiatCurrency("usd")
+		require.NoError(t, err)
+		assert.Equal(t, "USD", symbol)
+
+		known, err := cached.CheckCryptoCurrency("DOGE")
+		require.NoError(t, err)
+		assert.False(t, known)
+		_, err = cached.ResolveCryptoCurrency("doge")
+		assert.ErrorIs(t, err, ErrUnknownCurrency)
+		assert.EqualError(t, err, "crypto currency DOGE: unknown currency")
+	}
+	assert.Equal(t, 3, counting.resolves, "the second resolutions are served from the cache")
+
+	_, err := db.SetCurrencyActive(CurrencyTypeCrypto, "ETH", false)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		symbol, err := cached.ResolveCryptoCurrency("eth")
+		assert.ErrorIs(t, err, ErrCurrencyDisabled, "disabling a currency invalidates the cache")
+		assert.Equal(t, "ETH", symbol)
+		_, err = cached.CheckCryptoCurrency("ETH")
+		assert.ErrorIs(t, err, ErrCurrencyDisabled)
+	}
+
+	_, err = db.AddCurrency(Currency{Symbol: "DOGE", Name: "Dogecoin", Type: CurrencyTypeCrypto, Aliases: []string{"XDG"}})
+	require.NoError(t, err)
+	known, err := cached.CheckCryptoCurrency("doge")
+	require.NoError(t, err)
+	assert.True(t, known, "adding a currency invalidates the cache")
+	symbol, err := cached.ResolveCryptoCurrency("xdg")
+	require.NoError(t, err)
+	assert.Equal(t, "DOGE", symbol)
+
+	require.NoError(t, db.RemoveCurrency(CurrencyTypeCrypto, "DOGE"))
+	known, err = cached.CheckCryptoCurrency("XDG")
+	require.NoError(t, err)
+	assert.False(t, known, "removing a currency invalidates the cache")
+}
+
+func TestCachedStoreSharesRedis(t *testing.T) {
+	server := newFakeRedis(t, "")
+	db := newTestDatabase(t)
+	insertTestRate(t, db, 1, 1, "30000", time.Now().UTC())
+	counting := &countingStore{RateStore: db}
+	first := NewCachedStore(counting, NewRedisCache(CacheConfig{Address: server.address()}), DefaultCacheTTL)
+	second := NewCachedStore(counting, NewRedisCache(CacheConfig{Address: server.address()}), DefaultCacheTTL)
+
+	for _, cached := range []*CachedStore{first, second} {
+		rate, _, err := cached.GetExchangeRate("BTC", "USD", "")
+		require.NoError(t, err)
+		assert.Equal(t, "30000", rate.String())
+	}
+	assert.Equal(t, 1, counting.reads)
+
+	require.NoError(t, first.Invalidate())
+	_, _, err := second.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, counting.reads, "an invalidation reaches every instance")
+}
+
+func TestCachedStoreEntryTTL(t *testing.T) {
+	cached := NewCachedStore(NewMemoryStore(), NewLRUCache(1), 10*time.Minute)
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	cached.now = func() time.Time { return now }
+
+	for _, test := range []struct {
+		takenAt time.Time
+		ttl     time.Duration
+	}{
+		{now.Add(-4 * time.Minute), 6 * time.Minute},
+		{now, 10 * time.Minute},
+		{now.Add(time.Minute), 10 * time.Minute},
+		{now.Add(-10 * time.Minute), minCacheTTL},
+		{time.Time{}, minCacheTTL},
+	} {
+		assert.Equal(t, test.ttl, cached.entryTTL(Snapshot{TakenAt: test.takenAt}), test.takenAt)
+	}
+}
+
+func TestCachedStoreDegradesWhenCacheFails(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC()
+	insertTestRate(t, db, 1, 1, "30000", now)
+	cache := &failingCache{}
+	cached := NewCachedStore(db, cache, DefaultCacheTTL)
+	clock := now
+	cached.now = func() time.Time { return clock }
+
+	for i := 0; i < 3; i++ {
+		rate, _, err := cached.GetExchangeRate("BTC", "USD", "")
+		require.NoError(t, err)
+		assert.Equal(t, "30000", rate.String())
+	}
+	assert.Equal(t, 1, cache.calls, "a failed cache is skipped")
+
+	clock = clock.Add(cacheRetryInterval)
+	_, _, err := cached.GetAllExchangeRates("")
+	require.NoError(t, err)
+	assert.Equal(t, 2, cache.calls, "a failed cache is retried after a while")
+	assert.ErrorIs(t, cached.Invalidate(), errCacheDown)
+}
+
+func TestNewCache(t *testing.T) {
+	cache, err := NewCache(CacheConfig{})
+	require.NoError(t, err)
+	assert.IsType(t, &LRUCache{}, cache)
+	assert.Equal(t, DefaultCacheSize, cache.(*LRUCache).size)
+
+	cache, err = NewCache(CacheConfig{Driver: CacheDriverRedis, Address: "localhost:6379"})
+	require.NoError(t, err)
+	assert.IsType(t, &RedisCache{}, cache)
+
+	cache, err = NewCache(CacheConfig{Driver: CacheDriverNone})
+	require.NoError(t, err)
+	assert.Nil(t, cache)
+
+	_, err = NewCache(CacheConfig{Driver: "memcached"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,414 @@
+package ratestore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults applied by NewDatabase to the zero fields of Config.
+const (
+	DefaultMaxOpenConns       = 10
+	DefaultMaxIdleConns       = 5
+	DefaultConnMaxLifetime    = 5 * time.Minute
+	DefaultHealthCheckTimeout = 5 * time.Second
+	DefaultInsertChunkSize    = 100
+	DefaultRateBucket         = 10 * time.Minute
+	DefaultMaxReplicaLag      = 30 * time.Second
+)
+
+// Supported values of CacheConfig.Driver.
+const (
+	CacheDriverMemory = "memory"
+	CacheDriverRedis  = "redis"
+	CacheDriverNone   = "none"
+)
+
+// Defaults applied by NewCache to the zero fields of CacheConfig.
+const (
+	DefaultCacheSize    = 1000
+	DefaultCacheTTL     = 10 * time.Minute
+	DefaultCacheTimeout = 200 * time.Millisecond
+)
+
+// MaxInsertChunkSize is the largest Config.InsertChunkSize accepted, which
+// keeps the placeholders of a chunk below the limit of every database.
+const MaxInsertChunkSize = 5000
+
+// Config holds the connection settings of the database.
+type Config struct {
+	// Driver selects the database: DriverMySQL (the default), DriverSQLite
+	// or DriverPostgres.
+	Driver   string `yaml:"driver"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	// Database is the database name, or the file path for SQLite.
+	Database string `yaml:"database"`
+	// SSLMode is the PostgreSQL sslmode connection parameter.
+	SSLMode string `yaml:"sslmode"`
+
+	// MaxOpenConns caps the number of open connections in the pool.
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// MaxIdleConns caps the number of idle connections kept in the pool.
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// ConnMaxLifetime is how long a connection may be reused before it is
+	// closed. It should be shorter than the server's idle timeout.
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// HealthCheckTimeout bounds the connectivity check done by NewDatabase.
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+
+	// RawRetention is how long raw exchange rates are kept once they have
+	// been rolled up. Zero keeps them forever.
+	RawRetention time.Duration `yaml:"raw_retention"`
+	// InsertChunkSize is the number of rows written by each multi-row INSERT
+	// of an ingestion batch.
+	InsertChunkSize int `yaml:"insert_chunk_size"`
+	// RateBucket is the period a pair keeps at most one raw rate of a source
+	// for, the latest ingested, so that retried ingestions store no
+	// duplicates. It must divide an hour evenly.
+	RateBucket time.Duration `yaml:"rate_bucket"`
+	// PartitionRates stores the raw rates of every month in a table of its
+	// own, so that a month is archived or dropped without a DELETE.
+	PartitionRates bool `yaml:"partition_rates"`
+
+	// Replicas are the hosts of the read replicas, or their file paths for
+	// SQLite. A host is written "user:password@host" when the replica has
+	// credentials of its own, and otherwise shares the user and password of
+	// the primary; every replica shares its database name. They serve the
+	// rates and history read by clients, while every write and the reads of
+	// writes go to the primary. On MySQL the replica user needs the
+	// REPLICATION CLIENT privilege to measure the lag: a replica whose lag
+	// cannot be read is never used.
+	Replicas []string `yaml:"replicas"`
+	// MaxReplicaLag is the largest lag of a replica that is still read from.
+	// The reads go to the primary while every replica lags more or fails.
+	MaxReplicaLag time.Duration `yaml:"max_replica_lag"`
+}
+
+// ConfigFromEnv reads the connection settings from the environment, as
+// described by LoadEnv.
+func ConfigFromEnv() (Config, error) {
+	var cfg Config
+	err := cfg.LoadEnv()
+	return cfg, err
+}
+
+// LoadEnv overrides the settings of cfg whose environment variable is set:
+// DB_DRIVER, DB_USER, DB_PASSWORD, DB_HOST, DB_DATABASE and DB_SSLMODE for the
+// connection, DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and DB_CONN_MAX_LIFETIME (a
+// duration such as "5m") for the pool, DB_RAW_RETENTION, DB_INSERT_CHUNK_SIZE,
+// DB_RATE_BUCKET and DB_PARTITION_RATES (true or false), and DB_REPLICAS
+// (comma-separated) and DB_MAX_REPLICA_LAG for the read replicas.
+func (cfg *Config) LoadEnv() error {
+	for name, field := range map[string]*string{
+		"DB_DRIVER":   &cfg.Driver,
+		"DB_USER":     &cfg.User,
+		"DB_PASSWORD": &cfg.Password,
+		"DB_HOST":     &cfg.Host,
+		"DB_DATABASE": &cfg.Database,
+		"DB_SSLMODE":  &cfg.SSLMode,
+	} {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if err := envInt("DB_MAX_OPEN_CONNS", &cfg.MaxOpenConns); err != nil {
+		return err
+	}
+	if err := envInt("DB_MAX_IDLE_CONNS", &cfg.MaxIdleConns); err != nil {
+		return err
+	}
+	if err := envDuration("DB_CONN_MAX_LIFETIME", &cfg.ConnMaxLifetime); err != nil {
+		return err
+	}
+	if err := envDuration("DB_RAW_RETENTION", &cfg.RawRetention); err != nil {
+		return err
+	}
+	if err := envInt("DB_INSERT_CHUNK_SIZE", &cfg.InsertChunkSize); err != nil {
+		return err
+	}
+	if err := envDuration("DB_RATE_BUCKET", &cfg.RateBucket); err != nil {
+		return err
+	}
+	if err := envBool("DB_PARTITION_RATES", &cfg.PartitionRates); err != nil {
+		return err
+	}
+	if value, ok := os.LookupEnv("DB_REPLICAS"); ok {
+		cfg.Replicas = nil
+		for _, replica := range strings.Split(value, ",") {
+			if replica = strings.TrimSpace(replica); replica != "" {
+				cfg.Replicas = append(cfg.Replicas, replica)
+			}
+		}
+	}
+	return envDuration("DB_MAX_REPLICA_LAG", &cfg.MaxReplicaLag)
+}
+
+// Validate reports every missing or invalid setting of cfg.
+func (cfg Config) Validate() error {
+	var problems []string
+
+	switch cfg.Driver {
+	case "", DriverMySQL, DriverPostgres:
+		if cfg.Host == "" {
+			problems = append(problems, "host is required")
+		}
+		if cfg.User == "" {
+			problems = append(problems, "user is required")
+		}
+		if cfg.Database == "" {
+			problems = append(problems, "database name is required")
+		}
+	case DriverSQLite:
+		if cfg.Database == "" {
+			problems = append(problems, "database file path is required")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported driver %q, expected %s, %s or %s",
+			cfg.Driver, DriverMySQL, DriverSQLite, DriverPostgres))
+	}
+
+	if cfg.MaxOpenConns < 0 {
+		problems = append(problems, "max_open_conns must not be negative")
+	}
+	if cfg.MaxIdleConns < 0 {
+		problems = append(problems, "max_idle_conns must not be negative")
+	}
+	if cfg.ConnMaxLifetime < 0 {
+		problems = append(problems, "conn_max_lifetime must not be negative")
+	}
+	if cfg.RawRetention != 0 && cfg.RawRetention < MinRawRetention {
+		problems = append(problems, fmt.Sprintf("raw_retention must be zero or at least %s", MinRawRetention))
+	}
+	if cfg.InsertChunkSize < 0 || cfg.InsertChunkSize > MaxInsertChunkSize {
+		problems = append(problems, fmt.Sprintf("insert_chunk_size must be between 0 and %d", MaxInsertChunkSize))
+	}
+	if cfg.RateBucket < 0 || (cfg.RateBucket > 0 && time.Hour%cfg.RateBucket != 0) {
+		problems = append(problems, "rate_bucket must divide an hour evenly")
+	}
+	for _, replica := range cfg.Replicas {
+		if strings.TrimSpace(replica) == "" {
+			problems = append(problems, "replicas must not be empty")
+			break
+		}
+		if cfg.Driver != DriverSQLite && cfg.replica(replica).Host == "" {
+			problems = append(problems, "replicas must have a host")
+			break
+		}
+	}
+	if cfg.MaxReplicaLag < 0 {
+		problems = append(problems, "max_replica_lag must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// withDefaults returns cfg with its zero pool, insert and replica settings set
+// to the defaults.
+func (cfg Config) withDefaults() Config {
+	if cfg.MaxOpenConns == 0 {
+		cfg.MaxOpenConns = DefaultMaxOpenConns
+	}
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if cfg.MaxIdleConns > cfg.MaxOpenConns {
+		cfg.MaxIdleConns = cfg.MaxOpenConns
+	}
+	if cfg.ConnMaxLifetime == 0 {
+		cfg.ConnMaxLifetime = DefaultConnMaxLifetime
+	}
+	if cfg.HealthCheckTimeout == 0 {
+		cfg.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+	if cfg.InsertChunkSize == 0 {
+		cfg.InsertChunkSize = DefaultInsertChunkSize
+	}
+	if cfg.RateBucket == 0 {
+		cfg.RateBucket = DefaultRateBucket
+	}
+	if cfg.MaxReplicaLag == 0 {
+		cfg.MaxReplicaLag = DefaultMaxReplicaLag
+	}
+	return cfg
+}
+
+// replica returns the settings of the replica at address, its host with
+// optional "user:password@" credentials, or its file path for SQLite.
+func (cfg Config) replica(address string) Config {
+	cfg.Replicas = nil
+	if cfg.Driver == DriverSQLite {
+		cfg.Database = address
+		return cfg
+	}
+
+	cfg.Host = address
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		credentials := address[:i]
+		cfg.Host = address[i+1:]
+		cfg.User, cfg.Password = credentials, ""
+		if j := strings.Index(credentials, ":"); j >= 0 {
+			cfg.User, cfg.Password = credentials[:j], credentials[j+1:]
+		}
+	}
+	return cfg
+}
+
+// CacheConfig holds the settings of the cache of the latest rates.
+type CacheConfig struct {
+	// Driver selects the cache: CacheDriverMemory (the default), an LRU
+	// cache in the process, CacheDriverRedis, shared by every instance, or
+	// CacheDriverNone.
+	Driver string `yaml:"driver"`
+	// Size caps the number of entries of the memory cache.
+	Size int `yaml:"size"`
+	// TTL is how long after their snapshot the latest rates are cached. It
+	// should be the ingestion interval, when the next snapshot is expected.
+	TTL time.Duration `yaml:"ttl"`
+
+	// Address is the host and port of the Redis server.
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	// RedisDB is the number of the Redis database.
+	RedisDB int `yaml:"redis_db"`
+	// Timeout bounds every command sent to the Redis server, past which the
+	// rates are read from the database.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// CacheConfigFromEnv reads the cache settings from the environment, as
+// described by LoadEnv.
+func CacheConfigFromEnv() (CacheConfig, error) {
+	var cfg CacheConfig
+	err := cfg.LoadEnv()
+	return cfg, err
+}
+
+// LoadEnv overrides the settings of cfg whose environment variable is set:
+// CACHE_DRIVER, CACHE_SIZE and CACHE_TTL (a duration such as "10m"), and
+// CACHE_ADDRESS, CACHE_PASSWORD, CACHE_REDIS_DB and CACHE_TIMEOUT for Redis.
+func (cfg *CacheConfig) LoadEnv() error {
+	for name, field := range map[string]*string{
+		"CACHE_DRIVER":   &cfg.Driver,
+		"CACHE_ADDRESS":  &cfg.Address,
+		"CACHE_PASSWORD": &cfg.Password,
+	} {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	if err := envInt("CACHE_SIZE", &cfg.Size); err != nil {
+		return err
+	}
+	if err := envDuration("CACHE_TTL", &cfg.TTL); err != nil {
+		return err
+	}
+	if err := envInt("CACHE_REDIS_DB", &cfg.RedisDB); err != nil {
+		return err
+	}
+	return envDuration("CACHE_TIMEOUT", &cfg.Timeout)
+}
+
+// Validate reports every invalid setting of cfg.
+func (cfg CacheConfig) Validate() error {
+	var problems []string
+
+	switch cfg.Driver {
+	case "", CacheDriverMemory, CacheDriverNone:
+	case CacheDriverRedis:
+		if cfg.Address == "" {
+			problems = append(problems, "address is required")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported driver %q, expected %s, %s or %s",
+			cfg.Driver, CacheDriverMemory, CacheDriverRedis, CacheDriverNone))
+	}
+	if cfg.Size < 0 {
+		problems = append(problems, "size must not be negative")
+	}
+	if cfg.TTL < 0 {
+		problems = append(problems, "ttl must not be negative")
+	}
+	if cfg.RedisDB < 0 {
+		problems = append(problems, "redis_db must not be negative")
+	}
+	if cfg.Timeout < 0 {
+		problems = append(problems, "timeout must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// withDefaults returns cfg with its zero settings set to the defaults.
+func (cfg CacheConfig) withDefaults() CacheConfig {
+	if cfg.Driver == "" {
+		cfg.Driver = CacheDriverMemory
+	}
+	if cfg.Size == 0 {
+		cfg.Size = DefaultCacheSize
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultCacheTimeout
+	}
+	return cfg
+}
+
+// envInt sets *n from the environment variable name if it is set and not
+// empty.
+func envInt(name string, n *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("%s: invalid value %q", name, value)
+	}
+	*n = parsed
+	return nil
+}
+
+// envBool sets *b from the environment variable name if it is set and not
+// empty.
+func envBool(name string, b *bool) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid value %q", name, value)
+	}
+	*b = parsed
+	return nil
+}
+
+// envDuration sets *d from the environment variable name if it is set and not
+// empty.
+func envDuration(name string, d *time.Duration) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("%s: invalid value %q", name, value)
+	}
+	*d = parsed
+	return nil
+}
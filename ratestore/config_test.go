@@ -0,0 +1,143 @@
+package ratestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("DB_DRIVER", "postgres")
+	t.Setenv("DB_HOST", "db:5432")
+	t.Setenv("DB_MAX_OPEN_CONNS", "25")
+	t.Setenv("DB_MAX_IDLE_CONNS", "")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "90s")
+	t.Setenv("DB_RAW_RETENTION", "720h")
+	t.Setenv("DB_INSERT_CHUNK_SIZE", "1000")
+	t.Setenv("DB_RATE_BUCKET", "5m")
+	t.Setenv("DB_PARTITION_RATES", "true")
+	t.Setenv("DB_REPLICAS", "replica-a:5432, replica-b:5432,")
+	t.Setenv("DB_MAX_REPLICA_LAG", "10s")
+
+	cfg, err := ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, DriverPostgres, cfg.Driver)
+	assert.Equal(t, "db:5432", cfg.Host)
+	assert.Equal(t, 25, cfg.MaxOpenConns)
+	assert.Equal(t, 0, cfg.MaxIdleConns)
+	assert.Equal(t, 90*time.Second, cfg.ConnMaxLifetime)
+	assert.Equal(t, 30*24*time.Hour, cfg.RawRetention)
+	assert.Equal(t, 1000, cfg.InsertChunkSize)
+	assert.Equal(t, 5*time.Minute, cfg.RateBucket)
+	assert.True(t, cfg.PartitionRates)
+	assert.Equal(t, []string{"replica-a:5432", "replica-b:5432"}, cfg.Replicas)
+	assert.Equal(t, 10*time.Second, cfg.MaxReplicaLag)
+}
+
+func TestConfigFromEnvInvalid(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "many")
+	_, err := ConfigFromEnv()
+	assert.EqualError(t, err, `DB_MAX_OPEN_CONNS: invalid value "many"`)
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "5")
+	_, err = ConfigFromEnv()
+	assert.EqualError(t, err, `DB_CONN_MAX_LIFETIME: invalid value "5"`)
+
+	t.Setenv("DB_CONN_MAX_LIFETIME", "")
+	t.Setenv("DB_PARTITION_RATES", "monthly")
+	_, err = ConfigFromEnv()
+	assert.EqualError(t, err, `DB_PARTITION_RATES: invalid value "monthly"`)
+}
+
+func TestConfigWithDefaults(t *testing.T) {
+	cfg := Config{}.withDefaults()
+	assert.Equal(t, DefaultMaxOpenConns, cfg.MaxOpenConns)
+	assert.Equal(t, DefaultMaxIdleConns, cfg.MaxIdleConns)
+	assert.Equal(t, DefaultConnMaxLifetime, cfg.ConnMaxLifetime)
+	assert.Equal(t, DefaultHealthCheckTimeout, cfg.HealthCheckTimeout)
+	assert.Equal(t, DefaultInsertChunkSize, cfg.InsertChunkSize)
+	assert.Equal(t, DefaultRateBucket, cfg.RateBucket)
+	assert.Equal(t, DefaultMaxReplicaLag, cfg.MaxReplicaLag)
+
+	cfg = Config{MaxOpenConns: 2, MaxIdleConns: 8}.withDefaults()
+	assert.Equal(t, 2, cfg.MaxIdleConns)
+}
+
+func TestConfigLoadEnvOverridesSetVariables(t *testing.T) {
+	t.Setenv("DB_HOST", "replica:3306")
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+
+	cfg := Config{Host: "localhost:3306", User: "rates", MaxOpenConns: 4}
+	assert.NoError(t, cfg.LoadEnv())
+	assert.Equal(t, "replica:3306", cfg.Host)
+	assert.Equal(t, "rates", cfg.User)
+	assert.Equal(t, 4, cfg.MaxOpenConns)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{Host: "localhost:3306", User: "rates", Database: "crypto"}.Validate())
+	assert.NoError(t, Config{Driver: DriverSQLite, Database: "rates.db"}.Validate())
+
+	assert.EqualError(t, Config{}.Validate(), "host is required; user is required; database name is required")
+	assert.EqualError(t, Config{Driver: DriverSQLite}.Validate(), "database file path is required")
+	assert.EqualError(t, Config{Driver: "oracle", MaxOpenConns: -1}.Validate(),
+		`unsupported driver "oracle", expected mysql, sqlite or postgres; max_open_conns must not be negative`)
+	assert.EqualError(t, Config{Driver: DriverSQLite, Database: "rates.db", RawRetention: time.Hour}.Validate(),
+		"raw_retention must be zero or at least 24h0m0s")
+	assert.EqualError(t, Config{Driver: DriverSQLite, Database: "rates.db", InsertChunkSize: 10000}.Validate(),
+		"insert_chunk_size must be between 0 and 5000")
+	assert.NoError(t, Config{Driver: DriverSQLite, Database: "rates.db", RateBucket: time.Minute}.Validate())
+	assert.EqualError(t, Config{Driver: DriverSQLite, Database: "rates.db", RateBucket: 7 * time.Minute}.Validate(),
+		"rate_bucket must divide an hour evenly")
+	assert.EqualError(t, Config{Driver: DriverSQLite, Database: "rates.db", Replicas: []string{" "}, MaxReplicaLag: -time.Second}.Validate(),
+		"replicas must not be empty; max_replica_lag must not be negative")
+	assert.EqualError(t, Config{Host: "localhost:3306", User: "rates", Database: "crypto", Replicas: []string{"reader:secret@"}}.Validate(),
+		"replicas must have a host")
+}
+
+func TestConfigReplica(t *testing.T) {
+	cfg := Config{User: "rates", Password: "secret", Host: "primary:3306", Database: "crypto", Replicas: []string{"replica:3306"}}
+
+	assert.Equal(t, Config{User: "rates", Password: "secret", Host: "replica:3306", Database: "crypto"}, cfg.replica("replica:3306"))
+	assert.Equal(t, Config{User: "reader", Password: "p@ss:word", Host: "replica:3306", Database: "crypto"},
+		cfg.replica("reader:p@ss:word@replica:3306"))
+	assert.Equal(t, Config{User: "reader", Host: "replica:3306", Database: "crypto"}, cfg.replica("reader@replica:3306"))
+
+	cfg = Config{Driver: DriverSQLite, Database: "primary.db"}
+	assert.Equal(t, Config{Driver: DriverSQLite, Database: "user@replica.db"}, cfg.replica("user@replica.db"))
+}
+
+func TestCacheConfigFromEnv(t *testing.T) {
+	t.Setenv("CACHE_DRIVER", "redis")
+	t.Setenv("CACHE_ADDRESS", "cache:6379")
+	t.Setenv("CACHE_PASSWORD", "secret")
+	t.Setenv("CACHE_SIZE", "")
+	t.Setenv("CACHE_TTL", "5m")
+	t.Setenv("CACHE_REDIS_DB", "3")
+	t.Setenv("CACHE_TIMEOUT", "50ms")
+
+	cfg, err := CacheConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, CacheConfig{Driver: CacheDriverRedis, Address: "cache:6379", Password: "secret",
+		TTL: 5 * time.Minute, RedisDB: 3, Timeout: 50 * time.Millisecond}, cfg)
+
+	t.Setenv("CACHE_TTL", "often")
+	_, err = CacheConfigFromEnv()
+	assert.EqualError(t, err, `CACHE_TTL: invalid value "often"`)
+}
+
+func TestCacheConfigWithDefaults(t *testing.T) {
+	cfg := CacheConfig{}.withDefaults()
+	assert.Equal(t, CacheConfig{Driver: CacheDriverMemory, Size: DefaultCacheSize, TTL: DefaultCacheTTL, Timeout: DefaultCacheTimeout}, cfg)
+}
+
+func TestCacheConfigValidate(t *testing.T) {
+	assert.NoError(t, CacheConfig{}.Validate())
+	assert.NoError(t, CacheConfig{Driver: CacheDriverRedis, Address: "localhost:6379"}.Validate())
+
+	assert.EqualError(t, CacheConfig{Driver: CacheDriverRedis}.Validate(), "address is required")
+	assert.EqualError(t, CacheConfig{Driver: "memcached", Size: -1, TTL: -time.Second}.Validate(),
+		`unsupported driver "memcached", expected memory, redis or none; size must not be negative; ttl must not be negative`)
+}
@@ -0,0 +1,616 @@
+package ratestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Currency types of a Currency.
+const (
+	CurrencyTypeCrypto = "crypto"
+	CurrencyTypeFiat   = "fiat"
+)
+
+// Errors of the currency administration.
+var (
+	// ErrCurrencyDisabled is returned for a known currency that has been
+	// disabled and is no longer served.
+	ErrCurrencyDisabled = errors.New("currency is disabled")
+	// ErrCurrencyExists is returned when adding a currency that exists,
+	// active or not.
+	ErrCurrencyExists = errors.New("currency already exists")
+	// ErrCurrencyInUse is returned when removing a currency that has rates.
+	ErrCurrencyInUse = errors.New("currency has exchange rates")
+	// ErrUnknownCurrency is returned when resolving a symbol that is neither
+	// a currency nor an alias of one.
+	ErrUnknownCurrency = errors.New("unknown currency")
+)
+
+// Currency describes a supported cryptocurrency or fiat currency.
+type Currency struct {
+	Symbol   string `json:"symbol" yaml:"symbol"`
+	Name     string `json:"name" yaml:"name"`
+	Type     string `json:"type" yaml:"type"`
+	Decimals int    `json:"decimals" yaml:"decimals"`
+	// ISONumeric is the ISO 4217 numeric code of a fiat currency, such as
+	// "840" for USD.
+	ISONumeric string `json:"iso_numeric,omitempty" yaml:"iso_numeric,omitempty"`
+	// Chain and ContractAddress locate a cryptocurrency that is a token on
+	// another chain, such as USDT on ethereum.
+	Chain           string `json:"chain,omitempty" yaml:"chain,omitempty"`
+	ContractAddress string `json:"contract_address,omitempty" yaml:"contract_address,omitempty"`
+	// Aliases are the other symbols the currency is known by, such as XBT
+	// for BTC, which are resolved to Symbol.
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	// Active is set on the currencies read from the database. A manifest
+	// lists the active currencies only, so it is not read from one.
+	Active bool `json:"active" yaml:"-"`
+}
+
+// currencyTable describes the table of one type of currency.
+type currencyTable struct {
+	currencyType, table string
+	// details are the metadata columns specific to the type, and fields
+	// returns the Currency fields they are read into and written from.
+	details []string
+	fields  func(c *Currency) []*string
+}
+
+// currencyTableFor returns the table of the currencies of currencyType.
+func currencyTableFor(currencyType string) (currencyTable, error) {
+	for _, table := range currencyTables {
+		if table.currencyType == currencyType {
+			return table, nil
+		}
+	}
+	return currencyTable{}, fmt.Errorf("unsupported currency type %q, expected crypto or fiat", currencyType)
+}
+
+// idColumn returns the primary key column of the table, which is also the
+// column referencing it from the rate tables.
+func (table currencyTable) idColumn() string {
+	if table.currencyType == CurrencyTypeCrypto {
+		return "cryptocurrency_id"
+	}
+	return "fiat_currency_id"
+}
+
+// selectColumns returns the columns scanned by scanCurrency.
+func (table currencyTable) selectColumns() string {
+	return "symbol, name, decimals, active, " + strings.Join(table.details, ", ")
+}
+
+var currencyTables = []currencyTable{
+	{
+		currencyType: CurrencyTypeCrypto,
+		table:        "Cryptocurrencies",
+		details:      []string{"chain", "contract_address"},
+		fields:       func(c *Currency) []*string { return []*string{&c.Chain, &c.ContractAddress} },
+	},
+	{
+		currencyType: CurrencyTypeFiat,
+		table:        "FiatCurrencies",
+		details:      []string{"iso_numeric"},
+		fields:       func(c *Currency) []*string { return []*string{&c.ISONumeric} },
+	},
+}
+
+// SeedReport lists the changes made by SeedCurrencies.
+type SeedReport struct {
+	// Added holds the currencies that did not exist.
+	Added []Currency
+	// Updated holds the currencies whose name or decimals changed, that were
+	// disabled and are enabled again, or that were added with AddCurrency and
+	// are now managed by the manifest.
+	Updated []Currency
+	// Disabled holds the currencies managed by the manifest that are no
+	// longer in it.
+	Disabled []Currency
+}
+
+// ValidateCurrencies reports every invalid or duplicated currency of a
+// manifest.
+func ValidateCurrencies(currencies []Currency) error {
+	var problems []string
+	seen := make(map[[2]string]bool)
+	// aliased holds the symbol every alias of a type resolves to.
+	aliased := make(map[[2]string]string)
+
+	for i, c := range currencies {
+		where := fmt.Sprintf("currency %d", i+1)
+		if c.Symbol != "" {
+			where = fmt.Sprintf("currency %s", c.Symbol)
+		}
+
+		switch {
+		case c.Symbol == "":
+			problems = append(problems, where+": symbol is required")
+		case len(c.Symbol) > 10:
+			problems = append(problems, where+": symbol must be at most 10 characters")
+		case c.Symbol != strings.ToUpper(c.Symbol):
+			problems = append(problems, where+": symbol must be upper case")
+		}
+		if c.Name == "" {
+			problems = append(problems, where+": name is required")
+		}
+		if c.Type != CurrencyTypeCrypto && c.Type != CurrencyTypeFiat {
+			problems = append(problems, fmt.Sprintf("%s: unsupported type %q, expected crypto or fiat", where, c.Type))
+		}
+		if c.Decimals < 0 || c.Decimals > 18 {
+			problems = append(problems, where+": decimals must be between 0 and 18")
+		}
+		switch {
+		case c.ISONumeric != "" && c.Type != CurrencyTypeFiat:
+			problems = append(problems, where+": iso_numeric is only for fiat currencies")
+		case c.ISONumeric != "" && !isISONumeric(c.ISONumeric):
+			problems = append(problems, where+": iso_numeric must be 3 digits")
+		}
+		switch {
+		case (c.Chain != "" || c.ContractAddress != "") && c.Type != CurrencyTypeCrypto:
+			problems = append(problems, where+": chain and contract_address are only for crypto currencies")
+		case c.ContractAddress != "" && c.Chain == "":
+			problems = append(problems, where+": contract_address requires a chain")
+		case len(c.Chain) > 50:
+			problems = append(problems, where+": chain must be at most 50 characters")
+		case len(c.ContractAddress) > 100:
+			problems = append(problems, where+": contract_address must be at most 100 characters")
+		}
+
+		for _, alias := range c.Aliases {
+			switch {
+			case alias == "" || len(alias) > 10:
+				problems = append(problems, where+": aliases must be 1 to 10 characters")
+			case alias != NormalizeSymbol(alias):
+				problems = append(problems, fmt.Sprintf("%s: alias %s must be upper case", where, alias))
+			case alias == c.Symbol:
+				problems = append(problems, fmt.Sprintf("%s: alias %s is its own symbol", where, alias))
+			}
+			key := [2]string{c.Type, alias}
+			if symbol, ok := aliased[key]; ok {
+				problems = append(problems, fmt.Sprintf("%s: alias %s is already an alias of %s", where, alias, symbol))
+			}
+			aliased[key] = c.Symbol
+		}
+
+		key := [2]string{c.Type, c.Symbol}
+		if seen[key] {
+			problems = append(problems, where+": listed more than once")
+		}
+		seen[key] = true
+	}
+	for _, c := range currencies {
+		for _, alias := range c.Aliases {
+			if seen[[2]string{c.Type, alias}] && alias != c.Symbol {
+				problems = append(problems, fmt.Sprintf("currency %s: alias %s is the symbol of another currency", c.Symbol, alias))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid currencies: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// SeedCurrencies makes the currency tables match currencies: it adds the
+// missing currencies, updates the changed ones and disables the ones that are
+// not listed. The currencies added with AddCurrency are only disabled once a
+// manifest has listed them, so a seed does not undo the admin's additions.
+// Disabled currencies keep their exchange rates but are no longer served or
+// ingested. Running it again with the same currencies changes
+// nothing. With dryRun the changes are reported but not committed; otherwise
+// a seed that changes any currency calls the functions registered with
+// OnChange.
+func (d *Database) SeedCurrencies(currencies []Currency, dryRun bool) (SeedReport, error) {
+	if err := ValidateCurrencies(currencies); err != nil {
+		return SeedReport{}, err
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return SeedReport{}, err
+	}
+	defer tx.Rollback()
+
+	var report SeedReport
+	for _, table := range currencyTables {
+		var wanted []Currency
+		for _, c := range currencies {
+			if c.Type == table.currencyType {
+				wanted = append(wanted, c)
+			}
+		}
+		if err := d.seedTable(tx, table, wanted, &report); err != nil {
+			return SeedReport{}, fmt.Errorf("seeding %s: %w", table.table, err)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return report, err
+	}
+	if len(report.Added) > 0 || len(report.Updated) > 0 || len(report.Disabled) > 0 {
+		d.changed()
+	}
+	return report, nil
+}
+
+// storedCurrency is a row of a currency table.
+type storedCurrency struct {
+	Currency
+	active bool
+}
+
+// seedTable seeds the currencies of one type into their table.
+func (d *Database) seedTable(tx *sql.Tx, table currencyTable, wanted []Currency, report *SeedReport) error {
+	rows, err := tx.Query("SELECT " + table.selectColumns() + " FROM " + table.table)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]storedCurrency)
+	for rows.Next() {
+		c := storedCurrency{Currency: Currency{Type: table.currencyType}}
+		if err := scanCurrency(rows, table, &c.Currency, &c.active); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[c.Symbol] = c
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	managed, err := d.managedSymbols(tx, table)
+	if err != nil {
+		return err
+	}
+	aliases, err := d.loadAliases(tx, table)
+	if err != nil {
+		return err
+	}
+	for symbol, c := range existing {
+		c.Aliases = aliases[symbol]
+		existing[symbol] = c
+	}
+
+	set := "name = ?, decimals = ?, active = ?"
+	for _, column := range table.details {
+		set += ", " + column + " = ?"
+	}
+	set += ", managed = ?"
+
+	listed := make(map[string]bool)
+	var changed []Currency
+	for _, c := range wanted {
+		listed[c.Symbol] = true
+
+		stored, ok := existing[c.Symbol]
+		switch {
+		case !ok:
+			err = d.insertCurrency(tx, table, c, true)
+			report.Added = append(report.Added, c)
+			changed = append(changed, c)
+		case !sameCurrency(stored.Currency, c) || !stored.active || !managed[c.Symbol]:
+			_, err = tx.Exec(d.dialect.rebind("UPDATE "+table.table+" SET "+set+" WHERE symbol = ?"),
+				append(currencyValues(table, c), true, c.Symbol)...)
+			report.Updated = append(report.Updated, c)
+			changed = append(changed, c)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := d.replaceAliases(tx, table, changed); err != nil {
+		return err
+	}
+
+	for _, c := range sortedCurrencies(existing) {
+		if listed[c.Symbol] || !c.active || !managed[c.Symbol] {
+			continue
+		}
+		if _, err := tx.Exec(d.dialect.rebind("UPDATE "+table.table+" SET active = ? WHERE symbol = ?"), false, c.Symbol); err != nil {
+			return err
+		}
+		report.Disabled = append(report.Disabled, c.Currency)
+	}
+
+	return nil
+}
+
+// managedSymbols returns the set of the symbols of the currencies of table
+// that are managed by the manifest.
+func (d *Database) managedSymbols(tx *sql.Tx, table currencyTable) (map[string]bool, error) {
+	rows, err := tx.Query(d.dialect.rebind("SELECT symbol FROM "+table.table+" WHERE managed = ?"), true)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	managed := make(map[string]bool)
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		managed[symbol] = true
+	}
+	return managed, rows.Err()
+}
+
+// currencyValues returns the values of the name, decimals, active and detail
+// columns of an active currency c.
+func currencyValues(table currencyTable, c Currency) []interface{} {
+	values := []interface{}{c.Name, c.Decimals, true}
+	for _, field := range table.fields(&c) {
+		values = append(values, sql.NullString{String: *field, Valid: *field != ""})
+	}
+	return values
+}
+
+// insertCurrency adds the active currency c to its table, managed by the
+// manifest or not.
+func (d *Database) insertCurrency(tx *sql.Tx, table currencyTable, c Currency, managed bool) error {
+	values := append(append([]interface{}{c.Symbol}, currencyValues(table, c)...), managed)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	_, err := tx.Exec(d.dialect.rebind("INSERT INTO "+table.table+" ("+table.selectColumns()+", managed) VALUES ("+placeholders+")"), values...)
+	return err
+}
+
+// scanCurrency scans a row selecting the symbol, name, decimals and active flag
+// of a currency followed by the detail columns of its table.
+func scanCurrency(row interface{ Scan(...interface{}) error }, table currencyTable, c *Currency, active *bool) error {
+	var name sql.NullString
+	details := make([]sql.NullString, len(table.details))
+	dest := []interface{}{&c.Symbol, &name, &c.Decimals, active}
+	for i := range details {
+		dest = append(dest, &details[i])
+	}
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	c.Name = name.String
+	for i, field := range table.fields(c) {
+		*field = details[i].String
+	}
+	return nil
+}
+
+// ListCurrencies returns the currencies of the given type, or of every type
+// if currencyType is empty, cryptocurrencies first and then by symbol. The
+// disabled currencies are only included with includeInactive.
+func (d *Database) ListCurrencies(currencyType string, includeInactive bool) ([]Currency, error) {
+	currencies := make([]Currency, 0)
+	for _, table := range currencyTables {
+		if currencyType != "" && currencyType != table.currencyType {
+			continue
+		}
+
+		query := "SELECT " + table.selectColumns() + " FROM " + table.table
+		if !includeInactive {
+			query += " WHERE active"
+		}
+		aliases, err := d.loadAliases(d.DB, table)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := d.query(query + " ORDER BY symbol")
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			c := Currency{Type: table.currencyType}
+			if err := scanCurrency(rows, table, &c, &c.Active); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			c.Aliases = aliases[c.Symbol]
+			currencies = append(currencies, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return currencies, nil
+}
+
+// AddCurrency adds the currency c, active, so that it is served and ingested
+// from the next ingestion run. SeedCurrencies leaves it active until a
+// manifest lists it. It returns ErrCurrencyExists if a currency of
+// the same type and symbol exists, even disabled, if its symbol is an alias of
+// another currency, or if one of its aliases already names another currency.
+// It returns the currency as stored and calls the functions registered with
+// OnChange.
+func (d *Database) AddCurrency(c Currency) (Currency, error) {
+	if err := ValidateCurrencies([]Currency{c}); err != nil {
+		return Currency{}, err
+	}
+	table, err := currencyTableFor(c.Type)
+	if err != nil {
+		return Currency{}, err
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return Currency{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := d.getCurrency(tx, table, c.Symbol); err == nil {
+		return Currency{}, fmt.Errorf("%s currency %s: %w", c.Type, c.Symbol, ErrCurrencyExists)
+	} else if !errors.Is(err, ErrNotFound) {
+		return Currency{}, err
+	}
+	queryRow := func(query string, args ...interface{}) *sql.Row {
+		return tx.QueryRow(d.dialect.rebind(query), args...)
+	}
+	if symbol, err := d.resolveCurrency(queryRow, table, c.Symbol); err == nil || errors.Is(err, ErrCurrencyDisabled) {
+		return Currency{}, fmt.Errorf("%s currency %s, an alias of %s: %w", c.Type, c.Symbol, symbol, ErrCurrencyExists)
+	} else if !errors.Is(err, ErrUnknownCurrency) {
+		return Currency{}, err
+	}
+	for _, alias := range c.Aliases {
+		symbol, err := d.resolveCurrency(queryRow, table, alias)
+		if err == nil || errors.Is(err, ErrCurrencyDisabled) {
+			return Currency{}, fmt.Errorf("%s alias %s of %s: %w", c.Type, alias, symbol, ErrCurrencyExists)
+		} else if !errors.Is(err, ErrUnknownCurrency) {
+			return Currency{}, err
+		}
+	}
+	if err := d.insertCurrency(tx, table, c, false); err != nil {
+		return Currency{}, err
+	}
+	if err := d.replaceAliases(tx, table, []Currency{c}); err != nil {
+		return Currency{}, err
+	}
+	added, err := d.getCurrency(tx, table, c.Symbol)
+	if err != nil {
+		return Currency{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Currency{}, err
+	}
+	d.changed()
+	return added, nil
+}
+
+// SetCurrencyActive enables or disables the currency of the given type and
+// symbol and returns it. A disabled currency keeps its exchange rates but is
+// neither served nor ingested. It returns ErrNotFound if the currency does
+// not exist. A change calls the functions registered with OnChange.
+func (d *Database) SetCurrencyActive(currencyType, symbol string, active bool) (Currency, error) {
+	table, err := currencyTableFor(currencyType)
+	if err != nil {
+		return Currency{}, err
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return Currency{}, err
+	}
+	defer tx.Rollback()
+
+	c, err := d.getCurrency(tx, table, symbol)
+	if err != nil {
+		return Currency{}, err
+	}
+	if c.Active == active {
+		return c, tx.Commit()
+	}
+	if _, err := tx.Exec(d.dialect.rebind("UPDATE "+table.table+" SET active = ? WHERE symbol = ?"), active, symbol); err != nil {
+		return Currency{}, err
+	}
+	c.Active = active
+	if err := tx.Commit(); err != nil {
+		return Currency{}, err
+	}
+	d.changed()
+	return c, nil
+}
+
+// RemoveCurrency deletes the currency of the given type and symbol, such as
+// one added by mistake. A currency with exchange rates cannot be removed,
+// since its history would be lost, and returns ErrCurrencyInUse; disable it
+// instead. It returns ErrNotFound if the currency does not exist. It calls the
+// functions registered with OnChange.
+func (d *Database) RemoveCurrency(currencyType, symbol string) error {
+	table, err := currencyTableFor(currencyType)
+	if err != nil {
+		return err
+	}
+	rateTables, err := d.rateTables(time.Time{}, time.Time{}, true)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(d.dialect.rebind("SELECT "+table.idColumn()+" FROM "+table.table+" WHERE symbol = ?"), symbol).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s currency %s: %w", currencyType, symbol, ErrNotFound)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, rates := range append(rateTables, "LatestRates", "HourlyRates", "DailyRates") {
+		var used bool
+		query := "SELECT EXISTS (SELECT 1 FROM " + rates + " WHERE " + table.idColumn() + " = ?)"
+		if err := tx.QueryRow(d.dialect.rebind(query), id).Scan(&used); err != nil {
+			return err
+		}
+		if used {
+			return fmt.Errorf("%s currency %s: %w", currencyType, symbol, ErrCurrencyInUse)
+		}
+	}
+
+	if err := d.replaceAliases(tx, table, []Currency{{Symbol: symbol}}); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(d.dialect.rebind("DELETE FROM "+table.table+" WHERE symbol = ?"), symbol); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.changed()
+	return nil
+}
+
+// getCurrency returns the currency of table with the given symbol, or
+// ErrNotFound.
+func (d *Database) getCurrency(tx *sql.Tx, table currencyTable, symbol string) (Currency, error) {
+	c := Currency{Type: table.currencyType}
+	row := tx.QueryRow(d.dialect.rebind("SELECT "+table.selectColumns()+" FROM "+table.table+" WHERE symbol = ?"), symbol)
+	err := scanCurrency(row, table, &c, &c.Active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Currency{}, fmt.Errorf("%s currency %s: %w", table.currencyType, symbol, ErrNotFound)
+	}
+	if err != nil {
+		return Currency{}, err
+	}
+	aliases, err := d.loadAliases(tx, table)
+	if err != nil {
+		return Currency{}, err
+	}
+	c.Aliases = aliases[symbol]
+	return c, nil
+}
+
+// isISONumeric reports whether code is an ISO 4217 numeric code.
+func isISONumeric(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedCurrencies returns the stored currencies ordered by symbol, so that
+// reports are stable.
+func sortedCurrencies(currencies map[string]storedCurrency) []storedCurrency {
+	sorted := make([]storedCurrency, 0, len(currencies))
+	for _, c := range currencies {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Symbol < sorted[j].Symbol
+	})
+	return sorted
+}
@@ -0,0 +1,250 @@
+package ratestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCurrencies = []Currency{
+	{Symbol: "BTC", Name: "Bitcoin", Type: CurrencyTypeCrypto, Decimals: 8},
+	{Symbol: "ETH", Name: "Ethereum", Type: CurrencyTypeCrypto, Decimals: 18},
+	{Symbol: "USD", Name: "US Dollar", Type: CurrencyTypeFiat, Decimals: 2},
+	{Symbol: "JPY", Name: "Japanese Yen", Type: CurrencyTypeFiat, Decimals: 0},
+}
+
+func TestValidateCurrencies(t *testing.T) {
+	assert.NoError(t, ValidateCurrencies(testCurrencies))
+
+	err := ValidateCurrencies([]Currency{
+		{Symbol: "btc", Name: "Bitcoin", Type: CurrencyTypeCrypto},
+		{Symbol: "ETH", Type: "token", Decimals: 19},
+		{Symbol: "USD", Name: "US Dollar", Type: CurrencyTypeFiat},
+		{Symbol: "USD", Name: "US Dollar", Type: CurrencyTypeFiat},
+		{Name: "Nameless", Type: CurrencyTypeFiat},
+		{Symbol: "EUR", Name: "Euro", Type: CurrencyTypeFiat, ISONumeric: "97", Chain: "ethereum"},
+		{Symbol: "USDT", Name: "Tether", Type: CurrencyTypeCrypto, ISONumeric: "840", ContractAddress: "0xdac17f958d2ee523a2206206994597c13d831ec7"},
+	})
+	require.Error(t, err)
+	for _, problem := range []string{
+		"currency btc: symbol must be upper case",
+		"currency ETH: name is required",
+		`currency ETH: unsupported type "token"`,
+		"currency ETH: decimals must be between 0 and 18",
+		"currency USD: listed more than once",
+		"currency 5: symbol is required",
+		"currency EUR: iso_numeric must be 3 digits",
+		"currency EUR: chain and contract_address are only for crypto currencies",
+		"currency USDT: iso_numeric is only for fiat currencies",
+		"currency USDT: contract_address requires a chain",
+	} {
+		assert.Contains(t, err.Error(), problem)
+	}
+}
+
+func TestSeedCurrencies(t *testing.T) {
+	db := newTestDatabase(t)
+	changes := 0
+	db.OnChange(func() { changes++ })
+
+	report, err := db.SeedCurrencies(testCurrencies, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Currency{testCurrencies[3]}, report.Added)
+	assert.Equal(t, []Currency{testCurrencies[0], testCurrencies[1], testCurrencies[2]}, report.Updated)
+	assert.Equal(t, []Currency{{Symbol: "INR", Type: CurrencyTypeFiat}}, report.Disabled)
+
+	exists, err := db.CheckFiatCurrency("INR")
+	assert.ErrorIs(t, err, ErrCurrencyDisabled)
+	assert.False(t, exists)
+
+	fiats, err := db.GetFiatMappings()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"USD": 1, "JPY": 3}, fiats)
+
+	report, err = db.SeedCurrencies(testCurrencies, false)
+	require.NoError(t, err)
+	assert.Equal(t, SeedReport{}, report)
+	assert.Equal(t, 1, changes, "only a seed changing currencies calls OnChange")
+}
+
+func TestSeedCurrenciesKeepsAddedCurrencies(t *testing.T) {
+	db := newTestDatabase(t)
+	_, err := db.SeedCurrencies(testCurrencies, false)
+	require.NoError(t, err)
+
+	pepe := Currency{Symbol: "PEPE", Name: "Pepe", Type: CurrencyTypeCrypto, Decimals: 18}
+	_, err = db.AddCurrency(pepe)
+	require.NoError(t, err)
+	report, err := db.SeedCurrencies(testCurrencies, false)
+	require.NoError(t, err)
+	assert.Equal(t, SeedReport{}, report, "a currency added by the admin is not disabled")
+	exists, err := db.CheckCryptoCurrency("PEPE")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// Once a manifest lists it, the manifest manages it.
+	report, err = db.SeedCurrencies(append(testCurrencies[:4:4], pepe), false)
+	require.NoError(t, err)
+	assert.Equal(t, []Currency{pepe}, report.Updated)
+	report, err = db.SeedCurrencies(testCurrencies, false)
+	require.NoError(t, err)
+	assert.Equal(t, []Currency{{Symbol: "PEPE", Name: "Pepe", Type: CurrencyTypeCrypto, Decimals: 18}}, report.Disabled)
+}
+
+func TestSeedCurrenciesEnablesAgain(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := db.SeedCurrencies(testCurrencies[:3], false)
+	require.NoError(t, err)
+
+	inr := Currency{Symbol: "INR", Name: "Indian Rupee", Type: CurrencyTypeFiat, Decimals: 2}
+	report, err := db.SeedCurrencies(append(testCurrencies[:3:3], inr), false)
+	require.NoError(t, err)
+	assert.Equal(t, []Currency{inr}, report.Updated)
+
+	exists, err := db.CheckFiatCurrency("INR")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestSeedCurrenciesDryRun(t *testing.T) {
+	db := newTestDatabase(t)
+
+	changes := 0
+	db.OnChange(func() { changes++ })
+
+	report, err := db.SeedCurrencies(testCurrencies, true)
+	require.NoError(t, err)
+	assert.Len(t, report.Added, 1)
+	assert.Zero(t, changes)
+
+	exists, err := db.CheckFiatCurrency("JPY")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestSeedCurrenciesInvalid(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := db.SeedCurrencies([]Currency{{Symbol: "BTC", Type: CurrencyTypeCrypto}}, false)
+	assert.Error(t, err)
+}
+
+func TestSeedCurrenciesDetails(t *testing.T) {
+	db := newTestDatabase(t)
+
+	usdt := Currency{Symbol: "USDT", Name: "Tether", Type: CurrencyTypeCrypto, Decimals: 6,
+		Chain: "ethereum", ContractAddress: "0xdac17f958d2ee523a2206206994597c13d831ec7"}
+	usd := Currency{Symbol: "USD", Name: "US Dollar", Type: CurrencyTypeFiat, Decimals: 2, ISONumeric: "840"}
+	_, err := db.SeedCurrencies([]Currency{usdt, usd}, false)
+	require.NoError(t, err)
+
+	currencies, err := db.ListCurrencies("", false)
+	require.NoError(t, err)
+	usdt.Active, usd.Active = true, true
+	assert.Equal(t, []Currency{usdt, usd}, currencies)
+
+	usdt.Active, usd.Active = false, false
+	usdt.Chain = "tron"
+	usdt.ContractAddress = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	report, err := db.SeedCurrencies([]Currency{usdt, usd}, false)
+	require.NoError(t, err)
+	assert.Equal(t, SeedReport{Updated: []Currency{usdt}}, report)
+}
+
+func TestListCurrencies(t *testing.T) {
+	db := newTestDatabase(t)
+	_, err := db.SeedCurrencies(testCurrencies, false)
+	require.NoError(t, err)
+
+	symbols := func(currencies []Currency) []string {
+		var symbols []string
+		for _, c := range currencies {
+			symbols = append(symbols, c.Symbol)
+		}
+		return symbols
+	}
+
+	currencies, err := db.ListCurrencies("", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BTC", "ETH", "JPY", "USD"}, symbols(currencies))
+
+	currencies, err = db.ListCurrencies(CurrencyTypeFiat, true)
+	require.NoError(t, err)
+	assert.Equal(t, []Currency{
+		{Symbol: "INR", Type: CurrencyTypeFiat},
+		{Symbol: "JPY", Name: "Japanese Yen", Type: CurrencyTypeFiat, Active: true},
+		{Symbol: "USD", Name: "US Dollar", Type: CurrencyTypeFiat, Decimals: 2, Active: true},
+	}, currencies)
+
+	currencies, err = db.ListCurrencies(CurrencyTypeCrypto, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BTC", "ETH"}, symbols(currencies))
+}
+
+func TestAddCurrency(t *testing.T) {
+	db := newTestDatabase(t)
+
+	usdc := Currency{Symbol: "USDC", Name: "USD Coin", Type: CurrencyTypeCrypto, Decimals: 6,
+		Chain: "ethereum", ContractAddress: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"}
+	added, err := db.AddCurrency(usdc)
+	require.NoError(t, err)
+	usdc.Active = true
+	assert.Equal(t, usdc, added, "the currency is returned as stored")
+
+	exists, err := db.CheckCryptoCurrency("USDC")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	cryptos, err := db.GetCryptoMappings()
+	assert.NoError(t, err)
+	assert.Contains(t, cryptos, "USDC")
+
+	_, err = db.AddCurrency(usdc)
+	assert.ErrorIs(t, err, ErrCurrencyExists)
+	_, err = db.AddCurrency(Currency{Symbol: "usdc", Type: CurrencyTypeCrypto})
+	assert.Error(t, err)
+}
+
+func TestSetCurrencyActive(t *testing.T) {
+	db := newTestDatabase(t)
+
+	c, err := db.SetCurrencyActive(CurrencyTypeCrypto, "ETH", false)
+	require.NoError(t, err)
+	assert.Equal(t, Currency{Symbol: "ETH", Type: CurrencyTypeCrypto}, c)
+
+	exists, err := db.CheckCryptoCurrency("ETH")
+	assert.ErrorIs(t, err, ErrCurrencyDisabled)
+	assert.False(t, exists)
+	cryptos, err := db.GetCryptoMappings()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"BTC": 1}, cryptos)
+
+	c, err = db.SetCurrencyActive(CurrencyTypeCrypto, "ETH", true)
+	require.NoError(t, err)
+	assert.True(t, c.Active)
+	exists, err = db.CheckCryptoCurrency("ETH")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	_, err = db.SetCurrencyActive(CurrencyTypeFiat, "ETH", false)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = db.SetCurrencyActive("stablecoin", "USDT", false)
+	assert.Error(t, err)
+}
+
+func TestRemoveCurrency(t *testing.T) {
+	db := newTestDatabase(t)
+	insertTestRate(t, db, 1, 1, "30150.12", time.Now())
+
+	require.NoError(t, db.RemoveCurrency(CurrencyTypeCrypto, "ETH"))
+	exists, err := db.CheckCryptoCurrency("ETH")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.ErrorIs(t, db.RemoveCurrency(CurrencyTypeCrypto, "ETH"), ErrNotFound)
+	assert.ErrorIs(t, db.RemoveCurrency(CurrencyTypeCrypto, "BTC"), ErrCurrencyInUse)
+	assert.ErrorIs(t, db.RemoveCurrency(CurrencyTypeFiat, "USD"), ErrCurrencyInUse)
+	assert.NoError(t, db.RemoveCurrency(CurrencyTypeFiat, "INR"))
+}
@@ -0,0 +1,266 @@
+package ratestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	_ "modernc.org/sqlite"
+)
+
+// Database is the SQL implementation of RateStore, backed by MySQL, SQLite or
+// PostgreSQL.
+type Database struct {
+	DB      *sql.DB
+	dialect dialect
+	// rawRetention is how long Rollup keeps raw rates, or zero for ever.
+	rawRetention time.Duration
+	// insertChunkSize is the number of rows of each multi-row INSERT.
+	insertChunkSize int
+	// rateBucket is the period of which a pair keeps one raw rate per source.
+	rateBucket time.Duration
+	// partitioned stores the raw rates of every month in its partition.
+	partitioned bool
+
+	// replicas serve the reads of clients while they lag less than
+	// maxReplicaLag, in turn from nextReplica.
+	replicas      []*replica
+	maxReplicaLag time.Duration
+	nextReplica   uint32
+
+	// onChange are called after the latest rates served change.
+	onChangeMu sync.Mutex
+	onChange   []func()
+}
+
+var _ RateStore = (*Database)(nil)
+
+// NewDatabase opens a connection pool to the database described by cfg, and
+// one to each of its read replicas, and checks that the primary database is
+// reachable. The returned Database is meant to be kept for the lifetime of the
+// process and shared by every request.
+func NewDatabase(cfg Config) (*Database, error) {
+	cfg = cfg.withDefaults()
+
+	dialect, err := dialectFor(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openPool(cfg, dialect)
+	if err != nil {
+		return nil, err
+	}
+	replicas, err := openReplicas(cfg, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	d := &Database{DB: db, dialect: dialect, rawRetention: cfg.RawRetention, insertChunkSize: cfg.InsertChunkSize,
+		rateBucket: cfg.RateBucket, partitioned: cfg.PartitionRates, replicas: replicas, maxReplicaLag: cfg.MaxReplicaLag}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HealthCheckTimeout)
+	defer cancel()
+	if err := d.HealthCheck(ctx); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// OnChange registers fn to be called after the latest rates served or the
+// currencies they are requested by change: a new snapshot replaces the rates
+// of a source, or a currency is added, removed, enabled or disabled. It is
+// how a CachedStore of the database is invalidated.
+func (d *Database) OnChange(fn func()) {
+	d.onChangeMu.Lock()
+	defer d.onChangeMu.Unlock()
+	d.onChange = append(d.onChange, fn)
+}
+
+// LatestSnapshotID returns the ID of the latest snapshot stored, of any
+// source, or 0 if there is none. It changes with every ingested batch, so a
+// process can tell cheaply whether another one ingested since it last looked.
+func (d *Database) LatestSnapshotID() (int64, error) {
+	var id sql.NullInt64
+	err := d.readQueryRow("SELECT MAX(snapshot_id) FROM Snapshots").Scan(&id)
+	return id.Int64, err
+}
+
+// changed calls the functions registered with OnChange.
+func (d *Database) changed() {
+	d.onChangeMu.Lock()
+	onChange := d.onChange
+	d.onChangeMu.Unlock()
+	for _, fn := range onChange {
+		fn()
+	}
+}
+
+// openPool opens a connection pool with the pool settings of cfg.
+func openPool(cfg Config, dialect dialect) (*sql.DB, error) {
+	db, err := sql.Open(dialect.name, dialect.dsn(cfg))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// HealthCheck verifies that a connection to the database can be established
+// and used.
+func (d *Database) HealthCheck(ctx context.Context) error {
+	var one int
+	return d.DB.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+func (d *Database) Close() error {
+	err := d.DB.Close()
+	if replicaErr := closeReplicas(d.replicas); err == nil {
+		err = replicaErr
+	}
+	return err
+}
+
+func (d *Database) CheckCryptoCurrency(crypto string) (bool, error) {
+	_, err := d.ResolveCryptoCurrency(crypto)
+	return checkResolved(err)
+}
+
+func (d *Database) CheckFiatCurrency(fiat string) (bool, error) {
+	_, err := d.ResolveFiatCurrency(fiat)
+	return checkResolved(err)
+}
+
+// checkResolved turns the error of resolving a symbol into the result of
+// checking it: an unknown symbol is not an error.
+func checkResolved(err error) (bool, error) {
+	if errors.Is(err, ErrUnknownCurrency) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *Database) GetExchangeRate(crypto, fiat, source string) (decimal.Decimal, Snapshot, error) {
+	query := `
+	SELECT lr.rate, s.snapshot_id, s.taken_at, lr.source
+	FROM LatestRates lr
+	JOIN Snapshots s ON s.snapshot_id = lr.snapshot_id
+	JOIN Cryptocurrencies c ON c.cryptocurrency_id = lr.cryptocurrency_id
+	JOIN FiatCurrencies f ON f.fiat_currency_id = lr.fiat_currency_id
+	WHERE c.symbol = ? AND f.symbol = ? AND lr.source = ?
+	`
+
+	row := d.readQueryRow(query, crypto, fiat, sourceOrDefault(source))
+
+	var rate decimal.Decimal
+	var snapshot Snapshot
+	err := row.Scan(&rate, &snapshot.ID, &snapshot.TakenAt, &snapshot.Source)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return decimal.Decimal{}, Snapshot{}, ErrNotFound
+		}
+		return decimal.Decimal{}, Snapshot{}, err
+	}
+	snapshot.TakenAt = snapshot.TakenAt.UTC()
+
+	return rate, snapshot, nil
+}
+
+func (d *Database) GetExchangeRatesForCrypto(crypto, source string) (map[string]decimal.Decimal, Snapshot, error) {
+	query := `
+	SELECT f.symbol, lr.rate, s.snapshot_id, s.taken_at, lr.source
+	FROM LatestRates lr
+	JOIN Snapshots s ON s.snapshot_id = lr.snapshot_id
+	JOIN Cryptocurrencies c ON c.cryptocurrency_id = lr.cryptocurrency_id
+	JOIN FiatCurrencies f ON f.fiat_currency_id = lr.fiat_currency_id
+	WHERE c.symbol = ? AND f.active AND lr.source = ?
+	`
+
+	rows, err := d.readQuery(query, crypto, sourceOrDefault(source))
+	if err != nil {
+		return nil, Snapshot{}, err
+	}
+	defer rows.Close()
+
+	rates := make(map[string]decimal.Decimal)
+	var snapshot Snapshot
+	for rows.Next() {
+		var fiat string
+		var rate decimal.Decimal
+		if err := rows.Scan(&fiat, &rate, &snapshot.ID, &snapshot.TakenAt, &snapshot.Source); err != nil {
+			return nil, Snapshot{}, err
+		}
+		rates[fiat] = rate
+	}
+	snapshot.TakenAt = snapshot.TakenAt.UTC()
+
+	return rates, snapshot, rows.Err()
+}
+
+func (d *Database) GetAllExchangeRates(source string) (map[string]map[string]decimal.Decimal, Snapshot, error) {
+	query := `
+	SELECT c.symbol, f.symbol, lr.rate, s.snapshot_id, s.taken_at, lr.source
+	FROM LatestRates lr
+	JOIN Snapshots s ON s.snapshot_id = lr.snapshot_id
+	JOIN Cryptocurrencies c ON c.cryptocurrency_id = lr.cryptocurrency_id
+	JOIN FiatCurrencies f ON f.fiat_currency_id = lr.fiat_currency_id
+	WHERE c.active AND f.active AND lr.source = ?
+	`
+
+	rows, err := d.readQuery(query, sourceOrDefault(source))
+	if err != nil {
+		return nil, Snapshot{}, err
+	}
+	defer rows.Close()
+
+	rates := make(map[string]map[string]decimal.Decimal)
+	var snapshot Snapshot
+	for rows.Next() {
+		var crypto, fiat string
+		var rate decimal.Decimal
+		if err := rows.Scan(&crypto, &fiat, &rate, &snapshot.ID, &snapshot.TakenAt, &snapshot.Source); err != nil {
+			return nil, Snapshot{}, err
+		}
+
+		if rates[crypto] == nil {
+			rates[crypto] = make(map[string]decimal.Decimal)
+		}
+		rates[crypto][fiat] = rate
+	}
+	snapshot.TakenAt = snapshot.TakenAt.UTC()
+
+	return rates, snapshot, rows.Err()
+}
+
+// GetHistoricalExchangeRates returns the rates of the last RawHistoryWindow.
+func (d *Database) GetHistoricalExchangeRates(crypto, fiat string) ([]RateWithTimestamp, error) {
+	return d.GetRateHistory(crypto, fiat, time.Now().Add(-RawHistoryWindow))
+}
+
+// query runs a query written with ? placeholders in the database's dialect.
+func (d *Database) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.DB.Query(d.dialect.rebind(query), args...)
+}
+
+// queryRow is like query but returns at most one row.
+func (d *Database) queryRow(query string, args ...interface{}) *sql.Row {
+	return d.DB.QueryRow(d.dialect.rebind(query), args...)
+}
+
+// prepare is like query but returns a prepared statement.
+func (d *Database) prepare(query string) (*sql.Stmt, error) {
+	return d.DB.Prepare(d.dialect.rebind(query))
+}
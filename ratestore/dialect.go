@@ -0,0 +1,180 @@
+package ratestore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported values of Config.Driver.
+const (
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// dialect captures how a supported database differs from the others: the
+// database/sql driver it uses, how its connection string is built, how
+// query placeholders are written, how generated IDs are read, how an insert
+// updates the row it conflicts with, how the lag of a replica is measured and
+// how a partition of the raw rates is created.
+type dialect struct {
+	name string
+	dsn  func(cfg Config) string
+	// rebind rewrites a query written with ? placeholders for the dialect.
+	rebind func(query string) string
+	// returning reports whether the ID of an inserted row is read with
+	// RETURNING rather than from the driver's LastInsertId.
+	returning bool
+	// upsert returns the clause that makes an INSERT into table update the
+	// columns of the row it conflicts with on the key columns, when the guard
+	// column of the new row compares to the stored one with op, ">" or ">=".
+	// The guard column is updated last.
+	upsert func(table string, key, columns []string, guard, op string) string
+	// replicaLag measures how far the replica db is behind its primary.
+	replicaLag func(ctx context.Context, db *sql.DB) (time.Duration, error)
+	// createPartition returns the statements creating table, if it does not
+	// exist, with the columns and indexes of ExchangeRates.
+	createPartition func(table string) []string
+}
+
+var dialects = map[string]dialect{
+	DriverMySQL: {
+		name: "mysql",
+		dsn: func(cfg Config) string {
+			return cfg.User + ":" + cfg.Password + "@tcp(" + cfg.Host + ")/" + cfg.Database + "?parseTime=true"
+		},
+		rebind:     func(query string) string { return query },
+		upsert:     onDuplicateKeyUpdate,
+		replicaLag: mysqlReplicaLag,
+		createPartition: func(table string) []string {
+			return []string{"CREATE TABLE IF NOT EXISTS " + table + " LIKE " + defaultRatesTable}
+		},
+	},
+	DriverSQLite: {
+		name: "sqlite",
+		dsn: func(cfg Config) string {
+			params := url.Values{}
+			params.Add("_pragma", "foreign_keys(1)")
+			params.Add("_pragma", "busy_timeout(5000)")
+			return "file:" + cfg.Database + "?" + params.Encode()
+		},
+		rebind:          func(query string) string { return query },
+		upsert:          onConflictDoUpdate,
+		replicaLag:      noReplicaLag,
+		createPartition: sqlitePartition,
+	},
+	DriverPostgres: {
+		name: "postgres",
+		dsn: func(cfg Config) string {
+			u := url.URL{
+				Scheme: "postgres",
+				User:   url.UserPassword(cfg.User, cfg.Password),
+				Host:   cfg.Host,
+				Path:   "/" + cfg.Database,
+			}
+			if cfg.SSLMode != "" {
+				u.RawQuery = url.Values{"sslmode": {cfg.SSLMode}}.Encode()
+			}
+			return u.String()
+		},
+		rebind:     numberedPlaceholders,
+		returning:  true,
+		upsert:     onConflictDoUpdate,
+		replicaLag: postgresReplicaLag,
+		createPartition: func(table string) []string {
+			return []string{"CREATE TABLE IF NOT EXISTS " + table + " (LIKE " + defaultRatesTable + " INCLUDING ALL)"}
+		},
+	},
+}
+
+// insertID runs an INSERT statement within tx and returns the value generated
+// for the column idColumn of the new row.
+func (d dialect) insertID(tx *sql.Tx, query, idColumn string, args ...interface{}) (int64, error) {
+	if d.returning {
+		var id int64
+		err := tx.QueryRow(d.rebind(query+" RETURNING "+idColumn), args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := tx.Exec(d.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// onDuplicateKeyUpdate is the upsert clause of MySQL, which compares the
+// guard column of every assignment with the value it has before the update.
+func onDuplicateKeyUpdate(table string, key, columns []string, guard, op string) string {
+	newer := "VALUES(" + guard + ") " + op + " " + guard
+	assignments := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		assignments = append(assignments, column+" = IF("+newer+", VALUES("+column+"), "+column+")")
+	}
+	assignments = append(assignments, guard+" = IF("+newer+", VALUES("+guard+"), "+guard+")")
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+}
+
+// onConflictDoUpdate is the upsert clause of SQLite and PostgreSQL.
+func onConflictDoUpdate(table string, key, columns []string, guard, op string) string {
+	assignments := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		assignments = append(assignments, column+" = excluded."+column)
+	}
+	assignments = append(assignments, guard+" = excluded."+guard)
+	return " ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET " + strings.Join(assignments, ", ") +
+		" WHERE excluded." + guard + " " + op + " " + table + "." + guard
+}
+
+// sqlitePartition spells out the schema of ExchangeRates, which SQLite cannot
+// copy, with index names of their own since they are global to the database.
+func sqlitePartition(table string) []string {
+	return []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		  exchange_rate_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		  cryptocurrency_id INTEGER REFERENCES Cryptocurrencies(cryptocurrency_id),
+		  fiat_currency_id INTEGER REFERENCES FiatCurrencies(fiat_currency_id),
+		  rate DECIMAL(18, 8),
+		  timestamp TIMESTAMP,
+		  snapshot_id INTEGER,
+		  source VARCHAR(50) NOT NULL DEFAULT 'cryptocompare',
+		  bucket_start TIMESTAMP
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_" + table + "_pair_timestamp ON " + table + " (cryptocurrency_id, fiat_currency_id, timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_" + table + "_timestamp ON " + table + " (timestamp)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS ux_" + table + "_bucket ON " + table + " (cryptocurrency_id, fiat_currency_id, source, bucket_start)",
+	}
+}
+
+// numberedPlaceholders rewrites the ? placeholders of query as $1, $2, ...
+func numberedPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dialectFor returns the dialect of driver, which defaults to MySQL.
+func dialectFor(driver string) (dialect, error) {
+	if driver == "" {
+		driver = DriverMySQL
+	}
+	d, ok := dialects[driver]
+	if !ok {
+		return dialect{}, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	return d, nil
+}
@@ -0,0 +1,505 @@
+package ratestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ExchangeRate represents the exchange rate data to be inserted into the database
+type ExchangeRate struct {
+	CryptoID  int             `json:"cryptocurrency_id"`
+	FiatID    int             `json:"fiat_currency_id"`
+	Rate      decimal.Decimal `json:"rate"`
+	Timestamp time.Time       `json:"timestamp"`
+	// Source is the price source the rate was fetched from, or DefaultSource
+	// if empty.
+	Source string `json:"source,omitempty"`
+}
+
+// GetCryptoMappings fetches the symbol-ID mappings for the active cryptocurrencies from the database.
+func (d *Database) GetCryptoMappings() (map[string]int, error) {
+	return d.symbolMappings("SELECT symbol, cryptocurrency_id FROM Cryptocurrencies WHERE active")
+}
+
+// GetFiatMappings fetches the symbol-ID mappings for the active fiat currencies from the database.
+func (d *Database) GetFiatMappings() (map[string]int, error) {
+	return d.symbolMappings("SELECT symbol, fiat_currency_id FROM FiatCurrencies WHERE active")
+}
+
+func (d *Database) symbolMappings(query string) (map[string]int, error) {
+	rows, err := d.query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := make(map[string]int)
+	for rows.Next() {
+		var symbol string
+		var id int
+		if err := rows.Scan(&symbol, &id); err != nil {
+			return nil, err
+		}
+		mappings[symbol] = id
+	}
+
+	return mappings, rows.Err()
+}
+
+// InsertExchangeRates inserts the exchange rates into the database as one new
+// snapshot, taken at the latest timestamp of the rates, in multi-row INSERT
+// statements of Config.InsertChunkSize rows. The rates must all
+// come from the same source. Unless a later snapshot of that source is already
+// being served, the new snapshot replaces the latest rates of the source in
+// the same transaction, so readers see either all of its rates or none of
+// them. The latest rates of the other sources are left alone.
+//
+// A pair keeps one raw rate of a source per Config.RateBucket, the latest: a
+// rate falling in the bucket of a stored rate replaces it if it is newer and
+// is dropped otherwise. A batch that changes no stored rate, such as a
+// replayed ingestion, writes nothing and returns the zero Snapshot.
+//
+// With Config.PartitionRates, the raw rates go to the partition of their
+// month, which is created with the first rates of the month.
+//
+// The functions registered with OnChange are called once the new snapshot
+// is served.
+func (d *Database) InsertExchangeRates(rates []ExchangeRate) (Snapshot, error) {
+	snapshot, served, err := d.insertSnapshot(rates)
+	if served {
+		d.changed()
+	}
+	return snapshot, err
+}
+
+// insertSnapshot is InsertExchangeRates without the OnChange notification,
+// and reports whether the new snapshot replaced the latest rates served.
+func (d *Database) insertSnapshot(rates []ExchangeRate) (Snapshot, bool, error) {
+	if len(rates) == 0 {
+		return Snapshot{}, false, nil
+	}
+
+	source, err := batchSource(rates)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	rates = latestPerBucket(rates, d.bucketSize())
+
+	snapshot := Snapshot{Source: source}
+	for _, rate := range rates {
+		if rate.Timestamp.After(snapshot.TakenAt) {
+			snapshot.TakenAt = rate.Timestamp
+		}
+	}
+	snapshot.TakenAt = snapshot.TakenAt.UTC()
+
+	groups, err := d.groupRates(rates)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	defer tx.Rollback()
+
+	var current time.Time
+	err = tx.QueryRow(d.dialect.rebind("SELECT taken_at FROM Snapshots WHERE snapshot_id = (SELECT MAX(snapshot_id) FROM LatestRates WHERE source = ?)"),
+		source).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Snapshot{}, false, err
+	}
+
+	// The rates are counted once written, since the snapshot must exist
+	// before the rates referencing it.
+	snapshot.ID, err = d.dialect.insertID(tx, "INSERT INTO Snapshots (taken_at, rates, source) VALUES (?, ?, ?)", "snapshot_id",
+		snapshot.TakenAt, 0, source)
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+
+	var written int64
+	for _, group := range groups {
+		if _, err := d.insertRates(tx, group.table, true, group.rates, snapshot.ID, source); err != nil {
+			return Snapshot{}, false, err
+		}
+		n, err := d.countSnapshotRates(tx, group, snapshot.ID)
+		if err != nil {
+			return Snapshot{}, false, err
+		}
+		written += n
+	}
+	if written == 0 {
+		// Rolling back also drops the snapshot.
+		return Snapshot{}, false, nil
+	}
+	if _, err := tx.Exec(d.dialect.rebind("UPDATE Snapshots SET rates = ? WHERE snapshot_id = ?"), written, snapshot.ID); err != nil {
+		return Snapshot{}, false, err
+	}
+
+	if snapshot.TakenAt.Before(current) {
+		return snapshot, false, tx.Commit()
+	}
+
+	if _, err := tx.Exec(d.dialect.rebind("DELETE FROM LatestRates WHERE source = ?"), source); err != nil {
+		return Snapshot{}, false, err
+	}
+	if _, err := d.insertRates(tx, "LatestRates", false, latestPerPair(rates), snapshot.ID, source); err != nil {
+		return Snapshot{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Snapshot{}, false, err
+	}
+	return snapshot, true, nil
+}
+
+// countSnapshotRates returns the number of rates of group that the upsert
+// stored with the snapshot, inserted or updated, leaving out the rates older
+// than the stored rate of their bucket. The rows affected cannot tell, since
+// MySQL counts an updated row twice. An upserted rate keeps its timestamp, so
+// the rows are found through the timestamp index.
+func (d *Database) countSnapshotRates(tx *sql.Tx, group rateGroup, snapshotID int64) (int64, error) {
+	first, last := group.rates[0].Timestamp, group.rates[0].Timestamp
+	for _, rate := range group.rates {
+		if rate.Timestamp.Before(first) {
+			first = rate.Timestamp
+		}
+		if rate.Timestamp.After(last) {
+			last = rate.Timestamp
+		}
+	}
+
+	var n int64
+	err := tx.QueryRow(d.dialect.rebind("SELECT COUNT(*) FROM "+group.table+" WHERE timestamp >= ? AND timestamp <= ? AND snapshot_id = ?"),
+		first.UTC(), last.UTC(), snapshotID).Scan(&n)
+	return n, err
+}
+
+// bucketSize returns the rate bucket of d.
+func (d *Database) bucketSize() time.Duration {
+	if d.rateBucket <= 0 {
+		return DefaultRateBucket
+	}
+	return d.rateBucket
+}
+
+// rateColumns are the columns insertRates writes, in the order of its values.
+var rateColumns = []string{"cryptocurrency_id", "fiat_currency_id", "rate", "timestamp", "snapshot_id", "source"}
+
+// insertRates writes rates to table, ExchangeRates, a partition of it or
+// LatestRates, with
+// multi-row INSERT statements of at most the insert chunk size of d each, and
+// returns the number of rows inserted or updated. With bucketed, every rate is
+// stored with its bucket_start and upserted on its pair, source and bucket.
+func (d *Database) insertRates(tx *sql.Tx, table string, bucketed bool, rates []ExchangeRate, snapshotID int64, source string) (int64, error) {
+	chunkSize := d.insertChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultInsertChunkSize
+	}
+	columns := rateColumns
+	suffix := ""
+	if bucketed {
+		columns = append(columns[:len(columns):len(columns)], "bucket_start")
+		suffix = d.dialect.upsert(table, []string{"cryptocurrency_id", "fiat_currency_id", "source", "bucket_start"},
+			[]string{"rate", "snapshot_id"}, "timestamp", ">")
+	}
+
+	var written int64
+	var full *sql.Stmt
+	for start := 0; start < len(rates); start += chunkSize {
+		chunk := rates[start:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+
+		args := make([]interface{}, 0, len(chunk)*len(columns))
+		for _, rate := range chunk {
+			args = append(args, rate.CryptoID, rate.FiatID, rate.Rate, rate.Timestamp.UTC(), snapshotID, source)
+			if bucketed {
+				args = append(args, bucketStart(rate.Timestamp, d.bucketSize()))
+			}
+		}
+
+		// Every chunk but the last is full, so their statement is prepared
+		// once.
+		var result sql.Result
+		var err error
+		if len(chunk) < chunkSize {
+			result, err = tx.Exec(d.dialect.rebind(insertRatesQuery(table, columns, len(chunk))+suffix), args...)
+		} else {
+			if full == nil {
+				full, err = tx.Prepare(d.dialect.rebind(insertRatesQuery(table, columns, chunkSize) + suffix))
+				if err != nil {
+					return 0, err
+				}
+				defer full.Close()
+			}
+			result, err = full.Exec(args...)
+		}
+		if err != nil {
+			return 0, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// insertRatesQuery returns the INSERT statement of rows rows of columns into
+// table.
+func insertRatesQuery(table string, columns []string, rows int) string {
+	placeholders := "(?" + strings.Repeat(", ?", len(columns)-1) + ")"
+
+	var query strings.Builder
+	query.WriteString("INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES ")
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString(placeholders)
+	}
+	return query.String()
+}
+
+// bucketStart returns the start of the rate bucket of the given size that t
+// falls in.
+func bucketStart(t time.Time, size time.Duration) time.Time {
+	return t.UTC().Truncate(size)
+}
+
+// rateKey identifies the rates latestPer keeps one of.
+type rateKey struct {
+	cryptoID, fiatID int
+	bucket           int64
+}
+
+// latestPerPair returns the latest of the rates of every pair, in the order
+// the pairs first appear. Of two rates with the same timestamp the later one
+// in rates wins.
+func latestPerPair(rates []ExchangeRate) []ExchangeRate {
+	return latestPer(rates, func(rate ExchangeRate) rateKey {
+		return rateKey{cryptoID: rate.CryptoID, fiatID: rate.FiatID}
+	})
+}
+
+// latestPerBucket returns the latest of the rates of every pair in every rate
+// bucket of the given size, like latestPerPair.
+func latestPerBucket(rates []ExchangeRate, size time.Duration) []ExchangeRate {
+	return latestPer(rates, func(rate ExchangeRate) rateKey {
+		return rateKey{cryptoID: rate.CryptoID, fiatID: rate.FiatID, bucket: bucketStart(rate.Timestamp, size).UnixNano()}
+	})
+}
+
+// latestPer returns the latest of the rates of every key, in the order the
+// keys first appear.
+func latestPer(rates []ExchangeRate, key func(ExchangeRate) rateKey) []ExchangeRate {
+	index := make(map[rateKey]int)
+	var latest []ExchangeRate
+	for _, rate := range rates {
+		k := key(rate)
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(latest)
+			latest = append(latest, rate)
+		} else if !rate.Timestamp.Before(latest[i].Timestamp) {
+			latest[i] = rate
+		}
+	}
+	return latest
+}
+
+// DefaultPriceURL is the CryptoCompare endpoint returning the current price of
+// several cryptocurrencies in several fiat currencies.
+const DefaultPriceURL = "https://min-api.cryptocompare.com/data/pricemulti"
+
+// APIResponse represents the response from the price API: the rate of every
+// fiat currency, keyed by cryptocurrency symbol. The rates are decoded from
+// the digits of the JSON numbers, never through float64.
+type APIResponse map[string]map[string]decimal.Decimal
+
+// IngestResult describes a completed ingestion run.
+type IngestResult struct {
+	// RunID is the ID of the run in the ingestion ledger.
+	RunID     int64 `json:"run_id"`
+	Requested int   `json:"requested"`
+	Received  int   `json:"received"`
+	Skipped   int   `json:"skipped"`
+	// Rates is the number of rates stored, 0 if the run only repeated rates
+	// already stored.
+	Rates     int          `json:"rates"`
+	Timestamp time.Time    `json:"timestamp"`
+	Snapshot  Snapshot     `json:"snapshot"`
+	Rollup    RollupResult `json:"rollup"`
+}
+
+// Ingester fetches the current rates of the active currencies from the price
+// API and stores them. It is used by the updatetable function and the
+// cryptolocal scheduler.
+type Ingester struct {
+	DB *Database
+	// Client is used for the API call, or http.DefaultClient if nil.
+	Client *http.Client
+	// PriceURL is the price endpoint, or DefaultPriceURL if empty.
+	PriceURL string
+	// Provider names the price API in the ingestion ledger and is the source
+	// the rates are stored under, or ProviderCryptoCompare if empty.
+	Provider string
+}
+
+// Ingest fetches and stores the current rates of every active pair of
+// currencies, all stamped with the same time, and then brings the rollups up
+// to date. The run is recorded in the ingestion ledger, with its counts and
+// error, whether it succeeds or not.
+func (i *Ingester) Ingest(ctx context.Context) (IngestResult, error) {
+	run := IngestionRun{StartedAt: time.Now().UTC(), Provider: i.Provider}
+	if run.Provider == "" {
+		run.Provider = ProviderCryptoCompare
+	}
+
+	var err error
+	run.ID, err = i.DB.StartIngestionRun(run.Provider, run.StartedAt)
+	if err != nil {
+		return IngestResult{}, fmt.Errorf("recording ingestion run: %w", err)
+	}
+
+	result, err := i.ingest(ctx, run.Provider)
+	result.RunID = run.ID
+
+	finishedAt := time.Now().UTC()
+	run.FinishedAt = &finishedAt
+	run.Status = RunStatusSucceeded
+	if err != nil {
+		run.Status, run.Error = RunStatusFailed, err.Error()
+	}
+	run.Requested, run.Received, run.Inserted, run.Skipped = result.Requested, result.Received, result.Rates, result.Skipped
+	run.SnapshotID = result.Snapshot.ID
+	if finishErr := i.DB.FinishIngestionRun(run); finishErr != nil {
+		if err != nil {
+			return result, fmt.Errorf("%w (recording ingestion run: %v)", err, finishErr)
+		}
+		return result, fmt.Errorf("recording ingestion run: %w", finishErr)
+	}
+
+	return result, err
+}
+
+// ingest runs the ingestion for Ingest. The counts of the returned result are
+// filled in as far as the run got, also when it fails.
+func (i *Ingester) ingest(ctx context.Context, source string) (IngestResult, error) {
+	result := IngestResult{Timestamp: time.Now().UTC()}
+
+	cryptoMappings, err := i.DB.GetCryptoMappings()
+	if err != nil {
+		return result, fmt.Errorf("fetching crypto mappings: %w", err)
+	}
+
+	fiatMappings, err := i.DB.GetFiatMappings()
+	if err != nil {
+		return result, fmt.Errorf("fetching fiat mappings: %w", err)
+	}
+
+	if len(cryptoMappings) == 0 || len(fiatMappings) == 0 {
+		return result, nil
+	}
+	result.Requested = len(cryptoMappings) * len(fiatMappings)
+
+	apiResp, err := i.fetch(ctx, sortedSymbols(cryptoMappings), sortedSymbols(fiatMappings))
+	if err != nil {
+		return result, err
+	}
+
+	var exchangeRates []ExchangeRate
+	for cryptoSymbol, rates := range apiResp {
+		result.Received += len(rates)
+		cryptoID := cryptoMappings[cryptoSymbol]
+		if cryptoID == 0 {
+			result.Skipped += len(rates)
+			continue
+		}
+		for fiatSymbol, rate := range rates {
+			fiatID := fiatMappings[fiatSymbol]
+			if fiatID == 0 {
+				result.Skipped++
+				continue
+			}
+			exchangeRates = append(exchangeRates, ExchangeRate{
+				CryptoID:  cryptoID,
+				FiatID:    fiatID,
+				Rate:      rate,
+				Timestamp: result.Timestamp,
+				Source:    source,
+			})
+		}
+	}
+
+	result.Snapshot, err = i.DB.InsertExchangeRates(exchangeRates)
+	if err != nil {
+		return result, fmt.Errorf("inserting exchange rates: %w", err)
+	}
+	if result.Snapshot.ID != 0 {
+		result.Rates = len(exchangeRates)
+	}
+
+	result.Rollup, err = i.DB.Rollup(result.Timestamp)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// fetch calls the price API for the given symbols.
+func (i *Ingester) fetch(ctx context.Context, cryptos, fiats []string) (APIResponse, error) {
+	priceURL := i.PriceURL
+	if priceURL == "" {
+		priceURL = DefaultPriceURL
+	}
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	apiURL := fmt.Sprintf("%s?fsyms=%s&tsyms=%s", priceURL, strings.Join(cryptos, ","), strings.Join(fiats, ","))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("API call failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API call failed with status code: %d", response.StatusCode)
+	}
+
+	var apiResp APIResponse
+	if err := json.NewDecoder(response.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("decoding API response: %w", err)
+	}
+	return apiResp, nil
+}
+
+func sortedSymbols(mappings map[string]int) []string {
+	symbols := make([]string, 0, len(mappings))
+	for symbol := range mappings {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
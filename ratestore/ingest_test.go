@@ -0,0 +1,104 @@
+package ratestore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngesterIngest(t *testing.T) {
+	db := newTestDatabase(t)
+
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(`{"BTC": {"USD": 30150.12, "INR": 2487686.4, "EUR": 27000}, "ETH": {"USD": 1850.5}, "XRP": {"USD": 0.5}}`))
+	}))
+	defer server.Close()
+
+	ingester := &Ingester{DB: db, PriceURL: server.URL}
+	result, err := ingester.Ingest(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "fsyms=BTC,ETH&tsyms=INR,USD", query)
+	assert.Equal(t, 3, result.Rates)
+	assert.Equal(t, int64(1), result.Snapshot.ID)
+	assert.Equal(t, DefaultSource, result.Snapshot.Source)
+
+	runs, err := db.ListIngestionRuns(DefaultRunLimit)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, result.RunID, runs[0].ID)
+	assert.Equal(t, RunStatusSucceeded, runs[0].Status)
+	assert.Equal(t, ProviderCryptoCompare, runs[0].Provider)
+	assert.Equal(t, 4, runs[0].Requested)
+	assert.Equal(t, 5, runs[0].Received)
+	assert.Equal(t, 3, runs[0].Inserted)
+	assert.Equal(t, 2, runs[0].Skipped)
+	assert.Equal(t, int64(1), runs[0].SnapshotID)
+	assert.NotNil(t, runs[0].FinishedAt)
+	assert.Empty(t, runs[0].Error)
+
+	rates, snapshot, err := db.GetAllExchangeRates("")
+	assert.NoError(t, err)
+	assert.Equal(t, result.Snapshot, snapshot)
+	assert.Equal(t, map[string]map[string]decimal.Decimal{
+		"BTC": {"USD": dec("30150.12"), "INR": dec("2487686.4")},
+		"ETH": {"USD": dec("1850.5")},
+	}, rates)
+}
+
+func TestAPIResponseKeepsDigits(t *testing.T) {
+	var response APIResponse
+	require.NoError(t, json.Unmarshal([]byte(`{"BTC": {"KRW": 1234567890.12345678, "USD": 3.0e4}}`), &response))
+	assert.Equal(t, "1234567890.12345678", response["BTC"]["KRW"].String())
+	assert.Equal(t, "30000", response["BTC"]["USD"].String())
+}
+
+func TestIngesterIngestAPIError(t *testing.T) {
+	db := newTestDatabase(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ingester := &Ingester{DB: db, PriceURL: server.URL}
+	_, err := ingester.Ingest(context.Background())
+	assert.EqualError(t, err, "API call failed with status code: 429")
+
+	runs, err := db.ListIngestionRuns(DefaultRunLimit)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, RunStatusFailed, runs[0].Status)
+	assert.Equal(t, 4, runs[0].Requested)
+	assert.Zero(t, runs[0].Received)
+	assert.Zero(t, runs[0].SnapshotID)
+	assert.Equal(t, "API call failed with status code: 429", runs[0].Error)
+}
+
+func TestIngesterIngestTagsProvider(t *testing.T) {
+	db := newTestDatabase(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"BTC": {"USD": 30149.8}}`))
+	}))
+	defer server.Close()
+
+	ingester := &Ingester{DB: db, PriceURL: server.URL, Provider: "kraken"}
+	result, err := ingester.Ingest(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "kraken", result.Snapshot.Source)
+
+	rate, _, err := db.GetExchangeRate("BTC", "USD", "kraken")
+	assert.NoError(t, err)
+	assert.Equal(t, dec("30149.8"), rate)
+
+	_, _, err = db.GetExchangeRate("BTC", "USD", "")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,103 @@
+package ratestore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRUCache is an in-process Cache holding up to a fixed number of entries,
+// evicting the least recently used one to make room for a new one.
+type LRUCache struct {
+	size int
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	order      *list.List
+	generation int64
+
+	// now returns the current time, used for the expiry of the entries.
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+var _ Cache = (*LRUCache)(nil)
+
+// NewLRUCache returns an empty LRUCache holding up to size entries.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, entries: make(map[string]*list.Element), order: list.New(), now: time.Now}
+}
+
+// Generation returns the number of times the cache was purged.
+func (c *LRUCache) Generation() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation, nil
+}
+
+// Get returns the value of key unless it is missing or expired.
+func (c *LRUCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set stores value under key for ttl.
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Purge drops every entry and bumps the generation.
+func (c *LRUCache) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.generation++
+	return nil
+}
+
+// Len returns the number of entries held, expired or not.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Close does nothing: an LRUCache holds no resources.
+func (c *LRUCache) Close() error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package ratestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	require.NoError(t, cache.Set("a", []byte("1"), time.Minute))
+	require.NoError(t, cache.Set("b", []byte("2"), time.Minute))
+	value, ok, err := cache.Get("a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	// b is the least recently used entry.
+	require.NoError(t, cache.Set("c", []byte("3"), time.Minute))
+	_, ok, _ = cache.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Len())
+
+	require.NoError(t, cache.Set("c", []byte("4"), 2*time.Minute))
+	now = now.Add(time.Minute)
+	_, ok, _ = cache.Get("a")
+	assert.False(t, ok, "an entry expires after its ttl")
+	value, ok, _ = cache.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("4"), value)
+	assert.Equal(t, 1, cache.Len())
+
+	generation, err := cache.Generation()
+	require.NoError(t, err)
+	assert.Zero(t, generation)
+	require.NoError(t, cache.Purge())
+	generation, err = cache.Generation()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), generation)
+	assert.Zero(t, cache.Len())
+}
@@ -0,0 +1,358 @@
+package ratestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// MemoryStore is an in-memory implementation of RateStore for local
+// development and tests. All of its rates come from DefaultSource.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	cryptos map[string]bool
+	fiats   map[string]bool
+	// aliases maps a currency type and alias to the aliased symbol.
+	aliases map[[2]string]string
+	rates   []memoryRate
+	// snapshots maps the Unix nanoseconds of a timestamp to the ID of the
+	// snapshot of the rates added at it, as InsertExchangeRates stores the
+	// rates of a timestamp and source as one snapshot.
+	snapshots    map[int64]int64
+	lastSnapshot int64
+
+	// now returns the current time, used for the 24 hour history window.
+	now func() time.Time
+}
+
+type memoryRate struct {
+	crypto    string
+	fiat      string
+	rate      decimal.Decimal
+	timestamp time.Time
+	snapshot  int64
+}
+
+// snapshotOf returns the snapshot the rate was added in.
+func (r memoryRate) snapshotOf() Snapshot {
+	return Snapshot{ID: r.snapshot, TakenAt: r.timestamp, Source: DefaultSource}
+}
+
+var _ RateStore = (*MemoryStore)(nil)
+
+// Fixture is the JSON document a MemoryStore can be seeded from.
+type Fixture struct {
+	Cryptocurrencies []string      `json:"cryptocurrencies"`
+	FiatCurrencies   []string      `json:"fiat_currencies"`
+	ExchangeRates    []FixtureRate `json:"exchange_rates"`
+}
+
+// FixtureRate is a single exchange rate of a Fixture. Rates without a
+// timestamp are stamped with the time the fixture is loaded.
+type FixtureRate struct {
+	Crypto    string          `json:"crypto"`
+	Fiat      string          `json:"fiat"`
+	Rate      decimal.Decimal `json:"rate"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		cryptos:   make(map[string]bool),
+		fiats:     make(map[string]bool),
+		aliases:   make(map[[2]string]string),
+		snapshots: make(map[int64]int64),
+		now:       time.Now,
+	}
+}
+
+// LoadMemoryStore returns a MemoryStore seeded from the JSON fixture at path.
+func LoadMemoryStore(path string) (*MemoryStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := NewMemoryStore()
+	if err := m.Seed(f); err != nil {
+		return nil, fmt.Errorf("loading fixture %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Seed adds the currencies and rates of the JSON fixture read from r.
+func (m *MemoryStore) Seed(r io.Reader) error {
+	var fixture Fixture
+	if err := json.NewDecoder(r).Decode(&fixture); err != nil {
+		return err
+	}
+
+	for _, symbol := range fixture.Cryptocurrencies {
+		m.AddCryptoCurrency(symbol)
+	}
+	for _, symbol := range fixture.FiatCurrencies {
+		m.AddFiatCurrency(symbol)
+	}
+
+	loadedAt := m.now().UTC()
+	for _, rate := range fixture.ExchangeRates {
+		timestamp := rate.Timestamp
+		if timestamp.IsZero() {
+			timestamp = loadedAt
+		}
+		if err := m.AddExchangeRate(rate.Crypto, rate.Fiat, rate.Rate, timestamp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddCryptoCurrency registers a cryptocurrency symbol.
+func (m *MemoryStore) AddCryptoCurrency(symbol string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cryptos[symbol] = true
+}
+
+// AddFiatCurrency registers a fiat currency symbol.
+func (m *MemoryStore) AddFiatCurrency(symbol string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fiats[symbol] = true
+}
+
+// AddAlias makes alias resolve to the currency of the given type and symbol.
+func (m *MemoryStore) AddAlias(currencyType, alias, symbol string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aliases[[2]string{currencyType, alias}] = symbol
+}
+
+// AddExchangeRate records the rate of crypto in fiat at timestamp, in the
+// snapshot of the rates added at the same timestamp. Both symbols must have
+// been registered first.
+func (m *MemoryStore) AddExchangeRate(crypto, fiat string, rate decimal.Decimal, timestamp time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.cryptos[crypto] {
+		return fmt.Errorf("unknown cryptocurrency %q", crypto)
+	}
+	if !m.fiats[fiat] {
+		return fmt.Errorf("unknown fiat currency %q", fiat)
+	}
+
+	snapshot, ok := m.snapshots[timestamp.UnixNano()]
+	if !ok {
+		m.lastSnapshot++
+		snapshot = m.lastSnapshot
+		m.snapshots[timestamp.UnixNano()] = snapshot
+	}
+	m.rates = append(m.rates, memoryRate{
+		crypto:    crypto,
+		fiat:      fiat,
+		rate:      rate,
+		timestamp: timestamp.UTC(),
+		snapshot:  snapshot,
+	})
+	return nil
+}
+
+// Close is a no-op; the store stays usable after it is closed.
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) CheckCryptoCurrency(crypto string) (bool, error) {
+	_, err := m.ResolveCryptoCurrency(crypto)
+	return checkResolved(err)
+}
+
+func (m *MemoryStore) CheckFiatCurrency(fiat string) (bool, error) {
+	_, err := m.ResolveFiatCurrency(fiat)
+	return checkResolved(err)
+}
+
+func (m *MemoryStore) ResolveCryptoCurrency(crypto string) (string, error) {
+	return m.resolve(CurrencyTypeCrypto, m.cryptos, crypto)
+}
+
+func (m *MemoryStore) ResolveFiatCurrency(fiat string) (string, error) {
+	return m.resolve(CurrencyTypeFiat, m.fiats, fiat)
+}
+
+// resolve resolves symbol to one of the registered symbols of a type.
+func (m *MemoryStore) resolve(currencyType string, symbols map[string]bool, symbol string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	symbol = NormalizeSymbol(symbol)
+	if symbols[symbol] {
+		return symbol, nil
+	}
+	if aliased, ok := m.aliases[[2]string{currencyType, symbol}]; ok && symbols[aliased] {
+		return aliased, nil
+	}
+	return "", fmt.Errorf("%s currency %s: %w", currencyType, symbol, ErrUnknownCurrency)
+}
+
+// ListCurrencies returns the registered currencies, which are all active and
+// have no metadata besides their symbol, type and aliases.
+func (m *MemoryStore) ListCurrencies(currencyType string, includeInactive bool) ([]Currency, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	currencies := make([]Currency, 0)
+	for _, table := range []struct {
+		currencyType string
+		symbols      map[string]bool
+	}{
+		{CurrencyTypeCrypto, m.cryptos},
+		{CurrencyTypeFiat, m.fiats},
+	} {
+		if currencyType != "" && currencyType != table.currencyType {
+			continue
+		}
+		symbols := make([]string, 0, len(table.symbols))
+		for symbol := range table.symbols {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		aliases := make(map[string][]string)
+		for key, symbol := range m.aliases {
+			if key[0] == table.currencyType {
+				aliases[symbol] = append(aliases[symbol], key[1])
+			}
+		}
+		for _, symbol := range symbols {
+			sort.Strings(aliases[symbol])
+			currencies = append(currencies, Currency{Symbol: symbol, Type: table.currencyType, Aliases: aliases[symbol], Active: true})
+		}
+	}
+	return currencies, nil
+}
+
+func (m *MemoryStore) GetExchangeRate(crypto, fiat, source string) (decimal.Decimal, Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	latest, ok := m.latest()[[2]string{crypto, fiat}]
+	if !ok || sourceOrDefault(source) != DefaultSource {
+		return decimal.Decimal{}, Snapshot{}, ErrNotFound
+	}
+	return latest.rate, latest.snapshotOf(), nil
+}
+
+func (m *MemoryStore) GetExchangeRatesForCrypto(crypto, source string) (map[string]decimal.Decimal, Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := make(map[string]decimal.Decimal)
+	var newest memoryRate
+	if sourceOrDefault(source) != DefaultSource {
+		return rates, Snapshot{}, nil
+	}
+	for pair, latest := range m.latest() {
+		if pair[0] == crypto {
+			rates[pair[1]] = latest.rate
+			newest = newer(newest, latest)
+		}
+	}
+	if len(rates) == 0 {
+		return rates, Snapshot{}, nil
+	}
+	return rates, newest.snapshotOf(), nil
+}
+
+func (m *MemoryStore) GetAllExchangeRates(source string) (map[string]map[string]decimal.Decimal, Snapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := make(map[string]map[string]decimal.Decimal)
+	var newest memoryRate
+	if sourceOrDefault(source) != DefaultSource {
+		return rates, Snapshot{}, nil
+	}
+	for pair, latest := range m.latest() {
+		if rates[pair[0]] == nil {
+			rates[pair[0]] = make(map[string]decimal.Decimal)
+		}
+		rates[pair[0]][pair[1]] = latest.rate
+		newest = newer(newest, latest)
+	}
+	if len(rates) == 0 {
+		return rates, Snapshot{}, nil
+	}
+	return rates, newest.snapshotOf(), nil
+}
+
+// GetExchangeRateSources returns the latest rate of the pair from
+// DefaultSource, the only source of the in-memory store.
+func (m *MemoryStore) GetExchangeRateSources(crypto, fiat string) ([]SourceRate, error) {
+	rate, snapshot, err := m.GetExchangeRate(crypto, fiat, DefaultSource)
+	if err != nil {
+		return nil, err
+	}
+	return []SourceRate{{Value: rate, Snapshot: snapshot}}, nil
+}
+
+func (m *MemoryStore) GetHistoricalExchangeRates(crypto, fiat string) ([]RateWithTimestamp, error) {
+	return m.GetRateHistory(crypto, fiat, m.now().Add(-RawHistoryWindow))
+}
+
+// GetRateHistory returns every rate of the pair since the given time; the
+// in-memory store keeps no rollups.
+func (m *MemoryStore) GetRateHistory(crypto, fiat string, since time.Time) ([]RateWithTimestamp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := make([]memoryRate, 0)
+	for _, r := range m.rates {
+		if r.crypto == crypto && r.fiat == fiat && !r.timestamp.Before(since) {
+			history = append(history, r)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].timestamp.Before(history[j].timestamp)
+	})
+
+	rates := make([]RateWithTimestamp, 0, len(history))
+	for _, r := range history {
+		rates = append(rates, RateWithTimestamp{
+			Value:     r.rate,
+			Timestamp: r.timestamp.Format(time.RFC3339Nano),
+		})
+	}
+	return rates, nil
+}
+
+// newer returns the rate of the latest snapshot of a and b, the snapshot the
+// rates read together are served from.
+func newer(a, b memoryRate) memoryRate {
+	if b.timestamp.After(a.timestamp) {
+		return b
+	}
+	return a
+}
+
+// latest returns the most recent rate of every pair, keyed by crypto and fiat
+// symbol. The caller must hold m.mu.
+func (m *MemoryStore) latest() map[[2]string]memoryRate {
+	latest := make(map[[2]string]memoryRate)
+	for _, r := range m.rates {
+		pair := [2]string{r.crypto, r.fiat}
+		if current, ok := latest[pair]; !ok || !r.timestamp.Before(current.timestamp) {
+			latest[pair] = r
+		}
+	}
+	return latest
+}
@@ -0,0 +1,222 @@
+package ratestore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMemoryStore(t *testing.T) *MemoryStore {
+	m := NewMemoryStore()
+	for _, symbol := range []string{"BTC", "ETH"} {
+		m.AddCryptoCurrency(symbol)
+	}
+	for _, symbol := range []string{"USD", "INR"} {
+		m.AddFiatCurrency(symbol)
+	}
+	return m
+}
+
+func TestMemoryStoreCheckCurrencies(t *testing.T) {
+	m := newTestMemoryStore(t)
+
+	exists, err := m.CheckCryptoCurrency("BTC")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = m.CheckCryptoCurrency("USD")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = m.CheckFiatCurrency("INR")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMemoryStoreResolveCurrencies(t *testing.T) {
+	m := newTestMemoryStore(t)
+	m.AddAlias(CurrencyTypeCrypto, "XBT", "BTC")
+
+	resolved, err := m.ResolveCryptoCurrency("xbt")
+	assert.NoError(t, err)
+	assert.Equal(t, "BTC", resolved)
+
+	resolved, err = m.ResolveFiatCurrency(" inr")
+	assert.NoError(t, err)
+	assert.Equal(t, "INR", resolved)
+
+	_, err = m.ResolveFiatCurrency("XBT")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	currencies, err := m.ListCurrencies(CurrencyTypeCrypto, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"XBT"}, currencies[0].Aliases)
+}
+
+func TestMemoryStoreAddExchangeRateUnknownSymbol(t *testing.T) {
+	m := newTestMemoryStore(t)
+
+	assert.Error(t, m.AddExchangeRate("DOGE", "USD", dec("0.07"), time.Now()))
+	assert.Error(t, m.AddExchangeRate("BTC", "JPY", dec("4200000"), time.Now()))
+}
+
+func TestMemoryStoreListCurrencies(t *testing.T) {
+	m := newTestMemoryStore(t)
+
+	currencies, err := m.ListCurrencies("", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []Currency{
+		{Symbol: "BTC", Type: CurrencyTypeCrypto, Active: true},
+		{Symbol: "ETH", Type: CurrencyTypeCrypto, Active: true},
+		{Symbol: "INR", Type: CurrencyTypeFiat, Active: true},
+		{Symbol: "USD", Type: CurrencyTypeFiat, Active: true},
+	}, currencies)
+
+	currencies, err = m.ListCurrencies(CurrencyTypeFiat, false)
+	assert.NoError(t, err)
+	assert.Len(t, currencies, 2)
+}
+
+func TestMemoryStoreGetExchangeRate(t *testing.T) {
+	m := newTestMemoryStore(t)
+	now := time.Now()
+
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("25.2"), now.Add(-time.Hour)))
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("30.5"), now))
+
+	rate, snapshot, err := m.GetExchangeRate("BTC", "USD", "")
+	assert.NoError(t, err)
+	assert.Equal(t, dec("30.5"), rate)
+	assert.Equal(t, Snapshot{ID: 2, TakenAt: now.UTC(), Source: DefaultSource}, snapshot)
+
+	// The rates of a timestamp share a snapshot, and a pair keeps its own.
+	require.NoError(t, m.AddExchangeRate("ETH", "USD", dec("1500"), now.Add(-time.Hour)))
+	require.NoError(t, m.AddExchangeRate("ETH", "INR", dec("125000"), now.Add(time.Hour)))
+	_, snapshot, err = m.GetExchangeRate("ETH", "USD", "")
+	assert.NoError(t, err)
+	assert.Equal(t, Snapshot{ID: 1, TakenAt: now.Add(-time.Hour).UTC(), Source: DefaultSource}, snapshot)
+	_, snapshot, err = m.GetExchangeRate("BTC", "USD", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), snapshot.ID)
+
+	_, _, err = m.GetExchangeRate("DOGE", "USD", "")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStoreGetExchangeRatesForCrypto(t *testing.T) {
+	m := newTestMemoryStore(t)
+	now := time.Now()
+
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("25.2"), now.Add(-time.Hour)))
+	require.NoError(t, m.AddExchangeRate("BTC", "INR", dec("30.5"), now.Add(-time.Hour)))
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("26.4"), now))
+	require.NoError(t, m.AddExchangeRate("ETH", "USD", dec("5484.6"), now))
+
+	rates, snapshot, err := m.GetExchangeRatesForCrypto("BTC", "")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]decimal.Decimal{"USD": dec("26.4"), "INR": dec("30.5")}, rates)
+	assert.Equal(t, Snapshot{ID: 2, TakenAt: now.UTC(), Source: DefaultSource}, snapshot)
+
+	rates, snapshot, err = m.GetExchangeRatesForCrypto("DOGE", "")
+	assert.NoError(t, err)
+	assert.Empty(t, rates)
+	assert.Zero(t, snapshot)
+}
+
+func TestMemoryStoreGetAllExchangeRates(t *testing.T) {
+	m := newTestMemoryStore(t)
+	now := time.Now()
+
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("25.2"), now.Add(-time.Hour)))
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("5484.6"), now))
+	require.NoError(t, m.AddExchangeRate("BTC", "INR", dec("345.6"), now))
+	require.NoError(t, m.AddExchangeRate("ETH", "USD", dec("86.6"), now))
+
+	rates, _, err := m.GetAllExchangeRates("")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]decimal.Decimal{
+		"BTC": {"USD": dec("5484.6"), "INR": dec("345.6")},
+		"ETH": {"USD": dec("86.6")},
+	}, rates)
+}
+
+func TestMemoryStoreGetHistoricalExchangeRates(t *testing.T) {
+	m := newTestMemoryStore(t)
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("30.5"), now.Add(-1*time.Hour)))
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("25.2"), now.Add(-2*time.Hour)))
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("530.5"), now.Add(-26*time.Hour)))
+	require.NoError(t, m.AddExchangeRate("BTC", "INR", dec("2500"), now.Add(-1*time.Hour)))
+
+	rates, err := m.GetHistoricalExchangeRates("BTC", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, []RateWithTimestamp{
+		{Value: dec("25.2"), Timestamp: "2023-07-01T10:00:00Z"},
+		{Value: dec("30.5"), Timestamp: "2023-07-01T11:00:00Z"},
+	}, rates)
+}
+
+func TestMemoryStoreSeed(t *testing.T) {
+	m := NewMemoryStore()
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	fixture := `{
+		"cryptocurrencies": ["BTC"],
+		"fiat_currencies": ["USD"],
+		"exchange_rates": [
+			{"crypto": "BTC", "fiat": "USD", "rate": 30000.5, "timestamp": "2023-07-01T11:50:00Z"},
+			{"crypto": "BTC", "fiat": "USD", "rate": 30100.25}
+		]
+	}`
+	require.NoError(t, m.Seed(strings.NewReader(fixture)))
+
+	rate, _, err := m.GetExchangeRate("BTC", "USD", "")
+	assert.NoError(t, err)
+	assert.Equal(t, dec("30100.25"), rate)
+
+	rates, err := m.GetHistoricalExchangeRates("BTC", "USD")
+	assert.NoError(t, err)
+	assert.Len(t, rates, 2)
+}
+
+func TestMemoryStoreSeedUnknownSymbol(t *testing.T) {
+	m := NewMemoryStore()
+
+	fixture := `{"cryptocurrencies": ["BTC"], "exchange_rates": [{"crypto": "BTC", "fiat": "USD", "rate": 1}]}`
+	assert.Error(t, m.Seed(strings.NewReader(fixture)))
+}
+
+func TestMemoryStoreSeedKeepsDigits(t *testing.T) {
+	m := NewMemoryStore()
+
+	fixture := `{
+		"cryptocurrencies": ["BTC"],
+		"fiat_currencies": ["KRW"],
+		"exchange_rates": [{"crypto": "BTC", "fiat": "KRW", "rate": 1234567890.12345678}]
+	}`
+	require.NoError(t, m.Seed(strings.NewReader(fixture)))
+
+	rate, _, err := m.GetExchangeRate("BTC", "KRW", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890.12345678", rate.String())
+}
+
+func TestMemoryStoreSources(t *testing.T) {
+	m := newTestMemoryStore(t)
+	require.NoError(t, m.AddExchangeRate("BTC", "USD", dec("30.5"), time.Now()))
+
+	sources, err := m.GetExchangeRateSources("BTC", "USD")
+	assert.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, DefaultSource, sources[0].Source)
+
+	_, _, err = m.GetExchangeRate("BTC", "USD", "kraken")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
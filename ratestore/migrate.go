@@ -0,0 +1,255 @@
+package ratestore
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the numbered schema migrations of every dialect, named
+// migrations/<dialect>/<version>_<name>.up.sql and .down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS SchemaMigrations (
+  version INT PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  applied_at TIMESTAMP NOT NULL
+)`
+
+// Migration is a numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the schema migrations of the database's dialect, ordered
+// by version.
+func (d *Database) Migrations() ([]Migration, error) {
+	return loadMigrations(d.dialect.name)
+}
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction := strings.TrimSuffix(file, ".sql"), ""
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			base, direction = strings.TrimSuffix(base, ".up"), "up"
+		case strings.HasSuffix(base, ".down"):
+			base, direction = strings.TrimSuffix(base, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", file)
+		}
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s: name must start with a version number", file)
+		}
+
+		contents, err := fs.ReadFile(migrationFiles, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(contents)
+		} else {
+			m.down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s: missing up or down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrationStatus lists every migration and whether it has been applied.
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses = append(statuses, MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies every pending migration in order and returns the ones it
+// applied.
+func (d *Database) MigrateUp() ([]Migration, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := d.runMigration(m.up, "INSERT INTO SchemaMigrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("applying migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations, or all of them if
+// steps is zero, and returns the ones it reverted.
+func (d *Database) MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := d.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := d.runMigration(m.down, "DELETE FROM SchemaMigrations WHERE version = ?", m.Version)
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// appliedMigrations returns the time every applied migration was applied at,
+// keyed by version.
+func (d *Database) appliedMigrations() (map[int]time.Time, error) {
+	if _, err := d.DB.Exec(createMigrationsTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.query("SELECT version, applied_at FROM SchemaMigrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// runMigration executes the statements of a migration script and records it
+// in SchemaMigrations within one transaction. MySQL commits DDL statements
+// implicitly, so there a failed migration may be partly applied.
+func (d *Database) runMigration(script, record string, args ...interface{}) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(d.dialect.rebind(record), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a migration script into its statements, which are
+// terminated by a semicolon at the end of a line.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
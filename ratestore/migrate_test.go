@@ -0,0 +1,177 @@
+package ratestore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	mysql, err := loadMigrations(DriverMySQL)
+	require.NoError(t, err)
+	require.NotEmpty(t, mysql)
+
+	for _, driver := range []string{DriverSQLite, DriverPostgres} {
+		migrations, err := loadMigrations(driver)
+		require.NoError(t, err)
+		require.Len(t, migrations, len(mysql), driver)
+		for i, m := range migrations {
+			assert.Equal(t, mysql[i].Version, m.Version, driver)
+			assert.Equal(t, mysql[i].Name, m.Name, driver)
+		}
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	db, err := NewDatabase(Config{
+		Driver:   DriverSQLite,
+		Database: filepath.Join(t.TempDir(), "rates.db"),
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrations, err := db.Migrations()
+	require.NoError(t, err)
+
+	applied, err := db.MigrateUp()
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+
+	applied, err = db.MigrateUp()
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := db.MigrationStatus()
+	assert.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied, status.Name)
+		assert.False(t, status.AppliedAt.IsZero(), status.Name)
+	}
+
+	reverted, err := db.MigrateDown(1)
+	assert.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, migrations[len(migrations)-1].Version, reverted[0].Version)
+
+	reverted, err = db.MigrateDown(0)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, len(migrations)-1)
+
+	var tables int
+	err = db.DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'ExchangeRates'").Scan(&tables)
+	assert.NoError(t, err)
+	assert.Zero(t, tables)
+
+	applied, err = db.MigrateUp()
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+}
+
+func TestLatestRatesMigrationBackfills(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC()
+
+	migrations, err := db.Migrations()
+	require.NoError(t, err)
+	steps := 0
+	for _, m := range migrations {
+		if m.Version >= 4 {
+			steps++
+		}
+	}
+	_, err = db.MigrateDown(steps)
+	require.NoError(t, err)
+
+	for _, r := range []ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("25.2"), Timestamp: now.Add(-time.Hour)},
+		{CryptoID: 1, FiatID: 1, Rate: dec("30.5"), Timestamp: now},
+		{CryptoID: 1, FiatID: 1, Rate: dec("31.5"), Timestamp: now},
+		{CryptoID: 2, FiatID: 2, Rate: dec("86.6"), Timestamp: now},
+	} {
+		_, err := db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?, ?, ?, ?)",
+			r.CryptoID, r.FiatID, r.Rate, r.Timestamp)
+		require.NoError(t, err)
+	}
+
+	_, err = db.MigrateUp()
+	require.NoError(t, err)
+
+	rates, snapshot, err := db.GetAllExchangeRates("")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]decimal.Decimal{
+		"BTC": {"USD": dec("31.5")},
+		"ETH": {"INR": dec("86.6")},
+	}, rates)
+	assert.Equal(t, int64(1), snapshot.ID)
+}
+
+func TestRateBucketsMigrationTruncatesAndDedupes(t *testing.T) {
+	db := newTestDatabase(t)
+	bucket := time.Date(2023, 7, 1, 12, 10, 0, 0, time.UTC)
+
+	migrations, err := db.Migrations()
+	require.NoError(t, err)
+	steps := 0
+	for _, m := range migrations {
+		if m.Version >= 10 {
+			steps++
+		}
+	}
+	_, err = db.MigrateDown(steps)
+	require.NoError(t, err)
+
+	for _, r := range []ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("30000"), Timestamp: bucket.Add(time.Minute)},
+		{CryptoID: 1, FiatID: 1, Rate: dec("30100"), Timestamp: bucket.Add(7*time.Minute + 500*time.Millisecond)},
+		{CryptoID: 1, FiatID: 1, Rate: dec("30200"), Timestamp: bucket.Add(12 * time.Minute)},
+	} {
+		_, err := db.DB.Exec("INSERT INTO ExchangeRates (cryptocurrency_id, fiat_currency_id, rate, timestamp) VALUES (?, ?, ?, ?)",
+			r.CryptoID, r.FiatID, r.Rate, r.Timestamp)
+		require.NoError(t, err)
+	}
+
+	_, err = db.MigrateUp()
+	require.NoError(t, err)
+
+	// The two rates of the first bucket are one, the latest, in the bucket
+	// bucketStart puts them in.
+	rows, err := db.DB.Query("SELECT rate, timestamp, bucket_start FROM ExchangeRates ORDER BY timestamp")
+	require.NoError(t, err)
+	defer rows.Close()
+	type row struct {
+		rate                   string
+		timestamp, bucketStart time.Time
+	}
+	var stored []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.rate, &r.timestamp, &r.bucketStart))
+		stored = append(stored, row{r.rate, r.timestamp.UTC(), r.bucketStart.UTC()})
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, stored, 2)
+	assert.Equal(t, "30100", stored[0].rate)
+	assert.Equal(t, bucket, stored[0].bucketStart)
+	assert.Equal(t, bucketStart(stored[0].timestamp, DefaultRateBucket), stored[0].bucketStart)
+	assert.Equal(t, bucket.Add(DefaultRateBucket), stored[1].bucketStart)
+
+	// A rate ingested into a migrated bucket updates its rate.
+	insertTestRate(t, db, 1, 1, "30150", bucket.Add(9*time.Minute))
+	assert.Equal(t, 2, countRates(t, db, "ExchangeRates"))
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+-- Two statements
+CREATE TABLE a (
+  id INT
+);
+
+DROP TABLE b;
+`
+	assert.Equal(t, []string{"CREATE TABLE a (\n  id INT\n)", "DROP TABLE b"}, splitStatements(script))
+}
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS Cryptocurrencies (
+  cryptocurrency_id INT AUTO_INCREMENT PRIMARY KEY,
+  symbol VARCHAR(10) UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS FiatCurrencies (
+  fiat_currency_id INT AUTO_INCREMENT PRIMARY KEY,
+  symbol VARCHAR(10) UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS ExchangeRates (
+  exchange_rate_id INT AUTO_INCREMENT PRIMARY KEY,
+  cryptocurrency_id INT,
+  fiat_currency_id INT,
+  rate DECIMAL(18, 8),
+  timestamp TIMESTAMP,
+  FOREIGN KEY (cryptocurrency_id) REFERENCES Cryptocurrencies(cryptocurrency_id),
+  FOREIGN KEY (fiat_currency_id) REFERENCES FiatCurrencies(fiat_currency_id),
+  INDEX idx_exchange_rates_pair_timestamp (cryptocurrency_id, fiat_currency_id, timestamp)
+);
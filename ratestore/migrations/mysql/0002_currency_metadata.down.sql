@@ -0,0 +1,9 @@
+ALTER TABLE FiatCurrencies
+  DROP COLUMN active,
+  DROP COLUMN decimals,
+  DROP COLUMN name;
+
+ALTER TABLE Cryptocurrencies
+  DROP COLUMN active,
+  DROP COLUMN decimals,
+  DROP COLUMN name;
@@ -0,0 +1,9 @@
+ALTER TABLE Cryptocurrencies
+  ADD COLUMN name VARCHAR(100),
+  ADD COLUMN decimals INT NOT NULL DEFAULT 0,
+  ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE FiatCurrencies
+  ADD COLUMN name VARCHAR(100),
+  ADD COLUMN decimals INT NOT NULL DEFAULT 0,
+  ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,5 @@
+DROP INDEX idx_exchange_rates_timestamp ON ExchangeRates;
+
+DROP TABLE IF EXISTS DailyRates;
+
+DROP TABLE IF EXISTS HourlyRates;
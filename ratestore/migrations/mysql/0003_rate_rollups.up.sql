@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS HourlyRates (
+  cryptocurrency_id INT NOT NULL,
+  fiat_currency_id INT NOT NULL,
+  bucket_start DATETIME NOT NULL,
+  open DECIMAL(18, 8) NOT NULL,
+  high DECIMAL(18, 8) NOT NULL,
+  low DECIMAL(18, 8) NOT NULL,
+  close DECIMAL(18, 8) NOT NULL,
+  samples INT NOT NULL,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id, bucket_start),
+  FOREIGN KEY (cryptocurrency_id) REFERENCES Cryptocurrencies(cryptocurrency_id),
+  FOREIGN KEY (fiat_currency_id) REFERENCES FiatCurrencies(fiat_currency_id),
+  INDEX idx_hourly_rates_bucket_start (bucket_start)
+);
+
+CREATE TABLE IF NOT EXISTS DailyRates (
+  cryptocurrency_id INT NOT NULL,
+  fiat_currency_id INT NOT NULL,
+  bucket_start DATETIME NOT NULL,
+  open DECIMAL(18, 8) NOT NULL,
+  high DECIMAL(18, 8) NOT NULL,
+  low DECIMAL(18, 8) NOT NULL,
+  close DECIMAL(18, 8) NOT NULL,
+  samples INT NOT NULL,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id, bucket_start),
+  FOREIGN KEY (cryptocurrency_id) REFERENCES Cryptocurrencies(cryptocurrency_id),
+  FOREIGN KEY (fiat_currency_id) REFERENCES FiatCurrencies(fiat_currency_id),
+  INDEX idx_daily_rates_bucket_start (bucket_start)
+);
+
+CREATE INDEX idx_exchange_rates_timestamp ON ExchangeRates (timestamp);
@@ -0,0 +1,9 @@
+ALTER TABLE LatestRates
+  DROP FOREIGN KEY fk_latest_rates_snapshot,
+  DROP COLUMN snapshot_id;
+
+ALTER TABLE ExchangeRates
+  DROP FOREIGN KEY fk_exchange_rates_snapshot,
+  DROP COLUMN snapshot_id;
+
+DROP TABLE IF EXISTS Snapshots;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS Snapshots (
+  snapshot_id INT AUTO_INCREMENT PRIMARY KEY,
+  taken_at DATETIME NOT NULL,
+  rates INT NOT NULL,
+  INDEX idx_snapshots_taken_at (taken_at)
+);
+
+ALTER TABLE ExchangeRates
+  ADD COLUMN snapshot_id INT,
+  ADD CONSTRAINT fk_exchange_rates_snapshot FOREIGN KEY (snapshot_id) REFERENCES Snapshots(snapshot_id);
+
+ALTER TABLE LatestRates
+  ADD COLUMN snapshot_id INT,
+  ADD CONSTRAINT fk_latest_rates_snapshot FOREIGN KEY (snapshot_id) REFERENCES Snapshots(snapshot_id);
+
+-- The latest rates stored so far become the first snapshot.
+INSERT INTO Snapshots (taken_at, rates)
+SELECT MAX(timestamp), COUNT(*) FROM LatestRates HAVING COUNT(*) > 0;
+
+UPDATE LatestRates SET snapshot_id = (SELECT MAX(snapshot_id) FROM Snapshots);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS IngestionRuns (
+  run_id INT AUTO_INCREMENT PRIMARY KEY,
+  started_at DATETIME NOT NULL,
+  finished_at DATETIME,
+  status VARCHAR(20) NOT NULL,
+  provider VARCHAR(50) NOT NULL,
+  requested INT NOT NULL DEFAULT 0,
+  received INT NOT NULL DEFAULT 0,
+  inserted INT NOT NULL DEFAULT 0,
+  skipped INT NOT NULL DEFAULT 0,
+  snapshot_id INT,
+  error TEXT,
+  FOREIGN KEY (snapshot_id) REFERENCES Snapshots(snapshot_id),
+  INDEX idx_ingestion_runs_started_at (started_at)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE FiatCurrencies
+  DROP COLUMN iso_numeric;
+
+ALTER TABLE Cryptocurrencies
+  DROP COLUMN contract_address,
+  DROP COLUMN chain;
@@ -0,0 +1,6 @@
+ALTER TABLE Cryptocurrencies
+  ADD COLUMN chain VARCHAR(50),
+  ADD COLUMN contract_address VARCHAR(100);
+
+ALTER TABLE FiatCurrencies
+  ADD COLUMN iso_numeric CHAR(3);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS CurrencyAliases (
+  currency_type VARCHAR(10) NOT NULL,
+  alias VARCHAR(10) NOT NULL,
+  symbol VARCHAR(10) NOT NULL,
+  PRIMARY KEY (currency_type, alias)
+);
@@ -0,0 +1,12 @@
+-- Only the latest rates of the default source fit the old primary key. The
+-- raw rates of the other sources are kept, untagged.
+DELETE FROM LatestRates WHERE source <> 'cryptocompare';
+
+ALTER TABLE LatestRates
+  DROP PRIMARY KEY,
+  ADD PRIMARY KEY (cryptocurrency_id, fiat_currency_id),
+  DROP COLUMN source;
+
+ALTER TABLE ExchangeRates DROP COLUMN source;
+
+ALTER TABLE Snapshots DROP COLUMN source;
@@ -0,0 +1,3 @@
+ALTER TABLE ExchangeRates
+  DROP INDEX ux_exchange_rates_bucket,
+  DROP COLUMN bucket_start;
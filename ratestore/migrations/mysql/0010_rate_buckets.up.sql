@@ -0,0 +1,25 @@
+-- Every raw rate belongs to a bucket of the configured rate bucket size, and a
+-- pair has at most one rate per source and bucket, so a retried or overlapping
+-- ingestion updates the rates it already stored instead of duplicating them.
+-- The rates stored so far are put in the buckets of the default size, 10
+-- minutes, which Go's bucketStart truncates their timestamp to, and only the
+-- latest rate of a pair, source and bucket is kept, as a later ingestion into
+-- the bucket would have.
+ALTER TABLE ExchangeRates ADD COLUMN bucket_start DATETIME;
+
+UPDATE ExchangeRates SET bucket_start =
+  DATE_FORMAT(timestamp, '%Y-%m-%d %H:00:00') + INTERVAL FLOOR(MINUTE(timestamp) / 10) * 10 MINUTE;
+
+-- Keep the latest rate of every bucket, and of two rates with the same
+-- timestamp the last stored.
+DELETE er FROM ExchangeRates er
+JOIN ExchangeRates later ON later.cryptocurrency_id = er.cryptocurrency_id
+  AND later.fiat_currency_id = er.fiat_currency_id
+  AND later.source = er.source
+  AND later.bucket_start = er.bucket_start
+  AND (later.timestamp > er.timestamp
+    OR later.timestamp = er.timestamp AND later.exchange_rate_id > er.exchange_rate_id);
+
+ALTER TABLE ExchangeRates
+  MODIFY COLUMN bucket_start DATETIME NOT NULL,
+  ADD UNIQUE INDEX ux_exchange_rates_bucket (cryptocurrency_id, fiat_currency_id, source, bucket_start);
@@ -0,0 +1,14 @@
+-- The progress of every backfill of a pair at one resolution, keyed by the
+-- start of its range, so that a backfill run again resumes after the last
+-- page it stored.
+CREATE TABLE IF NOT EXISTS BackfillProgress (
+  cryptocurrency_id INT NOT NULL,
+  fiat_currency_id INT NOT NULL,
+  resolution VARCHAR(10) NOT NULL,
+  range_start DATETIME NOT NULL,
+  next_start DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id, resolution, range_start),
+  FOREIGN KEY (cryptocurrency_id) REFERENCES Cryptocurrencies(cryptocurrency_id),
+  FOREIGN KEY (fiat_currency_id) REFERENCES FiatCurrencies(fiat_currency_id)
+);
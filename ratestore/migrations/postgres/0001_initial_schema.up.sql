@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS Cryptocurrencies (
+  cryptocurrency_id SERIAL PRIMARY KEY,
+  symbol VARCHAR(10) UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS FiatCurrencies (
+  fiat_currency_id SERIAL PRIMARY KEY,
+  symbol VARCHAR(10) UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS ExchangeRates (
+  exchange_rate_id SERIAL PRIMARY KEY,
+  cryptocurrency_id INT REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INT REFERENCES FiatCurrencies(fiat_currency_id),
+  rate NUMERIC(18, 8),
+  timestamp TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_pair_timestamp ON ExchangeRates (cryptocurrency_id, fiat_currency_id, timestamp);
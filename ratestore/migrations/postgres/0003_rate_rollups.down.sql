@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_exchange_rates_timestamp;
+
+DROP TABLE IF EXISTS DailyRates;
+
+DROP TABLE IF EXISTS HourlyRates;
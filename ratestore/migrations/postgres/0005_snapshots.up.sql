@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS Snapshots (
+  snapshot_id SERIAL PRIMARY KEY,
+  taken_at TIMESTAMP NOT NULL,
+  rates INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshots_taken_at ON Snapshots (taken_at);
+
+ALTER TABLE ExchangeRates ADD COLUMN snapshot_id INT REFERENCES Snapshots(snapshot_id);
+
+ALTER TABLE LatestRates ADD COLUMN snapshot_id INT REFERENCES Snapshots(snapshot_id);
+
+-- The latest rates stored so far become the first snapshot.
+INSERT INTO Snapshots (taken_at, rates)
+SELECT MAX(timestamp), COUNT(*) FROM LatestRates HAVING COUNT(*) > 0;
+
+UPDATE LatestRates SET snapshot_id = (SELECT MAX(snapshot_id) FROM Snapshots);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS IngestionRuns (
+  run_id SERIAL PRIMARY KEY,
+  started_at TIMESTAMP NOT NULL,
+  finished_at TIMESTAMP,
+  status VARCHAR(20) NOT NULL,
+  provider VARCHAR(50) NOT NULL,
+  requested INT NOT NULL DEFAULT 0,
+  received INT NOT NULL DEFAULT 0,
+  inserted INT NOT NULL DEFAULT 0,
+  skipped INT NOT NULL DEFAULT 0,
+  snapshot_id INT REFERENCES Snapshots(snapshot_id),
+  error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_runs_started_at ON IngestionRuns (started_at);
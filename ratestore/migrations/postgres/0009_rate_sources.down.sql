@@ -0,0 +1,13 @@
+-- Only the latest rates of the default source fit the old primary key. The
+-- raw rates of the other sources are kept, untagged.
+DELETE FROM LatestRates WHERE source <> 'cryptocompare';
+
+ALTER TABLE LatestRates
+  DROP CONSTRAINT latestrates_pkey,
+  ADD PRIMARY KEY (cryptocurrency_id, fiat_currency_id);
+
+ALTER TABLE LatestRates DROP COLUMN source;
+
+ALTER TABLE ExchangeRates DROP COLUMN source;
+
+ALTER TABLE Snapshots DROP COLUMN source;
@@ -0,0 +1,12 @@
+-- Every rate is tagged with the price source it was fetched from. The rates
+-- stored so far all came from CryptoCompare.
+ALTER TABLE Snapshots ADD COLUMN source VARCHAR(50) NOT NULL DEFAULT 'cryptocompare';
+
+ALTER TABLE ExchangeRates ADD COLUMN source VARCHAR(50) NOT NULL DEFAULT 'cryptocompare';
+
+-- LatestRates keeps the latest rate of every pair from every source.
+ALTER TABLE LatestRates ADD COLUMN source VARCHAR(50) NOT NULL DEFAULT 'cryptocompare';
+
+ALTER TABLE LatestRates
+  DROP CONSTRAINT latestrates_pkey,
+  ADD PRIMARY KEY (cryptocurrency_id, fiat_currency_id, source);
@@ -0,0 +1,29 @@
+-- Every raw rate belongs to a bucket of the configured rate bucket size, and a
+-- pair has at most one rate per source and bucket, so a retried or overlapping
+-- ingestion updates the rates it already stored instead of duplicating them.
+-- The rates stored so far are put in the buckets of the default size, 10
+-- minutes, which Go's bucketStart truncates their timestamp to, and only the
+-- latest rate of a pair, source and bucket is kept, as a later ingestion into
+-- the bucket would have.
+ALTER TABLE ExchangeRates ADD COLUMN bucket_start TIMESTAMP;
+
+UPDATE ExchangeRates SET bucket_start =
+  date_trunc('hour', timestamp) + FLOOR(date_part('minute', timestamp) / 10) * INTERVAL '10 minutes';
+
+-- Keep the latest rate of every bucket, and of two rates with the same
+-- timestamp the last stored.
+DELETE FROM ExchangeRates
+WHERE EXISTS (
+  SELECT 1 FROM ExchangeRates later
+  WHERE later.cryptocurrency_id = ExchangeRates.cryptocurrency_id
+    AND later.fiat_currency_id = ExchangeRates.fiat_currency_id
+    AND later.source = ExchangeRates.source
+    AND later.bucket_start = ExchangeRates.bucket_start
+    AND (later.timestamp > ExchangeRates.timestamp
+      OR later.timestamp = ExchangeRates.timestamp AND later.exchange_rate_id > ExchangeRates.exchange_rate_id)
+);
+
+ALTER TABLE ExchangeRates ALTER COLUMN bucket_start SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_exchange_rates_bucket
+  ON ExchangeRates (cryptocurrency_id, fiat_currency_id, source, bucket_start);
@@ -0,0 +1,12 @@
+-- The progress of every backfill of a pair at one resolution, keyed by the
+-- start of its range, so that a backfill run again resumes after the last
+-- page it stored.
+CREATE TABLE IF NOT EXISTS BackfillProgress (
+  cryptocurrency_id INT NOT NULL REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INT NOT NULL REFERENCES FiatCurrencies(fiat_currency_id),
+  resolution VARCHAR(10) NOT NULL,
+  range_start TIMESTAMP NOT NULL,
+  next_start TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id, resolution, range_start)
+);
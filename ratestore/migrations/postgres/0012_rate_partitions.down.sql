@@ -0,0 +1,3 @@
+-- The partition and archive tables are left in place: move their rates back
+-- into ExchangeRates first to keep them served.
+DROP TABLE IF EXISTS RatePartitions;
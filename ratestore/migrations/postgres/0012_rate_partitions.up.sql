@@ -0,0 +1,10 @@
+-- The monthly tables the raw rates are partitioned into when partitioning is
+-- enabled, created by the service as rates arrive. ExchangeRates keeps the
+-- rates of the months without a partition. An archived partition has been
+-- renamed to its archive table and is only read by exports.
+CREATE TABLE IF NOT EXISTS RatePartitions (
+  month_start TIMESTAMP NOT NULL PRIMARY KEY,
+  table_name VARCHAR(64) NOT NULL,
+  archived BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,7 @@
+-- A managed currency is owned by the currency manifest: seeding disables it
+-- once the manifest no longer lists it. The currencies added through the
+-- admin endpoints are not managed until a manifest lists them, so a routine
+-- seed leaves them alone. The currencies stored so far were all seeded.
+ALTER TABLE Cryptocurrencies ADD COLUMN managed BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE FiatCurrencies ADD COLUMN managed BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ExchangeRates;
+DROP TABLE IF EXISTS FiatCurrencies;
+DROP TABLE IF EXISTS Cryptocurrencies;
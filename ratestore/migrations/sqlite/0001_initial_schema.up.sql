@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS Cryptocurrencies (
+  cryptocurrency_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  symbol VARCHAR(10) UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS FiatCurrencies (
+  fiat_currency_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  symbol VARCHAR(10) UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS ExchangeRates (
+  exchange_rate_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  cryptocurrency_id INTEGER REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INTEGER REFERENCES FiatCurrencies(fiat_currency_id),
+  rate DECIMAL(18, 8),
+  timestamp TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_pair_timestamp ON ExchangeRates (cryptocurrency_id, fiat_currency_id, timestamp);
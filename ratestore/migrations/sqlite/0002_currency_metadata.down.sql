@@ -0,0 +1,7 @@
+ALTER TABLE FiatCurrencies DROP COLUMN active;
+ALTER TABLE FiatCurrencies DROP COLUMN decimals;
+ALTER TABLE FiatCurrencies DROP COLUMN name;
+
+ALTER TABLE Cryptocurrencies DROP COLUMN active;
+ALTER TABLE Cryptocurrencies DROP COLUMN decimals;
+ALTER TABLE Cryptocurrencies DROP COLUMN name;
@@ -0,0 +1,7 @@
+ALTER TABLE Cryptocurrencies ADD COLUMN name VARCHAR(100);
+ALTER TABLE Cryptocurrencies ADD COLUMN decimals INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Cryptocurrencies ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE FiatCurrencies ADD COLUMN name VARCHAR(100);
+ALTER TABLE FiatCurrencies ADD COLUMN decimals INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE FiatCurrencies ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS HourlyRates (
+  cryptocurrency_id INTEGER NOT NULL REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INTEGER NOT NULL REFERENCES FiatCurrencies(fiat_currency_id),
+  bucket_start TIMESTAMP NOT NULL,
+  open DECIMAL(18, 8) NOT NULL,
+  high DECIMAL(18, 8) NOT NULL,
+  low DECIMAL(18, 8) NOT NULL,
+  close DECIMAL(18, 8) NOT NULL,
+  samples INTEGER NOT NULL,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_hourly_rates_bucket_start ON HourlyRates (bucket_start);
+
+CREATE TABLE IF NOT EXISTS DailyRates (
+  cryptocurrency_id INTEGER NOT NULL REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INTEGER NOT NULL REFERENCES FiatCurrencies(fiat_currency_id),
+  bucket_start TIMESTAMP NOT NULL,
+  open DECIMAL(18, 8) NOT NULL,
+  high DECIMAL(18, 8) NOT NULL,
+  low DECIMAL(18, 8) NOT NULL,
+  close DECIMAL(18, 8) NOT NULL,
+  samples INTEGER NOT NULL,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_daily_rates_bucket_start ON DailyRates (bucket_start);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_timestamp ON ExchangeRates (timestamp);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS LatestRates (
+  cryptocurrency_id INTEGER NOT NULL REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INTEGER NOT NULL REFERENCES FiatCurrencies(fiat_currency_id),
+  rate DECIMAL(18, 8) NOT NULL,
+  timestamp TIMESTAMP NOT NULL,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id)
+);
+
+-- Start from the latest rate of every pair already stored.
+INSERT INTO LatestRates (cryptocurrency_id, fiat_currency_id, rate, timestamp)
+SELECT er.cryptocurrency_id, er.fiat_currency_id, er.rate, er.timestamp
+FROM ExchangeRates er
+JOIN (
+  SELECT latest.cryptocurrency_id, latest.fiat_currency_id, MAX(x.exchange_rate_id) AS exchange_rate_id
+  FROM (
+    SELECT cryptocurrency_id, fiat_currency_id, MAX(timestamp) AS max_timestamp
+    FROM ExchangeRates
+    WHERE cryptocurrency_id IS NOT NULL AND fiat_currency_id IS NOT NULL
+    GROUP BY cryptocurrency_id, fiat_currency_id
+  ) latest
+  JOIN ExchangeRates x ON x.cryptocurrency_id = latest.cryptocurrency_id
+    AND x.fiat_currency_id = latest.fiat_currency_id
+    AND x.timestamp = latest.max_timestamp
+  GROUP BY latest.cryptocurrency_id, latest.fiat_currency_id
+) newest ON newest.exchange_rate_id = er.exchange_rate_id;
@@ -0,0 +1,5 @@
+ALTER TABLE LatestRates DROP COLUMN snapshot_id;
+
+ALTER TABLE ExchangeRates DROP COLUMN snapshot_id;
+
+DROP TABLE IF EXISTS Snapshots;
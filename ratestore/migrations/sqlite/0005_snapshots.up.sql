@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS Snapshots (
+  snapshot_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  taken_at TIMESTAMP NOT NULL,
+  rates INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshots_taken_at ON Snapshots (taken_at);
+
+-- SQLite cannot drop a column used by a foreign key, so snapshot_id has none
+-- here to keep the migration reversible.
+ALTER TABLE ExchangeRates ADD COLUMN snapshot_id INTEGER;
+
+ALTER TABLE LatestRates ADD COLUMN snapshot_id INTEGER;
+
+-- The latest rates stored so far become the first snapshot.
+INSERT INTO Snapshots (taken_at, rates)
+SELECT MAX(timestamp), COUNT(*) FROM LatestRates HAVING COUNT(*) > 0;
+
+UPDATE LatestRates SET snapshot_id = (SELECT MAX(snapshot_id) FROM Snapshots);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS IngestionRuns (
+  run_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  started_at TIMESTAMP NOT NULL,
+  finished_at TIMESTAMP,
+  status VARCHAR(20) NOT NULL,
+  provider VARCHAR(50) NOT NULL,
+  requested INTEGER NOT NULL DEFAULT 0,
+  received INTEGER NOT NULL DEFAULT 0,
+  inserted INTEGER NOT NULL DEFAULT 0,
+  skipped INTEGER NOT NULL DEFAULT 0,
+  snapshot_id INTEGER REFERENCES Snapshots(snapshot_id),
+  error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_runs_started_at ON IngestionRuns (started_at);
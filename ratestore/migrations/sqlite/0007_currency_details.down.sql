@@ -0,0 +1,4 @@
+ALTER TABLE FiatCurrencies DROP COLUMN iso_numeric;
+
+ALTER TABLE Cryptocurrencies DROP COLUMN contract_address;
+ALTER TABLE Cryptocurrencies DROP COLUMN chain;
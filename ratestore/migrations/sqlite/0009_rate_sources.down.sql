@@ -0,0 +1,22 @@
+-- Only the latest rates of the default source fit the old primary key. The
+-- raw rates of the other sources are kept, untagged.
+CREATE TABLE LatestRates_old (
+  cryptocurrency_id INTEGER NOT NULL REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INTEGER NOT NULL REFERENCES FiatCurrencies(fiat_currency_id),
+  rate DECIMAL(18, 8) NOT NULL,
+  timestamp TIMESTAMP NOT NULL,
+  snapshot_id INTEGER,
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id)
+);
+
+INSERT INTO LatestRates_old (cryptocurrency_id, fiat_currency_id, rate, timestamp, snapshot_id)
+SELECT cryptocurrency_id, fiat_currency_id, rate, timestamp, snapshot_id FROM LatestRates
+WHERE source = 'cryptocompare';
+
+DROP TABLE LatestRates;
+
+ALTER TABLE LatestRates_old RENAME TO LatestRates;
+
+ALTER TABLE ExchangeRates DROP COLUMN source;
+
+ALTER TABLE Snapshots DROP COLUMN source;
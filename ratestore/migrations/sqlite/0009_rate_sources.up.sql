@@ -0,0 +1,24 @@
+-- Every rate is tagged with the price source it was fetched from. The rates
+-- stored so far all came from CryptoCompare.
+ALTER TABLE Snapshots ADD COLUMN source VARCHAR(50) NOT NULL DEFAULT 'cryptocompare';
+
+ALTER TABLE ExchangeRates ADD COLUMN source VARCHAR(50) NOT NULL DEFAULT 'cryptocompare';
+
+-- LatestRates keeps the latest rate of every pair from every source. SQLite
+-- cannot change a primary key, so the table is rebuilt.
+CREATE TABLE LatestRates_new (
+  cryptocurrency_id INTEGER NOT NULL REFERENCES Cryptocurrencies(cryptocurrency_id),
+  fiat_currency_id INTEGER NOT NULL REFERENCES FiatCurrencies(fiat_currency_id),
+  rate DECIMAL(18, 8) NOT NULL,
+  timestamp TIMESTAMP NOT NULL,
+  snapshot_id INTEGER,
+  source VARCHAR(50) NOT NULL DEFAULT 'cryptocompare',
+  PRIMARY KEY (cryptocurrency_id, fiat_currency_id, source)
+);
+
+INSERT INTO LatestRates_new (cryptocurrency_id, fiat_currency_id, rate, timestamp, snapshot_id)
+SELECT cryptocurrency_id, fiat_currency_id, rate, timestamp, snapshot_id FROM LatestRates;
+
+DROP TABLE LatestRates;
+
+ALTER TABLE LatestRates_new RENAME TO LatestRates;
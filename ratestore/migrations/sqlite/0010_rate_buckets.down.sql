@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ux_exchange_rates_bucket;
+
+ALTER TABLE ExchangeRates DROP COLUMN bucket_start;
@@ -0,0 +1,33 @@
+-- Every raw rate belongs to a bucket of the configured rate bucket size, and a
+-- pair has at most one rate per source and bucket, so a retried or overlapping
+-- ingestion updates the rates it already stored instead of duplicating them.
+-- The rates stored so far are put in the buckets of the default size, 10
+-- minutes, which Go's bucketStart truncates their timestamp to, and only the
+-- latest rate of a pair, source and bucket is kept, as a later ingestion into
+-- the bucket would have.
+-- SQLite cannot add a NOT NULL column without a default, so bucket_start is
+-- nullable here; the rates are always inserted with one.
+ALTER TABLE ExchangeRates ADD COLUMN bucket_start TIMESTAMP;
+
+-- The driver stores times as text such as "2023-07-01 12:17:03.5 +0000 UTC",
+-- in UTC, which the date functions do not parse past the seconds.
+UPDATE ExchangeRates SET bucket_start =
+  strftime('%Y-%m-%d %H:', substr(timestamp, 1, 19)) ||
+  printf('%02d', CAST(strftime('%M', substr(timestamp, 1, 19)) AS INTEGER) / 10 * 10) ||
+  ':00 +0000 UTC';
+
+-- Keep the latest rate of every bucket, and of two rates with the same
+-- timestamp the last stored.
+DELETE FROM ExchangeRates
+WHERE EXISTS (
+  SELECT 1 FROM ExchangeRates later
+  WHERE later.cryptocurrency_id = ExchangeRates.cryptocurrency_id
+    AND later.fiat_currency_id = ExchangeRates.fiat_currency_id
+    AND later.source = ExchangeRates.source
+    AND later.bucket_start = ExchangeRates.bucket_start
+    AND (later.timestamp > ExchangeRates.timestamp
+      OR later.timestamp = ExchangeRates.timestamp AND later.exchange_rate_id > ExchangeRates.exchange_rate_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_exchange_rates_bucket
+  ON ExchangeRates (cryptocurrency_id, fiat_currency_id, source, bucket_start);
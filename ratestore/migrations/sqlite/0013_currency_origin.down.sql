@@ -0,0 +1,3 @@
+ALTER TABLE FiatCurrencies DROP COLUMN managed;
+
+ALTER TABLE Cryptocurrencies DROP COLUMN managed;
@@ -0,0 +1,316 @@
+package ratestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultRatesTable holds the raw rates of the months without a partition.
+const defaultRatesTable = "ExchangeRates"
+
+// ratesPlaceholder stands for the table of raw rates in the queries run by
+// unionRates.
+const ratesPlaceholder = "{rates}"
+
+var (
+	// ErrNotRolledUp is returned when archiving or dropping a partition whose
+	// rates are not all rolled up yet.
+	ErrNotRolledUp = errors.New("rates not rolled up yet")
+	// ErrPartitionArchived is returned when archiving a partition twice.
+	ErrPartitionArchived = errors.New("partition already archived")
+)
+
+// RatePartition is a month of raw rates stored in its own table.
+type RatePartition struct {
+	Month time.Time `json:"month"`
+	Table string    `json:"table"`
+	// Archived partitions are left out of the rollups, the history and the
+	// retention policy, and are only read by exports.
+	Archived bool `json:"archived"`
+}
+
+// monthStart returns the first instant of the UTC month of t.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// partitionTable returns the name of the partition of month.
+func partitionTable(month time.Time) string {
+	return defaultRatesTable + "_" + month.Format("200601")
+}
+
+// archiveTable returns the name of the archived partition of month.
+func archiveTable(month time.Time) string {
+	return defaultRatesTable + "Archive_" + month.Format("200601")
+}
+
+// ListRatePartitions returns the partitions of the raw rates, oldest first.
+func (d *Database) ListRatePartitions() ([]RatePartition, error) {
+	rows, err := d.query("SELECT month_start, table_name, archived FROM RatePartitions ORDER BY month_start")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := make([]RatePartition, 0)
+	for rows.Next() {
+		var p RatePartition
+		if err := rows.Scan(&p.Month, &p.Table, &p.Archived); err != nil {
+			return nil, err
+		}
+		p.Month = p.Month.UTC()
+		partitions = append(partitions, p)
+	}
+	return partitions, rows.Err()
+}
+
+// rateTables returns ExchangeRates and the partitions holding the raw rates
+// from from up to to, or up to any time if to is zero. Archived partitions are
+// only included with archived.
+func (d *Database) rateTables(from, to time.Time, archived bool) ([]string, error) {
+	partitions, err := d.ListRatePartitions()
+	if err != nil {
+		return nil, err
+	}
+	tables := []string{defaultRatesTable}
+	for _, p := range partitions {
+		if (p.Archived && !archived) || !p.Month.AddDate(0, 1, 0).After(from) || (!to.IsZero() && !p.Month.Before(to)) {
+			continue
+		}
+		tables = append(tables, p.Table)
+	}
+	return tables, nil
+}
+
+// unionRates returns query, which reads the raw rates from the ratesPlaceholder
+// table, run on every table and combined with UNION ALL, and its arguments
+// repeated for every table. An ORDER BY appended to it sorts the combined rows
+// by the names of the selected columns.
+func unionRates(query string, tables []string, args []interface{}) (string, []interface{}) {
+	queries := make([]string, len(tables))
+	unionArgs := make([]interface{}, 0, len(tables)*len(args))
+	for i, table := range tables {
+		queries[i] = strings.ReplaceAll(query, ratesPlaceholder, table)
+		unionArgs = append(unionArgs, args...)
+	}
+	return strings.Join(queries, " UNION ALL "), unionArgs
+}
+
+// rateGroup is the rates of a batch stored in one table.
+type rateGroup struct {
+	table string
+	rates []ExchangeRate
+}
+
+// groupRates splits rates by the table they are stored in. Without
+// partitioning, that is ExchangeRates. With it, every month gets its partition
+// the first time it has rates, unless ExchangeRates already has rates of that
+// month, which then keeps them so that a pair still has one rate per bucket.
+// The partitions are created before the rates are written, since MySQL commits
+// the transaction running a CREATE TABLE.
+func (d *Database) groupRates(rates []ExchangeRate) ([]rateGroup, error) {
+	if !d.partitioned {
+		return []rateGroup{{table: defaultRatesTable, rates: rates}}, nil
+	}
+
+	partitions, err := d.ListRatePartitions()
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[time.Time]string, len(partitions))
+	for _, p := range partitions {
+		tables[p.Month] = p.Table
+	}
+
+	byTable := make(map[string][]ExchangeRate)
+	var months []time.Time
+	for _, rate := range rates {
+		month := monthStart(bucketStart(rate.Timestamp, d.bucketSize()))
+		table, ok := tables[month]
+		if !ok {
+			if table, err = d.createPartition(month); err != nil {
+				return nil, fmt.Errorf("creating the partition of %s: %w", month.Format("2006-01"), err)
+			}
+			tables[month] = table
+		}
+		if _, ok := byTable[table]; !ok {
+			months = append(months, month)
+		}
+		byTable[table] = append(byTable[table], rate)
+	}
+
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	groups := make([]rateGroup, 0, len(months))
+	for _, month := range months {
+		groups = append(groups, rateGroup{table: tables[month], rates: byTable[tables[month]]})
+	}
+	return groups, nil
+}
+
+// createPartition creates and registers the partition of month, and returns
+// its table, or ExchangeRates if it has rates of month.
+func (d *Database) createPartition(month time.Time) (string, error) {
+	var inDefault bool
+	err := d.queryRow("SELECT EXISTS (SELECT 1 FROM "+defaultRatesTable+" WHERE timestamp >= ? AND timestamp < ?)",
+		month, month.AddDate(0, 1, 0)).Scan(&inDefault)
+	if err != nil {
+		return "", err
+	}
+	if inDefault {
+		return defaultRatesTable, nil
+	}
+
+	table := partitionTable(month)
+	for _, statement := range d.dialect.createPartition(table) {
+		if _, err := d.DB.Exec(statement); err != nil {
+			return "", err
+		}
+	}
+	_, err = d.DB.Exec(d.dialect.rebind("INSERT INTO RatePartitions (month_start, table_name, archived, created_at) VALUES (?, ?, ?, ?)"),
+		month, table, false, time.Now().UTC())
+	if err != nil {
+		// Another ingestion may have registered the partition first.
+		var registered string
+		if d.queryRow("SELECT table_name FROM RatePartitions WHERE month_start = ?", month).Scan(&registered) == nil {
+			return registered, nil
+		}
+		return "", err
+	}
+	return table, nil
+}
+
+// ArchiveRatePartition renames the partition of the month of month to its
+// archive table, which only exports read. The rates of the month must be
+// rolled up, so that the history keeps serving them from the rollups.
+//
+// MySQL commits a rename on its own, so an archive interrupted after it leaves
+// the partition registered under its former table. Archiving it again finds
+// the archive table in place of the partition and only repairs the registry.
+func (d *Database) ArchiveRatePartition(month time.Time) (RatePartition, error) {
+	p, err := d.rolledUpPartition(month)
+	if err != nil {
+		return RatePartition{}, err
+	}
+	if p.Archived {
+		return p, fmt.Errorf("partition of %s: %w", p.Month.Format("2006-01"), ErrPartitionArchived)
+	}
+
+	archived := archiveTable(p.Month)
+	renamed := d.tableExists(archived) && !d.tableExists(p.Table)
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return RatePartition{}, err
+	}
+	defer tx.Rollback()
+
+	if !renamed {
+		if _, err := tx.Exec("ALTER TABLE " + p.Table + " RENAME TO " + archived); err != nil {
+			return RatePartition{}, err
+		}
+	}
+	_, err = tx.Exec(d.dialect.rebind("UPDATE RatePartitions SET table_name = ?, archived = ? WHERE month_start = ?"),
+		archived, true, p.Month)
+	if err != nil {
+		return RatePartition{}, err
+	}
+	p.Table, p.Archived = archived, true
+	return p, tx.Commit()
+}
+
+// tableExists reports whether table can be read. It runs outside of any
+// transaction, which a failed statement aborts on PostgreSQL.
+func (d *Database) tableExists(table string) bool {
+	rows, err := d.DB.Query("SELECT 1 FROM " + table + " WHERE 1 = 0")
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// DropRatePartition drops the partition, archived or not, of the month of
+// month. The rates of the month must be rolled up.
+func (d *Database) DropRatePartition(month time.Time) (RatePartition, error) {
+	p, err := d.rolledUpPartition(month)
+	if err != nil {
+		return RatePartition{}, err
+	}
+	return p, d.dropPartition(p)
+}
+
+func (d *Database) dropPartition(p RatePartition) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DROP TABLE " + p.Table); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(d.dialect.rebind("DELETE FROM RatePartitions WHERE month_start = ?"), p.Month); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rolledUpPartition returns the partition of the month of month, or
+// ErrNotFound, and ErrNotRolledUp unless the hourly rollups cover the month.
+// The latest hourly bucket does not count, since the next rollup recomputes
+// it.
+func (d *Database) rolledUpPartition(month time.Time) (RatePartition, error) {
+	month = monthStart(month)
+	partitions, err := d.ListRatePartitions()
+	if err != nil {
+		return RatePartition{}, err
+	}
+	for _, p := range partitions {
+		if !p.Month.Equal(month) {
+			continue
+		}
+		latest, ok, err := d.firstTime(hourlyRollup.latest())
+		if err != nil {
+			return RatePartition{}, err
+		}
+		if !p.Archived && (!ok || latest.Before(month.AddDate(0, 1, 0))) {
+			return RatePartition{}, fmt.Errorf("partition of %s: %w", month.Format("2006-01"), ErrNotRolledUp)
+		}
+		return p, nil
+	}
+	return RatePartition{}, fmt.Errorf("partition of %s: %w", month.Format("2006-01"), ErrNotFound)
+}
+
+// dropExpiredPartitions drops the partitions, but not the archived ones, whose
+// whole month is before before, and returns how many it dropped. Only the
+// rates of DefaultSource are rolled up, so the partitions holding rates of
+// other sources are kept.
+func (d *Database) dropExpiredPartitions(before time.Time) (int, error) {
+	partitions, err := d.ListRatePartitions()
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	for _, p := range partitions {
+		if p.Archived || p.Month.AddDate(0, 1, 0).After(before) {
+			continue
+		}
+		var otherSources bool
+		query := "SELECT EXISTS (SELECT 1 FROM " + p.Table + " WHERE source <> ?)"
+		if err := d.queryRow(query, DefaultSource).Scan(&otherSources); err != nil {
+			return dropped, err
+		}
+		if otherSources {
+			continue
+		}
+		if err := d.dropPartition(p); err != nil {
+			return dropped, fmt.Errorf("dropping the partition of %s: %w", p.Month.Format("2006-01"), err)
+		}
+		dropped++
+	}
+	return dropped, nil
+}
@@ -0,0 +1,197 @@
+package ratestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPartitionedDatabase is like newTestDatabase with partitioned raw rates.
+func newPartitionedDatabase(t *testing.T) *Database {
+	db := newTestDatabase(t)
+	db.partitioned = true
+	return db
+}
+
+func countRates(t *testing.T, db *Database, table string) int {
+	var n int
+	require.NoError(t, db.DB.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&n))
+	return n
+}
+
+func exportedRates(t *testing.T, db *Database, from, to time.Time) []ArchivedRate {
+	var rates []ArchivedRate
+	_, err := db.ExportExchangeRates(from, to, func(rate ArchivedRate) error {
+		rates = append(rates, rate)
+		return nil
+	})
+	require.NoError(t, err)
+	return rates
+}
+
+func TestDatabaseInsertExchangeRatesPartitioned(t *testing.T) {
+	db := newPartitionedDatabase(t)
+	jan := time.Date(2023, 1, 31, 23, 30, 0, 0, time.UTC)
+	feb := time.Date(2023, 2, 1, 0, 30, 0, 0, time.UTC)
+	batch := []ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("20000"), Timestamp: jan},
+		{CryptoID: 1, FiatID: 1, Rate: dec("21000"), Timestamp: feb},
+	}
+
+	snapshot, err := db.InsertExchangeRates(batch)
+	require.NoError(t, err)
+	assert.NotZero(t, snapshot.ID)
+
+	partitions, err := db.ListRatePartitions()
+	require.NoError(t, err)
+	assert.Equal(t, []RatePartition{
+		{Month: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Table: "ExchangeRates_202301"},
+		{Month: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), Table: "ExchangeRates_202302"},
+	}, partitions)
+	assert.Equal(t, 0, countRates(t, db, "ExchangeRates"))
+	assert.Equal(t, 1, countRates(t, db, "ExchangeRates_202301"))
+	assert.Equal(t, 1, countRates(t, db, "ExchangeRates_202302"))
+
+	snapshot, err = db.InsertExchangeRates(batch)
+	require.NoError(t, err)
+	assert.Zero(t, snapshot, "a replayed batch is only stored once across partitions")
+
+	rates := exportedRates(t, db, jan.Add(-time.Hour), feb.Add(time.Hour))
+	require.Len(t, rates, 2)
+	assert.True(t, jan.Equal(rates[0].Timestamp))
+	assert.True(t, feb.Equal(rates[1].Timestamp))
+
+	result, err := db.Rollup(feb.Add(2 * time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.HourlyBuckets)
+}
+
+func TestDatabaseInsertExchangeRatesKeepsMonthsOfExchangeRates(t *testing.T) {
+	db := newTestDatabase(t)
+	insertTestRate(t, db, 1, 1, "20000", time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC))
+
+	db.partitioned = true
+	insertTestRate(t, db, 1, 1, "21000", time.Date(2023, 1, 20, 12, 0, 0, 0, time.UTC))
+	insertTestRate(t, db, 1, 1, "22000", time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	partitions, err := db.ListRatePartitions()
+	require.NoError(t, err)
+	require.Len(t, partitions, 1)
+	assert.Equal(t, "ExchangeRates_202303", partitions[0].Table)
+	assert.Equal(t, 2, countRates(t, db, "ExchangeRates"))
+}
+
+func TestGetRateHistorySpansPartitions(t *testing.T) {
+	db := newPartitionedDatabase(t)
+	now := time.Now().UTC()
+	lastMonth := monthStart(now).Add(-time.Hour)
+	insertTestRate(t, db, 1, 1, "25.2", lastMonth)
+	insertTestRate(t, db, 1, 1, "30.5", now)
+
+	partitions, err := db.ListRatePartitions()
+	require.NoError(t, err)
+	assert.Len(t, partitions, 2)
+
+	history, err := db.GetRateHistory("BTC", "USD", lastMonth.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "25.2", history[0].Value.String())
+	assert.Equal(t, "30.5", history[1].Value.String())
+}
+
+func TestArchiveAndDropRatePartition(t *testing.T) {
+	db := newPartitionedDatabase(t)
+	jan := time.Date(2023, 1, 15, 12, 0, 0, 0, time.UTC)
+	feb := time.Date(2023, 2, 10, 12, 0, 0, 0, time.UTC)
+	insertTestRate(t, db, 2, 1, "1500", jan)
+	insertTestRate(t, db, 1, 1, "22000", feb)
+
+	_, err := db.ArchiveRatePartition(jan)
+	assert.ErrorIs(t, err, ErrNotRolledUp)
+
+	_, err = db.Rollup(feb.Add(2 * time.Hour))
+	require.NoError(t, err)
+
+	archived, err := db.ArchiveRatePartition(jan)
+	require.NoError(t, err)
+	assert.Equal(t, RatePartition{Month: monthStart(jan), Table: "ExchangeRatesArchive_202301", Archived: true}, archived)
+	_, err = db.ArchiveRatePartition(jan)
+	assert.ErrorIs(t, err, ErrPartitionArchived)
+
+	// Archived rates are only exported.
+	rates := exportedRates(t, db, jan, feb.Add(time.Hour))
+	require.Len(t, rates, 2)
+	assert.Equal(t, "ETH", rates[0].Crypto)
+	history, err := db.GetRateHistory("ETH", "USD", jan.Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, history, 1, "the history of an archived month is served from the rollups")
+	assert.Equal(t, "1500", history[0].Value.String())
+	assert.ErrorIs(t, db.RemoveCurrency(CurrencyTypeCrypto, "ETH"), ErrCurrencyInUse)
+
+	_, err = db.DropRatePartition(feb)
+	assert.ErrorIs(t, err, ErrNotRolledUp)
+	_, err = db.DropRatePartition(time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = db.DropRatePartition(jan)
+	require.NoError(t, err)
+	partitions, err := db.ListRatePartitions()
+	require.NoError(t, err)
+	require.Len(t, partitions, 1)
+	assert.Equal(t, "ExchangeRates_202302", partitions[0].Table)
+	_, err = db.DB.Exec("SELECT 1 FROM ExchangeRatesArchive_202301")
+	assert.Error(t, err)
+}
+
+func TestArchiveRatePartitionRepairsRegistry(t *testing.T) {
+	db := newPartitionedDatabase(t)
+	jan := time.Date(2023, 1, 15, 12, 0, 0, 0, time.UTC)
+	feb := time.Date(2023, 2, 10, 12, 0, 0, 0, time.UTC)
+	insertTestRate(t, db, 2, 1, "1500", jan)
+	insertTestRate(t, db, 1, 1, "22000", feb)
+	_, err := db.Rollup(feb.Add(2 * time.Hour))
+	require.NoError(t, err)
+
+	// The state left by an archive whose rename committed on its own.
+	_, err = db.DB.Exec("ALTER TABLE ExchangeRates_202301 RENAME TO ExchangeRatesArchive_202301")
+	require.NoError(t, err)
+
+	archived, err := db.ArchiveRatePartition(jan)
+	require.NoError(t, err)
+	assert.Equal(t, RatePartition{Month: monthStart(jan), Table: "ExchangeRatesArchive_202301", Archived: true}, archived)
+	partitions, err := db.ListRatePartitions()
+	require.NoError(t, err)
+	assert.Equal(t, archived, partitions[0])
+	assert.Len(t, exportedRates(t, db, jan, jan.Add(time.Hour)), 1)
+}
+
+func TestRollupRetentionDropsPartitions(t *testing.T) {
+	db := newPartitionedDatabase(t)
+	db.rawRetention = MinRawRetention
+	now := time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)
+	insertTestRate(t, db, 1, 1, "20000", time.Date(2023, 1, 15, 12, 0, 0, 0, time.UTC))
+	insertTestRate(t, db, 1, 1, "21000", time.Date(2023, 2, 15, 12, 0, 0, 0, time.UTC))
+	insertTestRate(t, db, 1, 1, "22000", time.Date(2023, 3, 1, 5, 0, 0, 0, time.UTC))
+	insertTestRate(t, db, 1, 1, "23000", now.Add(-2*time.Hour))
+	_, err := db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("20100"), Timestamp: time.Date(2023, 1, 20, 12, 0, 0, 0, time.UTC), Source: "kraken"},
+	})
+	require.NoError(t, err)
+
+	result, err := db.Rollup(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.DroppedPartitions, "a partition holding rates of another source is kept")
+	assert.Equal(t, int64(2), result.Pruned)
+
+	partitions, err := db.ListRatePartitions()
+	require.NoError(t, err)
+	require.Len(t, partitions, 2)
+	assert.Equal(t, "2023-01", partitions[0].Month.Format("2006-01"))
+	assert.Equal(t, []ArchivedRate{
+		{Crypto: "BTC", Fiat: "USD", Rate: dec("20100"), Timestamp: time.Date(2023, 1, 20, 12, 0, 0, 0, time.UTC), Source: "kraken"},
+	}, exportedRates(t, db, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 1, countRates(t, db, partitions[1].Table))
+	assert.Len(t, queryCandles(t, db, "HourlyRates"), 4)
+}
@@ -0,0 +1,65 @@
+// Package ratestore holds the exchange rate queries shared by cryptolocal and
+// the rates Netlify function.
+package ratestore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrNotFound is returned when no exchange rate exists for the requested pair.
+var ErrNotFound = errors.New("exchange rate not found")
+
+// RateWithTimestamp is a single exchange rate observation.
+type RateWithTimestamp struct {
+	Value     decimal.Decimal `json:"value"`
+	Timestamp string          `json:"timestamp"`
+}
+
+// Snapshot identifies the ingestion batch the latest rates are served from.
+// Every latest-rate query answers from a single snapshot, so the rates of one
+// response were all fetched together from the same source.
+type Snapshot struct {
+	ID      int64     `json:"snapshot_id"`
+	TakenAt time.Time `json:"snapshot_time"`
+	Source  string    `json:"source"`
+}
+
+// RateStore is the set of queries the rates endpoints are served from.
+type RateStore interface {
+	// CheckCryptoCurrency reports whether the cryptocurrency symbol, or alias, is known in any case. It returns
+	// ErrCurrencyDisabled for a known cryptocurrency that has been disabled.
+	CheckCryptoCurrency(crypto string) (bool, error)
+	// CheckFiatCurrency reports whether the fiat currency symbol, or alias, is known in any case. It returns
+	// ErrCurrencyDisabled for a known fiat currency that has been disabled.
+	CheckFiatCurrency(fiat string) (bool, error)
+	// ResolveCryptoCurrency returns the symbol of the cryptocurrency named by crypto in any case, as its symbol
+	// or one of its aliases. It returns ErrUnknownCurrency if there is none, and the symbol with
+	// ErrCurrencyDisabled if the cryptocurrency is disabled.
+	ResolveCryptoCurrency(crypto string) (string, error)
+	// ResolveFiatCurrency returns the symbol of the fiat currency named by fiat, like ResolveCryptoCurrency.
+	ResolveFiatCurrency(fiat string) (string, error)
+	// ListCurrencies returns the currencies of a type, or of every type if currencyType is empty, cryptocurrencies
+	// first and then by symbol. Disabled currencies are only included with includeInactive.
+	ListCurrencies(currencyType string, includeInactive bool) ([]Currency, error)
+	// GetExchangeRate returns the latest rate of crypto in fiat from source, or DefaultSource if source is
+	// empty, and its snapshot.
+	GetExchangeRate(crypto, fiat, source string) (decimal.Decimal, Snapshot, error)
+	// GetExchangeRatesForCrypto returns the latest rate of crypto in every fiat currency from source, keyed by
+	// fiat symbol, and their snapshot. The snapshot is zero when there are no rates.
+	GetExchangeRatesForCrypto(crypto, source string) (map[string]decimal.Decimal, Snapshot, error)
+	// GetAllExchangeRates returns the latest rate of every pair from source, keyed by crypto and then fiat
+	// symbol, and their snapshot. The snapshot is zero when there are no rates.
+	GetAllExchangeRates(source string) (map[string]map[string]decimal.Decimal, Snapshot, error)
+	// GetExchangeRateSources returns the latest rate of crypto in fiat from every source, ordered by source. It
+	// returns ErrNotFound if there is none.
+	GetExchangeRateSources(crypto, fiat string) ([]SourceRate, error)
+	// GetHistoricalExchangeRates returns the rates of crypto in fiat from DefaultSource over the past 24 hours.
+	GetHistoricalExchangeRates(crypto, fiat string) ([]RateWithTimestamp, error)
+	// GetRateHistory returns the rates of crypto in fiat from DefaultSource since the given time, oldest first.
+	GetRateHistory(crypto, fiat string, since time.Time) ([]RateWithTimestamp, error)
+	// Close releases the resources held by the store.
+	Close() error
+}
@@ -0,0 +1,227 @@
+package ratestore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisKeyPrefix namespaces the keys of a RedisCache.
+const redisKeyPrefix = "ratestore:"
+
+// redisGenerationKey holds the generation of a RedisCache, bumped by Purge.
+const redisGenerationKey = redisKeyPrefix + "generation"
+
+// redisMaxIdleConns is the number of idle connections a RedisCache keeps.
+const redisMaxIdleConns = 8
+
+// redisError is an error reply of the server, after which the connection is
+// still usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// RedisCache is a Cache kept by a server speaking the Redis protocol, so that
+// every instance of the service shares its entries and their invalidation.
+// Purge bumps the generation stored in the server, leaving the entries of the
+// previous generations to expire on their own.
+type RedisCache struct {
+	address  string
+	password string
+	db       int
+	timeout  time.Duration
+
+	idle chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+var _ Cache = (*RedisCache)(nil)
+
+// NewRedisCache returns a RedisCache for the server of cfg. It connects on
+// first use, so that an unreachable server does not prevent serving from the
+// database.
+func NewRedisCache(cfg CacheConfig) *RedisCache {
+	cfg = cfg.withDefaults()
+	return &RedisCache{address: cfg.Address, password: cfg.Password, db: cfg.RedisDB, timeout: cfg.Timeout,
+		idle: make(chan *redisConn, redisMaxIdleConns)}
+}
+
+// Ping checks that the server answers.
+func (c *RedisCache) Ping() error {
+	_, err := c.do("PING")
+	return err
+}
+
+// Generation returns the generation stored in the server, zero until the
+// first Purge.
+func (c *RedisCache) Generation() (int64, error) {
+	reply, err := c.do("GET", redisGenerationKey)
+	if err != nil || reply == nil {
+		return 0, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected generation %v", reply)
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+// Get returns the value of key unless it is missing or expired.
+func (c *RedisCache) Get(key string) ([]byte, bool, error) {
+	reply, err := c.do("GET", redisKeyPrefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: unexpected value of %s", key)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key for ttl, rounded up to a millisecond.
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	milliseconds := (ttl + time.Millisecond - 1) / time.Millisecond
+	if milliseconds < 1 {
+		milliseconds = 1
+	}
+	_, err := c.do("SET", redisKeyPrefix+key, string(value), "PX", strconv.FormatInt(int64(milliseconds), 10))
+	return err
+}
+
+// Purge bumps the generation stored in the server.
+func (c *RedisCache) Purge() error {
+	_, err := c.do("INCR", redisGenerationKey)
+	return err
+}
+
+// Close closes the idle connections.
+func (c *RedisCache) Close() error {
+	for {
+		select {
+		case rc := <-c.idle:
+			rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and returns its reply: nil, a string, an int64, a
+// []byte or an []interface{} of those.
+func (c *RedisCache) do(args ...string) (interface{}, error) {
+	rc, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := rc.do(c.timeout, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		rc.conn.Close()
+		return nil, err
+	}
+
+	select {
+	case c.idle <- rc:
+	default:
+		rc.conn.Close()
+	}
+	return reply, err
+}
+
+// conn returns an idle connection, or a new one.
+func (c *RedisCache) conn() (*redisConn, error) {
+	select {
+	case rc := <-c.idle:
+		return rc, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+	if c.password != "" {
+		if _, err := rc.do(c.timeout, "AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do(c.timeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// do sends a command on rc and reads its reply within timeout.
+func (rc *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if err := rc.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return readRedisReply(rc.reader)
+}
+
+// readRedisReply reads a reply of the Redis protocol from r.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", line)
+}
@@ -0,0 +1,181 @@
+package ratestore
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is a server speaking enough of the Redis protocol for a
+// RedisCache: AUTH, SELECT, PING, GET, SET with PX and INCR.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	expiry   map[string]time.Time
+	commands []string
+}
+
+// newFakeRedis starts a fakeRedis requiring password, if not empty, until the
+// end of the test.
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{listener: listener, password: password, values: map[string]string{}, expiry: map[string]time.Time{}}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) address() string {
+	return f.listener.Addr().String()
+}
+
+// received returns the names of the commands received so far.
+func (f *fakeRedis) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		request, err := readRedisReply(reader)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range request.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+		if args[0] != "AUTH" && !authenticated {
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		if args[0] == "AUTH" {
+			authenticated = args[1] == f.password
+		}
+		fmt.Fprint(conn, f.reply(args))
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, args[0])
+
+	if len(args) > 1 {
+		if expiry, ok := f.expiry[args[1]]; ok && !time.Now().Before(expiry) {
+			delete(f.values, args[1])
+			delete(f.expiry, args[1])
+		}
+	}
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[1] != f.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		f.values[args[1]] = args[2]
+		delete(f.expiry, args[1])
+		if len(args) == 5 && args[3] == "PX" {
+			milliseconds, _ := strconv.Atoi(args[4])
+			f.expiry[args[1]] = time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "INCR":
+		n, err := strconv.ParseInt(f.values[args[1]], 10, 64)
+		if err != nil && f.values[args[1]] != "" {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		f.values[args[1]] = strconv.FormatInt(n+1, 10)
+		return fmt.Sprintf(":%d\r\n", n+1)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+func TestRedisCache(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	cache := NewRedisCache(CacheConfig{Address: server.address(), Password: "secret", RedisDB: 2})
+	defer cache.Close()
+
+	require.NoError(t, cache.Ping())
+	_, ok, err := cache.Get("a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set("a", []byte("1\r\n2"), time.Minute))
+	require.NoError(t, cache.Set("b", []byte("3"), time.Millisecond))
+	value, ok, err := cache.Get("a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1\r\n2"), value)
+	time.Sleep(5 * time.Millisecond)
+	_, ok, err = cache.Get("b")
+	require.NoError(t, err)
+	assert.False(t, ok, "an entry expires after its ttl")
+
+	generation, err := cache.Generation()
+	require.NoError(t, err)
+	assert.Zero(t, generation)
+	require.NoError(t, cache.Purge())
+	require.NoError(t, cache.Purge())
+	generation, err = cache.Generation()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), generation)
+
+	// The connection is authenticated and selects the database once, and is
+	// reused by every command.
+	assert.Equal(t, []string{"AUTH", "SELECT", "PING", "GET", "SET", "SET", "GET", "GET", "GET", "INCR", "INCR", "GET"}, server.received())
+}
+
+func TestRedisCacheErrors(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+
+	cache := NewRedisCache(CacheConfig{Address: server.address(), Password: "wrong"})
+	assert.EqualError(t, cache.Ping(), "redis: WRONGPASS invalid password")
+
+	cache = NewRedisCache(CacheConfig{Address: server.address(), Password: "secret"})
+	require.NoError(t, cache.Set("generation", []byte("many"), time.Minute))
+	_, err := cache.Generation()
+	assert.Error(t, err)
+	assert.EqualError(t, cache.Purge(), "redis: ERR value is not an integer or out of range")
+	assert.NoError(t, cache.Ping(), "an error reply leaves the connection usable")
+
+	server.listener.Close()
+	cache.Close()
+	assert.Error(t, cache.Ping())
+}
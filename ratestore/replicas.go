@@ -0,0 +1,221 @@
+package ratestore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// replicaCheckInterval is how long the measured lag of a replica is trusted
+// before it is measured again, and how long a failed replica is skipped.
+const replicaCheckInterval = 5 * time.Second
+
+// replicaCheckTimeout bounds a measure of the lag of a replica.
+const replicaCheckTimeout = time.Second
+
+// errReplicationStopped is the lag measure of a replica that does not apply
+// the changes of its primary.
+var errReplicationStopped = errors.New("replication is stopped")
+
+// errReplicaPrivilege is the lag measure of a MySQL replica whose user lacks
+// the REPLICATION CLIENT privilege that SHOW REPLICA STATUS needs.
+var errReplicaPrivilege = errors.New("the replica user lacks the REPLICATION CLIENT privilege")
+
+// mysqlSpecificAccessDenied is the MySQL error number of a statement that
+// needs a privilege the user does not have.
+const mysqlSpecificAccessDenied = 1227
+
+// replica is a read replica of the primary database.
+type replica struct {
+	// host is the host of the replica, without its credentials, or its file
+	// path for SQLite.
+	host string
+	db   *sql.DB
+	// lag measures how far the replica is behind its primary.
+	lag func(ctx context.Context, db *sql.DB) (time.Duration, error)
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	usable    bool
+	// privilegeLogged is set once a missing privilege has been logged, so
+	// that a replica that is never usable is not logged at every check.
+	privilegeLogged bool
+}
+
+// available reports whether the replica was lagging less than maxLag at its
+// last check, measuring the lag again if that check is too old.
+func (r *replica) available(maxLag time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < replicaCheckInterval {
+		return r.usable
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+	lag, err := r.lag(ctx, r.db)
+	if errors.Is(err, errReplicaPrivilege) && !r.privilegeLogged {
+		log.Printf("ratestore: replica %s is not used: %v", r.host, err)
+		r.privilegeLogged = true
+	}
+	r.usable = err == nil && lag <= maxLag
+	r.checkedAt = time.Now()
+	return r.usable
+}
+
+// failed skips the replica until its next check.
+func (r *replica) failed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.usable = false
+	r.checkedAt = time.Now()
+}
+
+// openReplicas opens a connection pool to every replica of cfg. Replicas are
+// not checked until their first read, so that one that is down does not stop
+// the primary from serving.
+func openReplicas(cfg Config, dialect dialect) ([]*replica, error) {
+	replicas := make([]*replica, 0, len(cfg.Replicas))
+	for _, address := range cfg.Replicas {
+		replicaCfg := cfg.replica(address)
+		db, err := openPool(replicaCfg, dialect)
+		if err != nil {
+			closeReplicas(replicas)
+			return nil, err
+		}
+		host := replicaCfg.Host
+		if cfg.Driver == DriverSQLite {
+			host = replicaCfg.Database
+		}
+		replicas = append(replicas, &replica{host: host, db: db, lag: dialect.replicaLag})
+	}
+	return replicas, nil
+}
+
+func closeReplicas(replicas []*replica) error {
+	var firstErr error
+	for _, r := range replicas {
+		if err := r.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// reader returns the next available replica in turn, or nil if none is.
+func (d *Database) reader() *replica {
+	n := uint32(len(d.replicas))
+	if n == 0 {
+		return nil
+	}
+	start := atomic.AddUint32(&d.nextReplica, 1)
+	for i := uint32(0); i < n; i++ {
+		if r := d.replicas[(start+i)%n]; r.available(d.maxReplicaLag) {
+			return r
+		}
+	}
+	return nil
+}
+
+// readQuery is like query but runs on an available replica if there is one,
+// and on the primary if there is none or the replica fails. It is meant for
+// the reads served to clients, which tolerate the replica lag: the reads of a
+// write stay on the primary.
+func (d *Database) readQuery(query string, args ...interface{}) (*sql.Rows, error) {
+	query = d.dialect.rebind(query)
+	if r := d.reader(); r != nil {
+		rows, err := r.db.Query(query, args...)
+		if err == nil {
+			return rows, nil
+		}
+		r.failed()
+	}
+	return d.DB.Query(query, args...)
+}
+
+// readQueryRow is like readQuery but returns at most one row.
+func (d *Database) readQueryRow(query string, args ...interface{}) *sql.Row {
+	query = d.dialect.rebind(query)
+	if r := d.reader(); r != nil {
+		row := r.db.QueryRow(query, args...)
+		if row.Err() == nil {
+			return row
+		}
+		r.failed()
+	}
+	return d.DB.QueryRow(query, args...)
+}
+
+// mysqlReplicaLag reads the lag of a MySQL (8.0.22 or later) or MariaDB
+// replica from its replica status, which is empty on a server that is not a
+// replica. It fails with errReplicaPrivilege if the user may not read it.
+func mysqlReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlSpecificAccessDenied {
+		return 0, errReplicaPrivilege
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, errReplicationStopped
+		}
+		seconds, err := strconv.ParseInt(values[i].String, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("no replica lag in the replica status")
+}
+
+// postgresReplicaLag measures the lag of a PostgreSQL standby as the age of
+// the last transaction it replayed, unless it has replayed all it received.
+// It is zero on a server that is not a standby.
+func postgresReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx, `
+	SELECT COALESCE(CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END, 0)
+	`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// noReplicaLag is the lag of an SQLite replica, a copy of the primary's file
+// kept up to date outside of the service.
+func noReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	return 0, db.PingContext(ctx)
+}
@@ -0,0 +1,154 @@
+package ratestore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplicatedDatabase opens a primary test database with the given replicas,
+// each a separate test database standing for a copy of the primary, and
+// returns it with the replicas opened directly.
+func newReplicatedDatabase(t *testing.T, replicas int) (*Database, []*Database) {
+	dir := t.TempDir()
+	primaryPath := filepath.Join(dir, "primary.db")
+	openTestDatabase(t, primaryPath)
+
+	cfg := Config{Driver: DriverSQLite, Database: primaryPath}
+	direct := make([]*Database, replicas)
+	for i := range direct {
+		path := filepath.Join(dir, fmt.Sprintf("replica%d.db", i))
+		direct[i] = openTestDatabase(t, path)
+		cfg.Replicas = append(cfg.Replicas, path)
+	}
+
+	db, err := NewDatabase(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db, direct
+}
+
+// setReplicaLag makes the replicas of db report lag, or fail with err, from
+// their next read.
+func setReplicaLag(db *Database, lag time.Duration, err error) {
+	for _, r := range db.replicas {
+		r.lag = func(context.Context, *sql.DB) (time.Duration, error) { return lag, err }
+		r.checkedAt = time.Time{}
+	}
+}
+
+func TestDatabaseReadsFromReplica(t *testing.T) {
+	db, replicas := newReplicatedDatabase(t, 1)
+	now := time.Now().UTC().Truncate(DefaultRateBucket)
+	insertTestRate(t, db, 1, 1, "30000", now)
+	insertTestRate(t, replicas[0], 1, 1, "29000", now.Add(-DefaultRateBucket))
+
+	rate, _, err := db.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "29000", rate.String())
+	history, err := db.GetHistoricalExchangeRates("BTC", "USD")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "29000", history[0].Value.String())
+
+	// Reads of writes stay on the primary.
+	cryptoIDs, err := db.GetCryptoMappings()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"BTC": 1, "ETH": 2}, cryptoIDs)
+	var rates int
+	require.NoError(t, db.queryRow("SELECT COUNT(*) FROM ExchangeRates WHERE rate = 30000").Scan(&rates))
+	assert.Equal(t, 1, rates)
+}
+
+func TestDatabaseReadsFallBackToPrimary(t *testing.T) {
+	db, replicas := newReplicatedDatabase(t, 1)
+	now := time.Now().UTC().Truncate(DefaultRateBucket)
+	insertTestRate(t, db, 1, 1, "30000", now)
+	insertTestRate(t, replicas[0], 1, 1, "29000", now.Add(-DefaultRateBucket))
+
+	setReplicaLag(db, time.Minute, nil)
+	rate, _, err := db.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "30000", rate.String(), "a replica lagging more than the maximum is not read")
+
+	setReplicaLag(db, DefaultMaxReplicaLag, nil)
+	rate, _, err = db.GetExchangeRate("BTC", "USD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "29000", rate.String())
+
+	setReplicaLag(db, 0, errReplicationStopped)
+	rates, _, err := db.GetAllExchangeRates("")
+	require.NoError(t, err)
+	assert.Equal(t, "30000", rates["BTC"]["USD"].String(), "a replica whose lag is unknown is not read")
+
+	setReplicaLag(db, 0, nil)
+	require.NoError(t, db.replicas[0].db.Close())
+	rates, _, err = db.GetAllExchangeRates("")
+	require.NoError(t, err)
+	assert.Equal(t, "30000", rates["BTC"]["USD"].String(), "a failed read is retried on the primary")
+	assert.False(t, db.replicas[0].available(DefaultMaxReplicaLag), "a failed replica is skipped until its next check")
+	symbol, err := db.ResolveCryptoCurrency("btc")
+	require.NoError(t, err)
+	assert.Equal(t, "BTC", symbol)
+}
+
+func TestDatabaseReadsRotateReplicas(t *testing.T) {
+	db, replicas := newReplicatedDatabase(t, 2)
+	now := time.Now().UTC().Truncate(DefaultRateBucket)
+	insertTestRate(t, replicas[0], 1, 1, "1", now)
+	insertTestRate(t, replicas[1], 1, 1, "2", now)
+
+	served := map[string]int{}
+	for i := 0; i < 4; i++ {
+		rate, _, err := db.GetExchangeRate("BTC", "USD", "")
+		require.NoError(t, err)
+		served[rate.String()]++
+	}
+	assert.Equal(t, map[string]int{"1": 2, "2": 2}, served)
+
+	db.replicas[0].failed()
+	for i := 0; i < 2; i++ {
+		rate, _, err := db.GetExchangeRate("BTC", "USD", "")
+		require.NoError(t, err)
+		assert.Equal(t, "2", rate.String())
+	}
+}
+
+func TestReplicaLogsMissingPrivilegeOnce(t *testing.T) {
+	db, _ := newReplicatedDatabase(t, 1)
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	setReplicaLag(db, 0, errReplicaPrivilege)
+	assert.False(t, db.replicas[0].available(DefaultMaxReplicaLag))
+	db.replicas[0].checkedAt = time.Time{}
+	assert.False(t, db.replicas[0].available(DefaultMaxReplicaLag))
+	assert.Equal(t, 1, strings.Count(logged.String(), "REPLICATION CLIENT"))
+}
+
+func TestNewDatabaseWithUnreachableReplica(t *testing.T) {
+	dir := t.TempDir()
+	primaryPath := filepath.Join(dir, "primary.db")
+	openTestDatabase(t, primaryPath)
+
+	db, err := NewDatabase(Config{Driver: DriverSQLite, Database: primaryPath,
+		Replicas: []string{filepath.Join(dir, "missing", "replica.db")}})
+	require.NoError(t, err)
+	defer db.Close()
+
+	exists, err := db.CheckCryptoCurrency("ETH")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.False(t, db.replicas[0].usable)
+}
@@ -0,0 +1,471 @@
+package ratestore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// RawHistoryWindow is how far back history is read from the raw exchange
+// rates. Older history is read from the hourly and daily rollups.
+const RawHistoryWindow = 24 * time.Hour
+
+// hourlyHistoryWindow is how far back history is read at hourly resolution
+// before switching to daily rollups.
+const hourlyHistoryWindow = 31 * 24 * time.Hour
+
+// MinRawRetention is the shortest Config.RawRetention accepted, so that the
+// last RawHistoryWindow of history is always served from raw rates.
+const MinRawRetention = RawHistoryWindow
+
+// rollupLevel describes a table of open/high/low/close rollups and the rows it
+// aggregates.
+type rollupLevel struct {
+	table string
+	size  time.Duration
+	// source selects crypto ID, fiat ID, time, open, high, low, close and
+	// sample count of the aggregated rows between two times.
+	source string
+	// order sorts the rows of source by pair and time.
+	order string
+	// first selects the time of the oldest aggregated row.
+	first string
+	// raw reports whether the level aggregates the raw rates, which source
+	// and first read from the ratesPlaceholder table.
+	raw bool
+}
+
+var (
+	hourlyRollup = rollupLevel{
+		table: "HourlyRates",
+		size:  time.Hour,
+		source: `
+		SELECT cryptocurrency_id, fiat_currency_id, timestamp, rate, rate, rate, rate, 1
+		FROM ` + ratesPlaceholder + `
+		WHERE timestamp >= ? AND timestamp < ? AND source = '` + DefaultSource + `'`,
+		order: "cryptocurrency_id, fiat_currency_id, timestamp",
+		first: "SELECT timestamp FROM " + ratesPlaceholder + " WHERE source = '" + DefaultSource + "' ORDER BY timestamp LIMIT 1",
+		raw:   true,
+	}
+	dailyRollup = rollupLevel{
+		table: "DailyRates",
+		size:  24 * time.Hour,
+		source: `
+		SELECT cryptocurrency_id, fiat_currency_id, bucket_start, open, high, low, close, samples
+		FROM HourlyRates
+		WHERE bucket_start >= ? AND bucket_start < ?`,
+		order: "cryptocurrency_id, fiat_currency_id, bucket_start",
+		first: "SELECT bucket_start FROM HourlyRates ORDER BY bucket_start LIMIT 1",
+	}
+)
+
+// RollupResult describes the work done by Rollup.
+type RollupResult struct {
+	// HourlyBuckets and DailyBuckets count the rollup rows written.
+	HourlyBuckets int `json:"hourly_buckets"`
+	DailyBuckets  int `json:"daily_buckets"`
+	// Pruned counts the raw exchange rates deleted by the retention policy,
+	// and DroppedPartitions the partitions it dropped whole.
+	Pruned            int64 `json:"pruned"`
+	DroppedPartitions int   `json:"dropped_partitions"`
+}
+
+// candle is one open/high/low/close rollup row.
+type candle struct {
+	cryptoID, fiatID       int
+	bucketStart            time.Time
+	open, high, low, close decimal.Decimal
+	samples                int
+}
+
+// Rollup aggregates the raw exchange rates of DefaultSource of every completed
+// hour before now into HourlyRates, and the hourly rollups of every completed UTC day into
+// DailyRates. It resumes from the latest rollup, which it recomputes to take
+// in rates that arrived late, so it can run as often as needed. When the raw
+// retention of the Config is not zero, the raw rates of DefaultSource older
+// than it that have been rolled up are then deleted, and the partitions of
+// the months entirely older than it dropped. The rates of the other sources,
+// which are not rolled up, are kept.
+func (d *Database) Rollup(now time.Time) (RollupResult, error) {
+	var result RollupResult
+	var err error
+	now = now.UTC()
+
+	result.HourlyBuckets, err = d.rollup(hourlyRollup, now)
+	if err != nil {
+		return result, fmt.Errorf("rolling up hourly rates: %w", err)
+	}
+	result.DailyBuckets, err = d.rollup(dailyRollup, now)
+	if err != nil {
+		return result, fmt.Errorf("rolling up daily rates: %w", err)
+	}
+
+	if d.rawRetention != 0 {
+		result.Pruned, result.DroppedPartitions, err = d.pruneRawRates(now.Add(-d.rawRetention))
+		if err != nil {
+			return result, fmt.Errorf("pruning raw rates: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// latest selects the time of the latest bucket of level rolled up from its
+// source rows. Backfilled buckets, which have no samples, are left out.
+func (level rollupLevel) latest() string {
+	return "SELECT bucket_start FROM " + level.table + " WHERE samples > 0 ORDER BY bucket_start DESC LIMIT 1"
+}
+
+// rollup writes the buckets of level from its latest bucket up to the last
+// bucket completed before now, one day of source rows per transaction.
+func (d *Database) rollup(level rollupLevel, now time.Time) (int, error) {
+	start, ok, err := d.firstTime(level.latest())
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		start, ok, err = d.levelFirst(level)
+		if err != nil || !ok {
+			return 0, err
+		}
+	}
+	return d.rollupBetween(level, start.Truncate(level.size), now.Truncate(level.size), true)
+}
+
+// rollupBetween writes the buckets of level from start up to end, one day of
+// source rows per transaction, as rollupRange does.
+func (d *Database) rollupBetween(level rollupLevel, start, end time.Time, replace bool) (int, error) {
+	written := 0
+	for from := start; from.Before(end); {
+		to := from.Add(24 * time.Hour)
+		if to.After(end) {
+			to = end
+		}
+		n, err := d.rollupRange(level, from, to, replace)
+		if err != nil {
+			return written, err
+		}
+		written += n
+		from = to
+	}
+	return written, nil
+}
+
+// rollupRange replaces the buckets of level between from and to. Backfilled
+// buckets, which have no samples, are only replaced by the buckets computed
+// for their pair. Without replace, the computed buckets are merged into the
+// stored ones instead: a stored bucket is only replaced by a bucket of as
+// many samples, so that the buckets of source rows since deleted, such as
+// raw rates past their retention, are kept.
+func (d *Database) rollupRange(level rollupLevel, from, to time.Time, replace bool) (int, error) {
+	query, args := level.source, []interface{}{from, to}
+	if level.raw {
+		tables, err := d.rateTables(from, to, false)
+		if err != nil {
+			return 0, err
+		}
+		query, args = unionRates(query, tables, args)
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(d.dialect.rebind(query+" ORDER BY "+level.order), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	var candles []candle
+	for rows.Next() {
+		var c candle
+		var timestamp time.Time
+		if err := rows.Scan(&c.cryptoID, &c.fiatID, &timestamp, &c.open, &c.high, &c.low, &c.close, &c.samples); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		c.bucketStart = timestamp.UTC().Truncate(level.size)
+
+		last := len(candles) - 1
+		if last >= 0 && candles[last].cryptoID == c.cryptoID && candles[last].fiatID == c.fiatID &&
+			candles[last].bucketStart.Equal(c.bucketStart) {
+			candles[last].merge(c)
+		} else {
+			candles = append(candles, c)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if replace {
+		_, err = tx.Exec(d.dialect.rebind("DELETE FROM "+level.table+" WHERE bucket_start >= ? AND bucket_start < ? AND samples > 0"), from, to)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := d.insertCandles(tx, level, candles); err != nil {
+		return 0, err
+	}
+	return len(candles), tx.Commit()
+}
+
+// insertCandles writes candles to the table of level. A candle replaces the
+// one stored for its pair and bucket unless that one has more samples, so
+// that computed buckets replace backfilled ones but not the other way around.
+func (d *Database) insertCandles(tx *sql.Tx, level rollupLevel, candles []candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(d.dialect.rebind("INSERT INTO " + level.table +
+		" (cryptocurrency_id, fiat_currency_id, bucket_start, open, high, low, close, samples) VALUES (?, ?, ?, ?, ?, ?, ?, ?)" +
+		d.dialect.upsert(level.table, []string{"cryptocurrency_id", "fiat_currency_id", "bucket_start"},
+			[]string{"open", "high", "low", "close"}, "samples", ">=")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range candles {
+		_, err := stmt.Exec(c.cryptoID, c.fiatID, c.bucketStart, c.open, c.high, c.low, c.close, c.samples)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge folds a later row of the same bucket into c.
+func (c *candle) merge(later candle) {
+	if later.high.GreaterThan(c.high) {
+		c.high = later.high
+	}
+	if later.low.LessThan(c.low) {
+		c.low = later.low
+	}
+	c.close = later.close
+	c.samples += later.samples
+}
+
+// pruneRawRates deletes the raw rates of DefaultSource older than before that
+// are covered by the hourly rollups, dropping the partitions entirely older,
+// and returns the number of rates deleted and of partitions dropped. The rates
+// of the latest hourly bucket are kept, since the next rollup recomputes it.
+func (d *Database) pruneRawRates(before time.Time) (int64, int, error) {
+	latest, ok, err := d.firstTime(hourlyRollup.latest())
+	if err != nil || !ok {
+		return 0, 0, err
+	}
+	if latest.Before(before) {
+		before = latest
+	}
+
+	dropped, err := d.dropExpiredPartitions(before)
+	if err != nil {
+		return 0, dropped, err
+	}
+	tables, err := d.rateTables(time.Time{}, before, false)
+	if err != nil {
+		return 0, dropped, err
+	}
+	var pruned int64
+	for _, table := range tables {
+		result, err := d.DB.Exec(d.dialect.rebind("DELETE FROM "+table+" WHERE timestamp < ? AND source = ?"), before, DefaultSource)
+		if err != nil {
+			return pruned, dropped, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return pruned, dropped, err
+		}
+		pruned += n
+	}
+	return pruned, dropped, nil
+}
+
+// levelFirst returns the time of the oldest row aggregated by level, if any,
+// looking into every table of the raw rates but the archived ones.
+func (d *Database) levelFirst(level rollupLevel) (time.Time, bool, error) {
+	if !level.raw {
+		return d.firstTime(level.first)
+	}
+	tables, err := d.rateTables(time.Time{}, time.Time{}, false)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var first time.Time
+	found := false
+	for _, table := range tables {
+		t, ok, err := d.firstTime(strings.ReplaceAll(level.first, ratesPlaceholder, table))
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if ok && (!found || t.Before(first)) {
+			first, found = t, true
+		}
+	}
+	return first, found, nil
+}
+
+// firstTime runs a query selecting a time and returns the first one, if any.
+func (d *Database) firstTime(query string) (time.Time, bool, error) {
+	var t time.Time
+	err := d.queryRow(query).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t.UTC(), true, nil
+}
+
+// GetRateHistory returns the rates of a pair from DefaultSource since the
+// given time, oldest first. The last RawHistoryWindow is read from the raw rates. Older history
+// is read at hourly resolution up to a month back and daily beyond, with the
+// close of every rollup bucket as its value, and the part not rolled up yet is
+// filled in from the finer resolutions. A pair without raw rates since then,
+// such as one only backfilled so far, is read at hourly resolution.
+func (d *Database) GetRateHistory(crypto, fiat string, since time.Time) ([]RateWithTimestamp, error) {
+	since = since.UTC()
+	// Rounded, so that the history of the last RawHistoryWindow, requested a
+	// moment ago, is still read from the raw rates.
+	age := time.Since(since).Round(time.Minute)
+
+	var levels []rollupLevel
+	switch {
+	case age > hourlyHistoryWindow:
+		levels = []rollupLevel{dailyRollup, hourlyRollup}
+	case age > RawHistoryWindow:
+		levels = []rollupLevel{hourlyRollup}
+	}
+
+	rates := make([]RateWithTimestamp, 0)
+	cursor := since
+	for _, level := range levels {
+		history, last, err := d.rateHistory(level.history(), crypto, fiat, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(history) > 0 {
+			rates = append(rates, history...)
+			cursor = last.Add(level.size)
+		}
+	}
+
+	query := `
+	SELECT er.rate, er.timestamp
+	FROM ` + ratesPlaceholder + ` er
+	JOIN Cryptocurrencies c ON c.cryptocurrency_id = er.cryptocurrency_id
+	JOIN FiatCurrencies f ON f.fiat_currency_id = er.fiat_currency_id
+	WHERE c.symbol = ? AND f.symbol = ? AND er.timestamp >= ? AND er.source = ?
+	`
+	tables, err := d.rateTables(cursor, time.Time{}, false)
+	if err != nil {
+		return nil, err
+	}
+	query, args := unionRates(query, tables, []interface{}{crypto, fiat, cursor, DefaultSource})
+	history, _, err := d.rateHistory(query+" ORDER BY timestamp", args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 && len(levels) == 0 {
+		history, _, err = d.rateHistory(hourlyRollup.history(), crypto, fiat, cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(rates, history...), nil
+}
+
+// history selects the close and time of the buckets of level of a pair,
+// given by crypto and fiat symbol, from a time on.
+func (level rollupLevel) history() string {
+	return `
+	SELECT r.close, r.bucket_start
+	FROM ` + level.table + ` r
+	JOIN Cryptocurrencies c ON c.cryptocurrency_id = r.cryptocurrency_id
+	JOIN FiatCurrencies f ON f.fiat_currency_id = r.fiat_currency_id
+	WHERE c.symbol = ? AND f.symbol = ? AND r.bucket_start >= ?
+	ORDER BY r.bucket_start
+	`
+}
+
+// rateHistory runs a query selecting a value and a time per row, and returns
+// the rows and the time of the last one.
+func (d *Database) rateHistory(query string, args ...interface{}) ([]RateWithTimestamp, time.Time, error) {
+	rows, err := d.readQuery(query, args...)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer rows.Close()
+
+	rates := make([]RateWithTimestamp, 0)
+	var last time.Time
+	for rows.Next() {
+		var rate decimal.Decimal
+		if err := rows.Scan(&rate, &last); err != nil {
+			return nil, time.Time{}, err
+		}
+		last = last.UTC()
+		rates = append(rates, RateWithTimestamp{
+			Value:     rate,
+			Timestamp: last.Format(time.RFC3339Nano),
+		})
+	}
+
+	return rates, last, rows.Err()
+}
+
+// MaxPeriodDays is the longest history period ParsePeriod accepts, in days,
+// which goes back before the first exchange rate of any pair.
+const MaxPeriodDays = 100 * 365
+
+// ParsePeriod parses the length of a history period, either as a number of
+// days such as "7d" or as a Go duration such as "36h", of at most
+// MaxPeriodDays.
+func ParsePeriod(period string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := cutSuffix(period, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period %q", period)
+		}
+		// Checked before the multiplication, which overflows for large n.
+		if n > MaxPeriodDays {
+			return 0, fmt.Errorf("invalid period %q, it must be at most %dd", period, MaxPeriodDays)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		d, err = time.ParseDuration(period)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period %q", period)
+		}
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid period %q, it must be positive", period)
+	}
+	if d > MaxPeriodDays*24*time.Hour {
+		return 0, fmt.Errorf("invalid period %q, it must be at most %dd", period, MaxPeriodDays)
+	}
+	return d, nil
+}
+
+func cutSuffix(s, suffix string) (string, bool) {
+	if !strings.HasSuffix(s, suffix) {
+		return s, false
+	}
+	return strings.TrimSuffix(s, suffix), true
+}
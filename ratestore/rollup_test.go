@@ -0,0 +1,145 @@
+package ratestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queryCandles(t *testing.T, db *Database, table string) []candle {
+	rows, err := db.DB.Query("SELECT cryptocurrency_id, fiat_currency_id, bucket_start, open, high, low, close, samples FROM " +
+		table + " ORDER BY cryptocurrency_id, fiat_currency_id, bucket_start")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var candles []candle
+	for rows.Next() {
+		var c candle
+		require.NoError(t, rows.Scan(&c.cryptoID, &c.fiatID, &c.bucketStart, &c.open, &c.high, &c.low, &c.close, &c.samples))
+		c.bucketStart = c.bucketStart.UTC()
+		candles = append(candles, c)
+	}
+	require.NoError(t, rows.Err())
+	return candles
+}
+
+func TestRollup(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour).Add(-3 * 24 * time.Hour)
+
+	insertTestRate(t, db, 1, 1, "10", day.Add(10*time.Minute))
+	insertTestRate(t, db, 1, 1, "14", day.Add(20*time.Minute))
+	insertTestRate(t, db, 1, 1, "8", day.Add(50*time.Minute))
+	insertTestRate(t, db, 1, 1, "12", day.Add(70*time.Minute))
+	insertTestRate(t, db, 1, 1, "20", day.Add(24*time.Hour+5*time.Minute))
+	insertTestRate(t, db, 2, 1, "5", day.Add(5*time.Minute))
+	insertTestRate(t, db, 1, 1, "30", now)
+
+	result, err := db.Rollup(now)
+	require.NoError(t, err)
+	assert.Equal(t, RollupResult{HourlyBuckets: 4, DailyBuckets: 3}, result)
+
+	assert.Equal(t, []candle{
+		{1, 1, day, dec("10"), dec("14"), dec("8"), dec("8"), 3},
+		{1, 1, day.Add(time.Hour), dec("12"), dec("12"), dec("12"), dec("12"), 1},
+		{1, 1, day.Add(24 * time.Hour), dec("20"), dec("20"), dec("20"), dec("20"), 1},
+		{2, 1, day, dec("5"), dec("5"), dec("5"), dec("5"), 1},
+	}, queryCandles(t, db, "HourlyRates"))
+	assert.Equal(t, []candle{
+		{1, 1, day, dec("10"), dec("14"), dec("8"), dec("12"), 4},
+		{1, 1, day.Add(24 * time.Hour), dec("20"), dec("20"), dec("20"), dec("20"), 1},
+		{2, 1, day, dec("5"), dec("5"), dec("5"), dec("5"), 1},
+	}, queryCandles(t, db, "DailyRates"))
+
+	// Running again recomputes only the latest buckets and changes nothing.
+	result, err = db.Rollup(now)
+	require.NoError(t, err)
+	assert.Equal(t, RollupResult{HourlyBuckets: 1, DailyBuckets: 1}, result)
+	assert.Len(t, queryCandles(t, db, "HourlyRates"), 4)
+	assert.Len(t, queryCandles(t, db, "DailyRates"), 3)
+}
+
+func TestRollupRetention(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour).Add(-3 * 24 * time.Hour)
+
+	insertTestRate(t, db, 1, 1, "10", day.Add(10*time.Minute))
+	insertTestRate(t, db, 1, 1, "12", day.Add(70*time.Minute))
+	insertTestRate(t, db, 1, 1, "20", day.Add(24*time.Hour+5*time.Minute))
+	insertTestRate(t, db, 1, 1, "30", now)
+	_, err := db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("11"), Timestamp: day.Add(10 * time.Minute), Source: "kraken"},
+	})
+	require.NoError(t, err)
+
+	db.rawRetention = 24 * time.Hour
+	result, err := db.Rollup(now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Pruned, "the rates of the latest hourly bucket are kept")
+
+	var remaining int
+	require.NoError(t, db.DB.QueryRow("SELECT COUNT(*) FROM ExchangeRates").Scan(&remaining))
+	assert.Equal(t, 3, remaining)
+	var kraken int
+	require.NoError(t, db.DB.QueryRow("SELECT COUNT(*) FROM ExchangeRates WHERE source = 'kraken'").Scan(&kraken))
+	assert.Equal(t, 1, kraken, "the rates of other sources, which are not rolled up, are kept")
+}
+
+func TestGetRateHistory(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC()
+	day := now.Truncate(24 * time.Hour).Add(-3 * 24 * time.Hour)
+
+	insertTestRate(t, db, 1, 1, "10", day.Add(10*time.Minute))
+	insertTestRate(t, db, 1, 1, "12", day.Add(70*time.Minute))
+	insertTestRate(t, db, 1, 1, "20", day.Add(24*time.Hour+5*time.Minute))
+	insertTestRate(t, db, 1, 1, "30", now)
+	db.rawRetention = 24 * time.Hour
+	_, err := db.Rollup(now)
+	require.NoError(t, err)
+
+	at := func(t time.Time) string { return t.Format(time.RFC3339Nano) }
+
+	rates, err := db.GetRateHistory("BTC", "USD", now.Add(-4*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []RateWithTimestamp{
+		{Value: dec("10"), Timestamp: at(day)},
+		{Value: dec("12"), Timestamp: at(day.Add(time.Hour))},
+		{Value: dec("20"), Timestamp: at(day.Add(24 * time.Hour))},
+		{Value: dec("30"), Timestamp: at(now)},
+	}, rates)
+
+	rates, err = db.GetRateHistory("BTC", "USD", now.Add(-60*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []RateWithTimestamp{
+		{Value: dec("12"), Timestamp: at(day)},
+		{Value: dec("20"), Timestamp: at(day.Add(24 * time.Hour))},
+		{Value: dec("30"), Timestamp: at(now)},
+	}, rates)
+
+	rates, err = db.GetHistoricalExchangeRates("BTC", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, []RateWithTimestamp{{Value: dec("30"), Timestamp: at(now)}}, rates)
+}
+
+func TestParsePeriod(t *testing.T) {
+	for period, want := range map[string]time.Duration{
+		"7d":     7 * 24 * time.Hour,
+		"36h":    36 * time.Hour,
+		"90m":    90 * time.Minute,
+		"36500d": MaxPeriodDays * 24 * time.Hour,
+	} {
+		got, err := ParsePeriod(period)
+		assert.NoError(t, err, period)
+		assert.Equal(t, want, got, period)
+	}
+
+	for _, period := range []string{"", "d", "week", "-1d", "0h", "36501d", "106751992d", "876001h"} {
+		_, err := ParsePeriod(period)
+		assert.Error(t, err, period)
+	}
+}
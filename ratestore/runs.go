@@ -0,0 +1,138 @@
+package ratestore
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Statuses of an IngestionRun.
+const (
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+)
+
+// ProviderCryptoCompare is the provider recorded for runs fetching from the
+// CryptoCompare price API.
+const ProviderCryptoCompare = "cryptocompare"
+
+// DefaultRunLimit and MaxRunLimit bound the number of runs listed by the
+// ingestion run endpoints.
+const (
+	DefaultRunLimit = 20
+	MaxRunLimit     = 100
+)
+
+// IngestionRun is an entry of the ingestion ledger. A run is recorded as
+// running when it starts, so a run that never finished, such as one whose
+// process was killed, stays running.
+type IngestionRun struct {
+	ID         int64      `json:"run_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Status     string     `json:"status"`
+	Provider   string     `json:"provider"`
+	// Requested counts the pairs asked from the provider, Received the pairs
+	// it returned, Inserted the rates stored and Skipped the pairs returned
+	// with a symbol that is not an active currency.
+	Requested  int    `json:"requested"`
+	Received   int    `json:"received"`
+	Inserted   int    `json:"inserted"`
+	Skipped    int    `json:"skipped"`
+	SnapshotID int64  `json:"snapshot_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// StartIngestionRun records a run of provider started at startedAt and
+// returns its ID.
+func (d *Database) StartIngestionRun(provider string, startedAt time.Time) (int64, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := d.dialect.insertID(tx, "INSERT INTO IngestionRuns (started_at, status, provider) VALUES (?, ?, ?)", "run_id",
+		startedAt.UTC(), RunStatusRunning, provider)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// FinishIngestionRun records the outcome of the run with the ID of run.
+func (d *Database) FinishIngestionRun(run IngestionRun) error {
+	var finishedAt interface{}
+	if run.FinishedAt != nil {
+		finishedAt = run.FinishedAt.UTC()
+	}
+	snapshotID := sql.NullInt64{Int64: run.SnapshotID, Valid: run.SnapshotID != 0}
+	runError := sql.NullString{String: run.Error, Valid: run.Error != ""}
+
+	result, err := d.DB.Exec(d.dialect.rebind(`
+	UPDATE IngestionRuns
+	SET finished_at = ?, status = ?, requested = ?, received = ?, inserted = ?, skipped = ?, snapshot_id = ?, error = ?
+	WHERE run_id = ?
+	`), finishedAt, run.Status, run.Requested, run.Received, run.Inserted, run.Skipped, snapshotID, runError, run.ID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("ingestion run %d: %w", run.ID, ErrNotFound)
+	}
+	return nil
+}
+
+// ListIngestionRuns returns the latest limit runs, newest first.
+func (d *Database) ListIngestionRuns(limit int) ([]IngestionRun, error) {
+	rows, err := d.query(`
+	SELECT run_id, started_at, finished_at, status, provider, requested, received, inserted, skipped, snapshot_id, error
+	FROM IngestionRuns
+	ORDER BY started_at DESC, run_id DESC
+	LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]IngestionRun, 0)
+	for rows.Next() {
+		var run IngestionRun
+		var finishedAt sql.NullTime
+		var snapshotID sql.NullInt64
+		var runError sql.NullString
+		err := rows.Scan(&run.ID, &run.StartedAt, &finishedAt, &run.Status, &run.Provider,
+			&run.Requested, &run.Received, &run.Inserted, &run.Skipped, &snapshotID, &runError)
+		if err != nil {
+			return nil, err
+		}
+		run.StartedAt = run.StartedAt.UTC()
+		if finishedAt.Valid {
+			t := finishedAt.Time.UTC()
+			run.FinishedAt = &t
+		}
+		run.SnapshotID, run.Error = snapshotID.Int64, runError.String
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// ParseRunLimit parses the number of runs to list, DefaultRunLimit if empty.
+func ParseRunLimit(limit string) (int, error) {
+	if limit == "" {
+		return DefaultRunLimit, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 || n > MaxRunLimit {
+		return 0, fmt.Errorf("invalid limit %q, it must be between 1 and %d", limit, MaxRunLimit)
+	}
+	return n, nil
+}
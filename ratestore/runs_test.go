@@ -0,0 +1,55 @@
+package ratestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListIngestionRuns(t *testing.T) {
+	db := newTestDatabase(t)
+	start := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	first, err := db.StartIngestionRun(ProviderCryptoCompare, start)
+	require.NoError(t, err)
+	finishedAt := start.Add(2 * time.Second)
+	require.NoError(t, db.FinishIngestionRun(IngestionRun{
+		ID: first, FinishedAt: &finishedAt, Status: RunStatusFailed, Requested: 4, Error: "API call failed with status code: 429",
+	}))
+	second, err := db.StartIngestionRun(ProviderCryptoCompare, start.Add(10*time.Minute))
+	require.NoError(t, err)
+
+	runs, err := db.ListIngestionRuns(DefaultRunLimit)
+	require.NoError(t, err)
+	assert.Equal(t, []IngestionRun{
+		{ID: second, StartedAt: start.Add(10 * time.Minute), Status: RunStatusRunning, Provider: ProviderCryptoCompare},
+		{ID: first, StartedAt: start, FinishedAt: &finishedAt, Status: RunStatusFailed, Provider: ProviderCryptoCompare,
+			Requested: 4, Error: "API call failed with status code: 429"},
+	}, runs)
+
+	runs, err = db.ListIngestionRuns(1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, second, runs[0].ID)
+}
+
+func TestFinishIngestionRunUnknown(t *testing.T) {
+	db := newTestDatabase(t)
+
+	err := db.FinishIngestionRun(IngestionRun{ID: 42, Status: RunStatusSucceeded})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestParseRunLimit(t *testing.T) {
+	for limit, want := range map[string]int{"": DefaultRunLimit, "1": 1, "100": 100} {
+		got, err := ParseRunLimit(limit)
+		assert.NoError(t, err, limit)
+		assert.Equal(t, want, got, limit)
+	}
+	for _, limit := range []string{"0", "-5", "101", "ten"} {
+		_, err := ParseRunLimit(limit)
+		assert.Error(t, err, limit)
+	}
+}
@@ -0,0 +1,34 @@
+package ratestore
+
+import "sync"
+
+// SharedDatabase opens a Database on first use and hands the same connection
+// pool to every later caller. It suits the Netlify functions, whose containers
+// serve many requests: the pool outlives a single invocation, and a failed open
+// is retried by the next caller instead of failing the cold start.
+type SharedDatabase struct {
+	open func() (*Database, error)
+
+	mu sync.Mutex
+	db *Database
+}
+
+// NewSharedDatabase returns a SharedDatabase that opens the database with open.
+func NewSharedDatabase(open func() (*Database, error)) *SharedDatabase {
+	return &SharedDatabase{open: open}
+}
+
+// Get returns the shared Database, opening it if needed.
+func (s *SharedDatabase) Get() (*Database, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil {
+		db, err := s.open()
+		if err != nil {
+			return nil, err
+		}
+		s.db = db
+	}
+	return s.db, nil
+}
@@ -0,0 +1,36 @@
+package ratestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.db")
+	opens := 0
+	fail := true
+	shared := NewSharedDatabase(func() (*Database, error) {
+		opens++
+		if fail {
+			return nil, errors.New("database unavailable")
+		}
+		return NewDatabase(Config{Driver: DriverSQLite, Database: path})
+	})
+
+	_, err := shared.Get()
+	assert.Error(t, err)
+
+	fail = false
+	db, err := shared.Get()
+	require.NoError(t, err)
+	defer db.Close()
+
+	again, err := shared.Get()
+	assert.NoError(t, err)
+	assert.Same(t, db, again)
+	assert.Equal(t, 2, opens)
+}
@@ -0,0 +1,99 @@
+package ratestore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultSource is the price source the latest rates are served from when no
+// source is requested. History and its rollups are only kept for this source.
+const DefaultSource = ProviderCryptoCompare
+
+// maxSourceLength is the length of the source columns.
+const maxSourceLength = 50
+
+// SourceRate is the latest rate of a pair from one price source, with the
+// snapshot it was ingested in.
+type SourceRate struct {
+	Value decimal.Decimal `json:"value"`
+	Snapshot
+}
+
+// ParseSource returns the price source named by source, in lower case, or
+// DefaultSource if source is empty. A source is made of lower case letters,
+// digits, '-' and '_'.
+func ParseSource(source string) (string, error) {
+	source = strings.ToLower(strings.TrimSpace(source))
+	if source == "" {
+		return DefaultSource, nil
+	}
+	if len(source) > maxSourceLength {
+		return "", fmt.Errorf("invalid source %q: longer than %d characters", source, maxSourceLength)
+	}
+	for _, r := range source {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return "", fmt.Errorf("invalid source %q: only letters, digits, '-' and '_' are allowed", source)
+		}
+	}
+	return source, nil
+}
+
+// sourceOrDefault returns source, or DefaultSource if it is empty.
+func sourceOrDefault(source string) string {
+	if source == "" {
+		return DefaultSource
+	}
+	return source
+}
+
+// GetExchangeRateSources returns the latest rate of crypto in fiat from every
+// source that has one, ordered by source, for comparing the sources. It
+// returns ErrNotFound if no source has a rate of the pair.
+func (d *Database) GetExchangeRateSources(crypto, fiat string) ([]SourceRate, error) {
+	query := `
+	SELECT lr.rate, s.snapshot_id, s.taken_at, lr.source
+	FROM LatestRates lr
+	JOIN Snapshots s ON s.snapshot_id = lr.snapshot_id
+	JOIN Cryptocurrencies c ON c.cryptocurrency_id = lr.cryptocurrency_id
+	JOIN FiatCurrencies f ON f.fiat_currency_id = lr.fiat_currency_id
+	WHERE c.symbol = ? AND f.symbol = ?
+	ORDER BY lr.source
+	`
+
+	rows, err := d.readQuery(query, crypto, fiat)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []SourceRate
+	for rows.Next() {
+		var rate SourceRate
+		if err := rows.Scan(&rate.Value, &rate.ID, &rate.TakenAt, &rate.Source); err != nil {
+			return nil, err
+		}
+		rate.TakenAt = rate.TakenAt.UTC()
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, ErrNotFound
+	}
+	return rates, nil
+}
+
+// batchSource returns the source of a batch of rates, which must all come
+// from the same source.
+func batchSource(rates []ExchangeRate) (string, error) {
+	source := sourceOrDefault(rates[0].Source)
+	for _, rate := range rates[1:] {
+		if other := sourceOrDefault(rate.Source); other != source {
+			return "", fmt.Errorf("exchange rates from sources %s and %s in one snapshot", source, other)
+		}
+	}
+	return source, nil
+}
@@ -0,0 +1,89 @@
+package ratestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSource(t *testing.T) {
+	source, err := ParseSource("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultSource, source)
+
+	source, err = ParseSource(" Coin_Gecko-2 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "coin_gecko-2", source)
+
+	_, err = ParseSource("kraken;drop")
+	assert.Error(t, err)
+	_, err = ParseSource("a123456789a123456789a123456789a123456789a123456789a")
+	assert.Error(t, err)
+}
+
+func TestDatabaseRatesPerSource(t *testing.T) {
+	db := newTestDatabase(t)
+	now := time.Now().UTC().Truncate(DefaultRateBucket)
+
+	compare, err := db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("30150.12"), Timestamp: now.Add(-time.Minute)},
+		{CryptoID: 1, FiatID: 2, Rate: dec("2487686.4"), Timestamp: now.Add(-time.Minute)},
+	})
+	require.NoError(t, err)
+	kraken, err := db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("30149.8"), Timestamp: now, Source: "kraken"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "kraken", kraken.Source)
+
+	// A newer batch of one source leaves the latest rates of the others.
+	compare, err = db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("30160"), Timestamp: now},
+	})
+	require.NoError(t, err)
+
+	rate, snapshot, err := db.GetExchangeRate("BTC", "USD", "")
+	assert.NoError(t, err)
+	assert.Equal(t, dec("30160"), rate)
+	assert.Equal(t, compare, snapshot)
+
+	rate, snapshot, err = db.GetExchangeRate("BTC", "USD", "kraken")
+	assert.NoError(t, err)
+	assert.Equal(t, dec("30149.8"), rate)
+	assert.Equal(t, kraken, snapshot)
+
+	_, _, err = db.GetExchangeRate("BTC", "INR", "kraken")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	rates, _, err := db.GetAllExchangeRates("kraken")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]decimal.Decimal{"BTC": {"USD": dec("30149.8")}}, rates)
+
+	sources, err := db.GetExchangeRateSources("BTC", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, []SourceRate{
+		{Value: dec("30160"), Snapshot: compare},
+		{Value: dec("30149.8"), Snapshot: kraken},
+	}, sources)
+
+	_, err = db.GetExchangeRateSources("ETH", "USD")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// History is only kept for the default source.
+	history, err := db.GetHistoricalExchangeRates("BTC", "USD")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestDatabaseInsertExchangeRatesMixedSources(t *testing.T) {
+	db := newTestDatabase(t)
+
+	_, err := db.InsertExchangeRates([]ExchangeRate{
+		{CryptoID: 1, FiatID: 1, Rate: dec("30150.12"), Timestamp: time.Now()},
+		{CryptoID: 1, FiatID: 2, Rate: dec("2487686.4"), Timestamp: time.Now(), Source: "kraken"},
+	})
+	assert.Error(t, err)
+}